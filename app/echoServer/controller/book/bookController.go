@@ -34,10 +34,17 @@ func (h *Controller) Create(c echo.Context) error {
 	if err := h.V.Struct(req); err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{
 			"message": "validation error",
-			"errors":  echo.Map{"name": "required", "category": "required", "rental_cost": "gte 0"},
+			"errors":  echo.Map{"name": "required", "category": "required", "rental_cost": "gte 0", "rental_days": "1..365", "late_fee_per_day": "gte 0", "replacement_cost": "gte 0"},
 		})
 	}
-	id, err := h.Svc.Create(c.Request().Context(), req.Name, req.Category, req.RentalCost)
+	id, err := h.Svc.Create(c.Request().Context(), booksvc.Book{
+		Name:            req.Name,
+		Category:        req.Category,
+		RentalCost:      req.RentalCost,
+		RentalDays:      req.RentalDays,
+		LateFeePerDay:   req.LateFeePerDay,
+		ReplacementCost: req.ReplacementCost,
+	})
 	if err != nil {
 		h.Log.Error("book create error", "err", err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
@@ -59,9 +66,9 @@ func (h *Controller) AddCopies(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid json"})
 	}
 	if err := h.V.Struct(req); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": echo.Map{"count": "gt 0"}})
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": echo.Map{"count": "gt 0", "branch": "max 64"}})
 	}
-	added, err := h.Svc.AddCopies(c.Request().Context(), id, req.Count)
+	added, err := h.Svc.AddCopies(c.Request().Context(), id, req.Count, req.Branch)
 	if err != nil {
 		h.Log.Error("add copies error", "err", err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
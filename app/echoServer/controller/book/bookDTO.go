@@ -1,11 +1,20 @@
 package book
 
+import "bookrental/model"
+
 type CreateBookReq struct {
-	Name       string  `json:"name" validate:"required"`
-	Category   string  `json:"category" validate:"required"`
-	RentalCost float64 `json:"rental_cost" validate:"required,gte=0"`
+	Name       string      `json:"name" validate:"required"`
+	Category   string      `json:"category" validate:"required"`
+	RentalCost model.Money `json:"rental_cost" validate:"required,gte=0"`
+	// Loan period in days; 0 means the default (7).
+	RentalDays    int         `json:"rental_days" validate:"omitempty,gt=0,lte=365"`
+	LateFeePerDay model.Money `json:"late_fee_per_day" validate:"gte=0"`
+	// Charged when a copy is reported LOST or DAMAGED.
+	ReplacementCost model.Money `json:"replacement_cost" validate:"gte=0"`
 }
 
 type AddCopiesReq struct {
 	Count int `json:"count" validate:"required,gt=0"`
+	// Branch the copies are shelved at; empty means "main".
+	Branch string `json:"branch" validate:"omitempty,max=64"`
 }
@@ -1,16 +1,21 @@
 package payment
 
 import (
+	"bookrental/model"
+	paymentrepo "bookrental/repository/payment"
 	paymentsvc "bookrental/service/payment"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 )
 
 type Controller struct {
 	Svc paymentsvc.Service
+	V   *validator.Validate
 	Log *slog.Logger
 }
 
@@ -22,9 +27,87 @@ func (h *Controller) HandleXendit(c echo.Context) error {
 	)
 	raw, _ := io.ReadAll(c.Request().Body)
 
-	if err := h.Svc.HandleXendit(c.Request().Context(), sig, raw); err != nil {
+	if err := h.Svc.HandleXendit(c.Request().Context(), c.Request().Header, raw); err != nil {
 		h.Log.Error("payment callback error", "err", err)
 		return c.JSON(http.StatusBadRequest, echo.Map{"message": "payment rejected"})
 	}
 	return c.JSON(http.StatusOK, echo.Map{"message": "ok"})
 }
+
+func (h *Controller) HandleDisbursement(c echo.Context) error {
+	sig := c.Request().Header.Get("X-Callback-Token")
+	h.Log.Info("xendit disbursement webhook",
+		"ip", c.RealIP(),
+		"token_present", sig != "",
+	)
+	raw, _ := io.ReadAll(c.Request().Body)
+
+	if err := h.Svc.HandleDisbursement(c.Request().Context(), c.Request().Header, raw); err != nil {
+		h.Log.Error("disbursement callback error", "err", err)
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "payment rejected"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "ok"})
+}
+
+// POST /v1/admin/payments/reconcile  (admin)
+// Runs a top-up reconciliation now and returns its report.
+func (h *Controller) Reconcile(c echo.Context) error {
+	rep, err := h.Svc.Reconcile(c.Request().Context())
+	if err != nil {
+		h.Log.Error("reconcile failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	h.Log.Info("reconcile run", "admin_id", c.Get("user_id"), "checked", rep.Checked, "discrepancies", len(rep.Discrepancies))
+	return c.JSON(http.StatusOK, rep)
+}
+
+// GET /v1/admin/payments/reconcile  (admin)
+// Returns the report of the latest run, manual or scheduled.
+func (h *Controller) LastReconcile(c echo.Context) error {
+	rep := h.Svc.LastReconcile()
+	if rep == nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"message": "no reconciliation has run yet"})
+	}
+	return c.JSON(http.StatusOK, rep)
+}
+
+// GET /v1/admin/payments/events?status=FAILED&kind=INVOICE  (admin)
+func (h *Controller) Events(c echo.Context) error {
+	var q EventQuery
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &q); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid query"})
+	}
+	if err := h.V.Struct(q); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+	rows, err := h.Svc.Events(c.Request().Context(), paymentrepo.EventFilter{
+		Status: model.PaymentEventStatus(q.Status),
+		Kind:   model.PaymentEventKind(q.Kind),
+		Limit:  q.Limit,
+	})
+	if err != nil {
+		h.Log.Error("Events failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"data": rows})
+}
+
+// POST /v1/admin/payments/events/:id/replay  (admin)
+func (h *Controller) ReplayEvent(c echo.Context) error {
+	adminID := c.Get("user_id").(int64)
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid event id"})
+	}
+	ev, err := h.Svc.ReplayEvent(c.Request().Context(), id)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			h.Log.Warn("admin replay event failed", "err", he, "admin_id", adminID, "event_id", id)
+			return he
+		}
+		h.Log.Error("admin replay event failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	h.Log.Info("admin replayed event", "admin_id", adminID, "event_id", ev.ID, "status", ev.Status)
+	return c.JSON(http.StatusOK, ev)
+}
@@ -0,0 +1,8 @@
+package payment
+
+// EventQuery is the filter for GET /v1/admin/payments/events.
+type EventQuery struct {
+	Status string `query:"status" validate:"omitempty,oneof=RECEIVED PROCESSED FAILED REJECTED"`
+	Kind   string `query:"kind" validate:"omitempty,oneof=INVOICE DISBURSEMENT"`
+	Limit  int    `query:"limit" validate:"omitempty,min=1,max=200"`
+}
@@ -0,0 +1,74 @@
+package rental
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GET /v1/books/:id/pickup-slots
+func (h *Controller) FreeSlots(c echo.Context) error {
+	bookID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || bookID <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid id"})
+	}
+	rows, err := h.Svc.FreeSlots(c.Request().Context(), bookID)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"data": rows})
+}
+
+// POST /v1/rentals/:id/reschedule
+func (h *Controller) Reschedule(c echo.Context) error {
+	uid, ok := userIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"message": "unauthorized"})
+	}
+	rid, ok := rentalIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid rental id"})
+	}
+	var req RescheduleReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid JSON"})
+	}
+	if err := h.V.Struct(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+
+	res, err := h.Svc.Reschedule(c.Request().Context(), uid, rid, req.SlotID)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			if h.Log != nil {
+				h.Log.Warn("reschedule failed", "err", he, "user_id", uid, "rental_id", rid, "slot_id", req.SlotID)
+			}
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "rescheduled", "data": res})
+}
+
+// POST /v1/admin/pickup-slots  (admin)
+func (h *Controller) CreateSlot(c echo.Context) error {
+	var req CreateSlotReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid JSON"})
+	}
+	if err := h.V.Struct(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+	id, err := h.Svc.CreateSlot(c.Request().Context(), req.Branch, req.StartsAt, req.EndsAt, req.Capacity)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusCreated, echo.Map{"message": "created", "slot_id": id})
+}
@@ -0,0 +1,104 @@
+package rental
+
+import (
+	"net/http"
+	"time"
+
+	"bookrental/model"
+	svc "bookrental/service/rental"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GET /v1/admin/rentals  (admin)
+func (h *Controller) AdminList(c echo.Context) error {
+	var q AdminRentalQuery
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &q); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid query"})
+	}
+	if err := h.V.Struct(q); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+
+	f := svc.RentalFilter{
+		Status:  model.RentalStatus(q.Status),
+		UserID:  q.UserID,
+		BookID:  q.BookID,
+		Overdue: q.Overdue,
+		Limit:   q.Limit,
+		Offset:  q.Offset,
+	}
+	if q.From != "" {
+		from, _ := time.Parse(time.DateOnly, q.From)
+		f.From = &from
+	}
+	if q.To != "" {
+		to, _ := time.Parse(time.DateOnly, q.To)
+		to = to.AddDate(0, 0, 1)
+		f.To = &to
+	}
+
+	rows, err := h.Svc.AdminList(c.Request().Context(), f)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"data": rows})
+}
+
+// POST /v1/admin/rentals/:id/force-return  (admin)
+func (h *Controller) ForceReturn(c echo.Context) error {
+	return h.adminAction(c, "force return", func(adminID, rentalID int64, reason string) (any, error) {
+		return h.Svc.ForceReturn(c.Request().Context(), adminID, rentalID, reason)
+	})
+}
+
+// POST /v1/admin/rentals/:id/force-cancel  (admin)
+func (h *Controller) ForceCancel(c echo.Context) error {
+	return h.adminAction(c, "force cancel", func(adminID, rentalID int64, reason string) (any, error) {
+		return h.Svc.ForceCancel(c.Request().Context(), adminID, rentalID, reason)
+	})
+}
+
+// POST /v1/admin/rentals/:id/waive-fees  (admin)
+func (h *Controller) WaiveFees(c echo.Context) error {
+	return h.adminAction(c, "waive fees", func(adminID, rentalID int64, reason string) (any, error) {
+		return h.Svc.WaiveFees(c.Request().Context(), adminID, rentalID, reason)
+	})
+}
+
+// adminAction does the shared parsing for the admin override endpoints.
+func (h *Controller) adminAction(c echo.Context, name string, act func(adminID, rentalID int64, reason string) (any, error)) error {
+	adminID, ok := userIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"message": "unauthorized"})
+	}
+	rid, ok := rentalIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid rental id"})
+	}
+	var req AdminActionReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid JSON"})
+	}
+	if err := h.V.Struct(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+
+	res, err := act(adminID, rid, req.Reason)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			if h.Log != nil {
+				h.Log.Warn("admin "+name+" failed", "err", he, "admin_id", adminID, "rental_id", rid)
+			}
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	if h.Log != nil {
+		h.Log.Info("admin "+name, "admin_id", adminID, "rental_id", rid, "reason", req.Reason)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "ok", "data": res})
+}
@@ -4,10 +4,13 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"bookrental/model"
 	svc "bookrental/service/rental"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
@@ -22,6 +25,27 @@ func userIDFrom(c echo.Context) (int64, bool) {
 	return v, ok
 }
 
+func isAdmin(c echo.Context) bool {
+	role, _ := c.Get("role").(string)
+	return role == "admin"
+}
+
+// payerEmailFrom reads the email claim Xendit invoices are addressed to.
+func payerEmailFrom(c echo.Context) string {
+	tok, _ := c.Get("user").(*jwt.Token)
+	if tok == nil {
+		return ""
+	}
+	claims, _ := tok.Claims.(jwt.MapClaims)
+	email, _ := claims["email"].(string)
+	return strings.TrimSpace(email)
+}
+
+func rentalIDFrom(c echo.Context) (int64, bool) {
+	rid, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	return rid, err == nil && rid > 0
+}
+
 // POST /v1/rentals/book
 func (h *Controller) BookWithDeposit(c echo.Context) error {
 	if h.Log != nil {
@@ -43,7 +67,11 @@ func (h *Controller) BookWithDeposit(c echo.Context) error {
 	if req.HoldMinutes != nil {
 		hold = *req.HoldMinutes
 	}
-	if err := h.Svc.BookWithDeposit(c.Request().Context(), uid, req.BookID, hold); err != nil {
+	if req.PayWith == "invoice" {
+		return h.bookWithInvoice(c, uid, req.BookID, hold, req.SlotID)
+	}
+	rentalID, err := h.Svc.BookWithDeposit(c.Request().Context(), uid, req.BookID, hold, req.SlotID)
+	if err != nil {
 		if he, ok := err.(*echo.HTTPError); ok {
 			if h.Log != nil {
 				//debug mode
@@ -53,27 +81,247 @@ func (h *Controller) BookWithDeposit(c echo.Context) error {
 		} //debug mode
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": err.Error()})
 	}
-	return c.JSON(http.StatusCreated, echo.Map{"message": "booked"})
+	return c.JSON(http.StatusCreated, echo.Map{"message": "booked", "rental_id": rentalID})
+}
+
+// bookWithInvoice is the pay_with=invoice branch of POST /v1/rentals/book.
+func (h *Controller) bookWithInvoice(c echo.Context, uid, bookID int64, hold int, slotID int64) error {
+	email := payerEmailFrom(c)
+	if email == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "email missing in token"})
+	}
+	res, err := h.Svc.BookWithInvoice(c.Request().Context(), uid, bookID, email, hold, slotID)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			if h.Log != nil {
+				h.Log.Warn("book by invoice failed", "err", he, "user_id", uid, "book_id", bookID)
+			}
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusCreated, echo.Map{"message": "booked", "data": res})
+}
+
+// POST /v1/rentals/checkout
+func (h *Controller) Checkout(c echo.Context) error {
+	var req CheckoutReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid JSON"})
+	}
+	if err := h.V.Struct(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+	uid, ok := userIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"message": "unauthorized"})
+	}
+
+	hold := 0
+	if req.HoldMinutes != nil {
+		hold = *req.HoldMinutes
+	}
+	res, err := h.Svc.Checkout(c.Request().Context(), uid, req.BookIDs, hold, req.SlotID)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			if h.Log != nil {
+				h.Log.Warn("checkout failed", "err", he, "user_id", uid, "book_ids", req.BookIDs)
+			}
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusCreated, res)
+}
+
+// POST /v1/rentals/:id/pay
+func (h *Controller) Pay(c echo.Context) error {
+	rid, ok := rentalIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid rental id"})
+	}
+	uid, ok := userIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"message": "unauthorized"})
+	}
+
+	if err := h.Svc.Pay(c.Request().Context(), uid, rid); err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "paid"})
+}
+
+// POST /v1/rentals/:id/pickup  (admin)
+func (h *Controller) Pickup(c echo.Context) error {
+	rid, ok := rentalIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid rental id"})
+	}
+
+	if err := h.Svc.Pickup(c.Request().Context(), rid); err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "picked up"})
+}
+
+// POST /v1/rentals/:id/report  (admin)
+func (h *Controller) ReportCondition(c echo.Context) error {
+	rid, ok := rentalIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid rental id"})
+	}
+	var req ReportConditionReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid JSON"})
+	}
+	if err := h.V.Struct(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+
+	rc, err := h.Svc.ReportCondition(c.Request().Context(), rid, model.BookItemStatus(req.Condition), req.Charge)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, rc)
 }
 
 // POST /v1/rentals/:id/return
 func (h *Controller) Return(c echo.Context) error {
-	rid, err := strconv.ParseInt(c.Param("id"), 10, 64)
-	if err != nil || rid <= 0 {
+	rid, ok := rentalIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid rental id"})
+	}
+	uid, ok := userIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"message": "unauthorized"})
+	}
+
+	rc, err := h.Svc.Return(c.Request().Context(), uid, rid)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "returned", "overdue_days": rc.OverdueDays, "late_fee": rc.LateFee})
+}
+
+// POST /v1/rentals/:id/cancel
+func (h *Controller) Cancel(c echo.Context) error {
+	rid, ok := rentalIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid rental id"})
+	}
+	uid, ok := userIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"message": "unauthorized"})
+	}
+
+	rc, err := h.Svc.Cancel(c.Request().Context(), uid, rid)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "canceled", "refunded": rc.Refunded})
+}
+
+// POST /v1/rentals/:id/extend
+func (h *Controller) Extend(c echo.Context) error {
+	rid, ok := rentalIDFrom(c)
+	if !ok {
 		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid rental id"})
 	}
+	var req ExtendReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid JSON"})
+	}
+	if err := h.V.Struct(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
 	uid, ok := userIDFrom(c)
 	if !ok {
 		return c.JSON(http.StatusUnauthorized, echo.Map{"message": "unauthorized"})
 	}
 
-	if err := h.Svc.Return(c.Request().Context(), uid, rid); err != nil {
+	rc, err := h.Svc.Extend(c.Request().Context(), uid, rid, req.Days)
+	if err != nil {
 		if he, ok := err.(*echo.HTTPError); ok {
 			return he
 		}
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
 	}
-	return c.JSON(http.StatusOK, echo.Map{"message": "returned"})
+	return c.JSON(http.StatusOK, rc)
+}
+
+// POST /v1/rentals/waitlist
+func (h *Controller) JoinWaitlist(c echo.Context) error {
+	var req JoinWaitlistReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid JSON"})
+	}
+	if err := h.V.Struct(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+	uid, ok := userIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"message": "unauthorized"})
+	}
+
+	row, err := h.Svc.JoinWaitlist(c.Request().Context(), uid, req.BookID)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusCreated, row)
+}
+
+// GET /v1/rentals/waitlist
+func (h *Controller) MyWaitlist(c echo.Context) error {
+	uid, ok := userIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"message": "unauthorized"})
+	}
+	rows, err := h.Svc.MyWaitlist(c.Request().Context(), uid)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"data": rows})
+}
+
+// DELETE /v1/rentals/waitlist/:book_id
+func (h *Controller) LeaveWaitlist(c echo.Context) error {
+	bookID, err := strconv.ParseInt(c.Param("book_id"), 10, 64)
+	if err != nil || bookID <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid book id"})
+	}
+	uid, ok := userIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"message": "unauthorized"})
+	}
+
+	if err := h.Svc.LeaveWaitlist(c.Request().Context(), uid, bookID); err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "left waitlist"})
 }
 
 // GET /v1/rentals/my
@@ -91,3 +339,23 @@ func (h *Controller) MyHistory(c echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, rows)
 }
+
+// GET /v1/rentals/:id
+func (h *Controller) Detail(c echo.Context) error {
+	uid, ok := userIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"message": "unauthorized"})
+	}
+	rid, ok := rentalIDFrom(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid rental id"})
+	}
+	res, err := h.Svc.Detail(c.Request().Context(), uid, rid, isAdmin(c))
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -1,6 +1,63 @@
 package rental
 
+import (
+	"time"
+
+	"bookrental/model"
+)
+
 type BookWithDepositReq struct {
-	BookID      int64 `json:"book_id" validate:"required,gt=0"`
-	HoldMinutes *int  `json:"hold_minutes,omitempty" validate:"omitempty,min=0,max=1440"`
+	BookID      int64  `json:"book_id" validate:"required,gt=0"`
+	HoldMinutes *int   `json:"hold_minutes,omitempty" validate:"omitempty,min=0,max=1440"`
+	PayWith     string `json:"pay_with,omitempty" validate:"omitempty,oneof=deposit invoice"`
+	// Pickup slot from GET /v1/books/:id/pickup-slots; overrides hold_minutes.
+	SlotID int64 `json:"slot_id,omitempty" validate:"omitempty,gt=0"`
+}
+
+type CheckoutReq struct {
+	BookIDs     []int64 `json:"book_ids" validate:"required,min=1,max=10,unique,dive,gt=0"`
+	HoldMinutes *int    `json:"hold_minutes,omitempty" validate:"omitempty,min=0,max=1440"`
+	// Pickup slot for every book in the cart; overrides hold_minutes.
+	SlotID int64 `json:"slot_id,omitempty" validate:"omitempty,gt=0"`
+}
+
+type JoinWaitlistReq struct {
+	BookID int64 `json:"book_id" validate:"required,gt=0"`
+}
+
+type ReportConditionReq struct {
+	Condition string `json:"condition" validate:"required,oneof=LOST DAMAGED"`
+	// Overrides the book's replacement_cost when set.
+	Charge *model.Money `json:"charge,omitempty" validate:"omitempty,gte=0"`
+}
+
+type ExtendReq struct {
+	Days int `json:"days" validate:"required,gt=0"`
+}
+
+// AdminRentalQuery is the filter for GET /v1/admin/rentals.
+type AdminRentalQuery struct {
+	Status  string `query:"status" validate:"omitempty,oneof=BOOKED PAID ACTIVE RETURNED CANCELED LOST"`
+	UserID  int64  `query:"user_id" validate:"omitempty,gt=0"`
+	BookID  int64  `query:"book_id" validate:"omitempty,gt=0"`
+	Overdue bool   `query:"overdue"`
+	From    string `query:"from" validate:"omitempty,datetime=2006-01-02"`
+	To      string `query:"to" validate:"omitempty,datetime=2006-01-02"` // inclusive
+	Limit   int    `query:"limit" validate:"omitempty,min=1,max=200"`
+	Offset  int    `query:"offset" validate:"omitempty,min=0"`
+}
+
+type AdminActionReq struct {
+	Reason string `json:"reason" validate:"required,min=3,max=500"`
+}
+
+type RescheduleReq struct {
+	SlotID int64 `json:"slot_id" validate:"required,gt=0"`
+}
+
+type CreateSlotReq struct {
+	Branch   string    `json:"branch" validate:"required,max=64"`
+	StartsAt time.Time `json:"starts_at" validate:"required"`
+	EndsAt   time.Time `json:"ends_at" validate:"required,gtfield=StartsAt"`
+	Capacity int       `json:"capacity" validate:"required,gt=0"`
 }
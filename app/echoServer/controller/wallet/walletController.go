@@ -2,11 +2,18 @@ package wallet
 
 import (
 	"bookrental/service/wallet"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"bookrental/app/echoServer/jwtx"
+	"bookrental/model"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v5"
@@ -57,13 +64,364 @@ func (ct *Controller) CreateTopup(c echo.Context) error {
 	return c.JSON(http.StatusCreated, res)
 }
 
-// GET /v1/wallet/ledger
+// GET /v1/wallet/topups
+func (h *Controller) Topups(c echo.Context) error {
+	userID := c.Get("user_id").(int64)
+	rows, err := h.Svc.Topups(c.Request().Context(), userID)
+	if err != nil {
+		h.Log.Error("Topups failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"data": rows})
+}
+
+// GET /v1/wallet/topups/:id
+func (h *Controller) Topup(c echo.Context) error {
+	userID := c.Get("user_id").(int64)
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid topup id"})
+	}
+	t, err := h.Svc.Topup(c.Request().Context(), userID, id)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		h.Log.Error("Topup failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, t)
+}
+
+// GET /v1/wallet
+func (h *Controller) Summary(c echo.Context) error {
+	userID := c.Get("user_id").(int64)
+	sum, err := h.Svc.Summary(c.Request().Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, echo.Map{"message": "user not found"})
+		}
+		h.Log.Error("Summary failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, sum)
+}
+
+// GET /v1/wallet/ledger?entry_type=&ref_table=&from=&to=&cursor=&limit=
 func (h *Controller) Ledger(c echo.Context) error {
 	userID := c.Get("user_id").(int64)
-	rows, err := h.Svc.Ledger(c.Request().Context(), userID)
+	var q LedgerQuery
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &q); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid query"})
+	}
+	if err := h.V.Struct(q); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+
+	lq := wallet.LedgerQuery{
+		EntryType: q.EntryType,
+		RefTable:  q.RefTable,
+		Cursor:    q.Cursor,
+		Limit:     q.Limit,
+	}
+	if q.From != "" {
+		from, _ := time.Parse(time.DateOnly, q.From)
+		lq.From = &from
+	}
+	if q.To != "" {
+		to, _ := time.Parse(time.DateOnly, q.To)
+		to = to.AddDate(0, 0, 1)
+		lq.To = &to
+	}
+	if lq.From != nil && lq.To != nil && !lq.To.After(*lq.From) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "from must not be after to"})
+	}
+
+	page, err := h.Svc.Ledger(c.Request().Context(), userID, lq)
 	if err != nil {
 		h.Log.Error("Ledger failed", "err", err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
 	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// GET /v1/wallet/statements?month=YYYY-MM&format=csv|pdf
+func (h *Controller) Statement(c echo.Context) error {
+	userID := c.Get("user_id").(int64)
+	var q StatementQuery
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &q); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid query"})
+	}
+	if err := h.V.Struct(q); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+	month, _ := time.Parse("2006-01", q.Month)
+
+	st, err := h.Svc.Statement(c.Request().Context(), userID, month)
+	if err != nil {
+		h.Log.Error("Statement failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+
+	if q.Format == "pdf" {
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+st.Filename("pdf")+`"`)
+		return c.Blob(http.StatusOK, "application/pdf", st.PDF())
+	}
+	var buf bytes.Buffer
+	if err := st.WriteCSV(&buf); err != nil {
+		h.Log.Error("Statement csv failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+st.Filename("csv")+`"`)
+	return c.Blob(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// POST /v1/wallet/withdrawals
+func (h *Controller) Withdraw(c echo.Context) error {
+	userID := c.Get("user_id").(int64)
+	var req WithdrawReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid body"})
+	}
+	if err := h.V.Struct(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+
+	w, err := h.Svc.Withdraw(c.Request().Context(), userID, wallet.WithdrawReq{
+		Amount:        req.Amount,
+		BankCode:      req.BankCode,
+		AccountHolder: req.AccountHolder,
+		AccountNumber: req.AccountNumber,
+	})
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			h.Log.Warn("withdraw failed", "err", he, "user_id", userID)
+			return he
+		}
+		h.Log.Error("Withdraw failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusAccepted, w)
+}
+
+// GET /v1/wallet/withdrawals
+func (h *Controller) Withdrawals(c echo.Context) error {
+	userID := c.Get("user_id").(int64)
+	rows, err := h.Svc.Withdrawals(c.Request().Context(), userID)
+	if err != nil {
+		h.Log.Error("Withdrawals failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"data": rows})
+}
+
+// GET /v1/wallet/transfers/recipient?username=
+func (h *Controller) FindRecipient(c echo.Context) error {
+	var q RecipientQuery
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &q); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid query"})
+	}
+	if err := h.V.Struct(q); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+	rc, err := h.Svc.FindRecipient(c.Request().Context(), q.Username)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he
+		}
+		h.Log.Error("FindRecipient failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, rc)
+}
+
+// POST /v1/wallet/transfers
+func (h *Controller) Transfer(c echo.Context) error {
+	userID := c.Get("user_id").(int64)
+	var req TransferReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid body"})
+	}
+	if err := h.V.Struct(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+
+	t, err := h.Svc.Transfer(c.Request().Context(), userID, wallet.TransferReq{
+		ToUsername: req.ToUsername,
+		Amount:     req.Amount,
+		Note:       req.Note,
+	})
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			h.Log.Warn("transfer failed", "err", he, "user_id", userID)
+			return he
+		}
+		h.Log.Error("Transfer failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusCreated, t)
+}
+
+// GET /v1/wallet/transfers
+func (h *Controller) Transfers(c echo.Context) error {
+	userID := c.Get("user_id").(int64)
+	rows, err := h.Svc.Transfers(c.Request().Context(), userID)
+	if err != nil {
+		h.Log.Error("Transfers failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"data": rows})
+}
+
+// POST /v1/wallet/vouchers/redeem
+func (h *Controller) Redeem(c echo.Context) error {
+	userID := c.Get("user_id").(int64)
+	var req RedeemReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid body"})
+	}
+	if err := h.V.Struct(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+	rd, err := h.Svc.Redeem(c.Request().Context(), userID, req.Code)
+	if err != nil {
+		if he, ok := err.(*echo.HTTPError); ok {
+			h.Log.Warn("redeem failed", "err", he, "user_id", userID)
+			return he
+		}
+		h.Log.Error("Redeem failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, rd)
+}
+
+// POST /v1/admin/wallet/vouchers  (admin)
+func (h *Controller) CreateVoucher(c echo.Context) error {
+	adminID := c.Get("user_id").(int64)
+	var req CreateVoucherReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid body"})
+	}
+	if err := h.V.Struct(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+	v, err := h.Svc.CreateVoucher(c.Request().Context(), adminID, wallet.VoucherReq{
+		Code:         req.Code,
+		Kind:         model.VoucherKind(req.Kind),
+		Amount:       req.Amount,
+		Percent:      req.Percent,
+		MinTopup:     req.MinTopup,
+		StartsAt:     req.StartsAt,
+		ExpiresAt:    req.ExpiresAt,
+		MaxUses:      req.MaxUses,
+		PerUserLimit: req.PerUserLimit,
+	})
+	if err != nil {
+		return h.adminError(c, "create voucher", err, adminID)
+	}
+	h.Log.Info("admin create voucher", "admin_id", adminID, "voucher_id", v.ID, "code", v.Code, "kind", v.Kind)
+	return c.JSON(http.StatusCreated, v)
+}
+
+// GET /v1/admin/wallet/vouchers  (admin)
+func (h *Controller) Vouchers(c echo.Context) error {
+	rows, err := h.Svc.Vouchers(c.Request().Context())
+	if err != nil {
+		h.Log.Error("Vouchers failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"data": rows})
+}
+
+// POST /v1/admin/wallet/adjustments  (admin)
+func (h *Controller) Adjust(c echo.Context) error {
+	adminID := c.Get("user_id").(int64)
+	var req AdjustReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid body"})
+	}
+	if err := h.V.Struct(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+
+	adj, err := h.Svc.Adjust(c.Request().Context(), adminID, wallet.AdjustReq{
+		UserID: req.UserID,
+		Amount: req.Amount,
+		Reason: req.Reason,
+	})
+	if err != nil {
+		return h.adminError(c, "adjust", err, adminID)
+	}
+	h.Log.Info("admin wallet adjustment", "admin_id", adminID, "adjustment_id", adj.ID,
+		"user_id", adj.UserID, "amount", adj.Amount.String(), "status", adj.Status, "reason", adj.Reason)
+	if adj.Status == model.AdjustmentPending {
+		return c.JSON(http.StatusAccepted, adj)
+	}
+	return c.JSON(http.StatusCreated, adj)
+}
+
+// GET /v1/admin/wallet/adjustments?status=  (admin)
+func (h *Controller) Adjustments(c echo.Context) error {
+	var q AdjustmentQuery
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &q); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid query"})
+	}
+	if err := h.V.Struct(q); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "validation error", "errors": err.Error()})
+	}
+	rows, err := h.Svc.Adjustments(c.Request().Context(), model.AdjustmentStatus(q.Status))
+	if err != nil {
+		h.Log.Error("Adjustments failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
 	return c.JSON(http.StatusOK, echo.Map{"data": rows})
 }
+
+// POST /v1/admin/wallet/adjustments/:id/approve  (admin)
+func (h *Controller) ApproveAdjustment(c echo.Context) error {
+	return h.decideAdjustment(c, "approve", h.Svc.ApproveAdjustment)
+}
+
+// POST /v1/admin/wallet/adjustments/:id/reject  (admin)
+func (h *Controller) RejectAdjustment(c echo.Context) error {
+	return h.decideAdjustment(c, "reject", h.Svc.RejectAdjustment)
+}
+
+func (h *Controller) decideAdjustment(c echo.Context, name string,
+	decide func(ctx context.Context, adminID, adjustmentID int64) (*model.WalletAdjustment, error)) error {
+	adminID := c.Get("user_id").(int64)
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "invalid adjustment id"})
+	}
+	adj, err := decide(c.Request().Context(), adminID, id)
+	if err != nil {
+		return h.adminError(c, name+" adjustment", err, adminID)
+	}
+	h.Log.Info("admin "+name+" adjustment", "admin_id", adminID, "adjustment_id", adj.ID)
+	return c.JSON(http.StatusOK, adj)
+}
+
+func (h *Controller) adminError(c echo.Context, name string, err error, adminID int64) error {
+	if he, ok := err.(*echo.HTTPError); ok {
+		h.Log.Warn("admin "+name+" failed", "err", he, "admin_id", adminID)
+		return he
+	}
+	h.Log.Error("admin "+name+" failed", "err", err)
+	return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+}
+
+// GET /v1/admin/wallet/verify  (admin)
+func (h *Controller) VerifyJournal(c echo.Context) error {
+	rep, err := h.Svc.VerifyJournal(c.Request().Context())
+	if err != nil {
+		h.Log.Error("VerifyJournal failed", "err", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "internal error"})
+	}
+	if !rep.OK {
+		h.Log.Warn("journal verification found discrepancies",
+			"unbalanced", len(rep.Unbalanced), "unposted", len(rep.Unposted),
+			"mismatches", len(rep.Mismatches), "drift", len(rep.Drift))
+	}
+	return c.JSON(http.StatusOK, rep)
+}
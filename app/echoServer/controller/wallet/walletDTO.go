@@ -1,5 +1,74 @@
 package wallet
 
+import (
+	"time"
+
+	"bookrental/model"
+)
+
+// LedgerQuery is the filter for GET /v1/wallet/ledger.
+type LedgerQuery struct {
+	EntryType string `query:"entry_type" validate:"omitempty,oneof=TOPUP_CONFIRMED RENTAL_CHARGE RENTAL_REFUND ADJUSTMENT LATE_FEE REPLACEMENT_CHARGE FEE_WAIVER WITHDRAWAL WITHDRAWAL_REVERSAL TRANSFER_OUT TRANSFER_IN VOUCHER_CREDIT TOPUP_BONUS"`
+	RefTable  string `query:"ref_table" validate:"omitempty,oneof=rentals wallet_topups wallet_withdrawals wallet_adjustments wallet_transfers voucher_redemptions"`
+	From      string `query:"from" validate:"omitempty,datetime=2006-01-02"`
+	To        string `query:"to" validate:"omitempty,datetime=2006-01-02"` // inclusive
+	Cursor    int64  `query:"cursor" validate:"omitempty,gt=0"`
+	Limit     int    `query:"limit" validate:"omitempty,min=1,max=200"`
+}
+
 type CreateTopupReq struct {
-	Amount float64 `json:"amount" validate:"required,gt=0"`
+	Amount model.Money `json:"amount" validate:"required,gt=0"`
+}
+
+// StatementQuery is the filter for GET /v1/wallet/statements.
+type StatementQuery struct {
+	Month  string `query:"month" validate:"required,datetime=2006-01"`
+	Format string `query:"format" validate:"omitempty,oneof=csv pdf"`
+}
+
+type WithdrawReq struct {
+	Amount        model.Money `json:"amount" validate:"required,gt=0"`
+	BankCode      string      `json:"bank_code" validate:"required,max=32"`
+	AccountHolder string      `json:"account_holder_name" validate:"required,max=100"`
+	AccountNumber string      `json:"account_number" validate:"required,numeric,min=5,max=34"`
+}
+
+// AdjustReq is a manual credit (positive amount) or debit (negative).
+type AdjustReq struct {
+	UserID int64       `json:"user_id" validate:"required,gt=0"`
+	Amount model.Money `json:"amount" validate:"required"`
+	Reason string      `json:"reason" validate:"required,min=3,max=500"`
+}
+
+// AdjustmentQuery is the filter for GET /v1/admin/wallet/adjustments.
+type AdjustmentQuery struct {
+	Status string `query:"status" validate:"omitempty,oneof=PENDING_APPROVAL APPLIED REJECTED"`
+}
+
+type TransferReq struct {
+	ToUsername string      `json:"to_username" validate:"required,max=100"`
+	Amount     model.Money `json:"amount" validate:"required,gt=0"`
+	Note       string      `json:"note" validate:"max=200"`
+}
+
+// RecipientQuery is the lookup for GET /v1/wallet/transfers/recipient.
+type RecipientQuery struct {
+	Username string `query:"username" validate:"required,max=100"`
+}
+
+type RedeemReq struct {
+	Code string `json:"code" validate:"required,max=64"`
+}
+
+// CreateVoucherReq is a new promo code. Times are RFC 3339.
+type CreateVoucherReq struct {
+	Code         string      `json:"code" validate:"required,alphanum,max=64"`
+	Kind         string      `json:"kind" validate:"required,oneof=CREDIT TOPUP_BONUS"`
+	Amount       model.Money `json:"amount" validate:"required,gt=0"`
+	Percent      int         `json:"percent" validate:"min=0,max=100"`
+	MinTopup     model.Money `json:"min_topup" validate:"min=0"`
+	StartsAt     *time.Time  `json:"starts_at"`
+	ExpiresAt    *time.Time  `json:"expires_at"`
+	MaxUses      int         `json:"max_uses" validate:"min=0"`
+	PerUserLimit int         `json:"per_user_limit" validate:"min=0"`
 }
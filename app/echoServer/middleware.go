@@ -61,3 +61,19 @@ func JWTAuth(secret string) echo.MiddlewareFunc {
 		}
 	}
 }
+
+// RequireRole lets the request through only when the auth middleware put one
+// of roles in the context.
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, _ := c.Get("role").(string)
+			for _, r := range roles {
+				if role == r {
+					return next(c)
+				}
+			}
+			return c.JSON(403, echo.Map{"message": "forbidden"})
+		}
+	}
+}
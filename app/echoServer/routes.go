@@ -31,6 +31,7 @@ func Register(e *echo.Echo, c C) {
 
 	// payment
 	pub.POST("/payment/xendit", c.Payment.HandleXendit)
+	pub.POST("/payment/xendit/disbursement", c.Payment.HandleDisbursement)
 
 	// Auth
 	auth := e.Group("/v1")
@@ -72,6 +73,9 @@ func Register(e *echo.Echo, c C) {
 			}
 
 			ctx.Set("user_id", uid)
+			if role, ok := claims["role"].(string); ok {
+				ctx.Set("role", role)
+			}
 			ctx.Logger().Infof("[AUTH] uid=%d claims=%v", uid, claims)
 			ctx.Logger().Infof("[AUTH] verified user_id=%d req_id=%s ip=%s", uid, reqID, ctx.RealIP())
 			return next(ctx)
@@ -81,15 +85,57 @@ func Register(e *echo.Echo, c C) {
 	// Books
 	auth.GET("/books", c.Book.List)
 	auth.GET("/books/:id", c.Book.Detail)
+	auth.GET("/books/:id/pickup-slots", c.Rental.FreeSlots)
 	// Admin endpoints
 	auth.POST("/books", c.Book.Create)
 	auth.POST("/books/:id/copies", c.Book.AddCopies)
 
 	// Wallet
+	auth.GET("/wallet", c.Wallet.Summary)
 	auth.POST("/wallet/topups", c.Wallet.CreateTopup) // returns payment link
-	auth.GET("/wallet/ledger", c.Wallet.Ledger)       // list ledger
+	auth.GET("/wallet/topups", c.Wallet.Topups)
+	auth.GET("/wallet/topups/:id", c.Wallet.Topup) // poll status
+	auth.GET("/wallet/ledger", c.Wallet.Ledger)    // list ledger
+	auth.GET("/wallet/statements", c.Wallet.Statement)
+	auth.POST("/wallet/withdrawals", c.Wallet.Withdraw)
+	auth.GET("/wallet/withdrawals", c.Wallet.Withdrawals)
+	auth.POST("/wallet/transfers", c.Wallet.Transfer)
+	auth.GET("/wallet/transfers", c.Wallet.Transfers)
+	auth.GET("/wallet/transfers/recipient", c.Wallet.FindRecipient)
+	auth.POST("/wallet/vouchers/redeem", c.Wallet.Redeem)
 
 	auth.POST("/rentals/book", c.Rental.BookWithDeposit)
+	auth.POST("/rentals/checkout", c.Rental.Checkout)
+	auth.POST("/rentals/:id/pay", c.Rental.Pay)
+	auth.POST("/rentals/:id/pickup", c.Rental.Pickup, RequireRole("admin"))
 	auth.POST("/rentals/:id/return", c.Rental.Return)
+	auth.POST("/rentals/:id/report", c.Rental.ReportCondition, RequireRole("admin"))
+	auth.POST("/rentals/:id/extend", c.Rental.Extend)
+	auth.POST("/rentals/:id/cancel", c.Rental.Cancel)
+	auth.POST("/rentals/:id/reschedule", c.Rental.Reschedule)
 	auth.GET("/rentals/my", c.Rental.MyHistory)
+	auth.GET("/rentals/:id", c.Rental.Detail) // owner or admin
+
+	auth.POST("/rentals/waitlist", c.Rental.JoinWaitlist)
+	auth.GET("/rentals/waitlist", c.Rental.MyWaitlist)
+	auth.DELETE("/rentals/waitlist/:book_id", c.Rental.LeaveWaitlist)
+
+	// Admin console
+	admin := auth.Group("/admin", RequireRole("admin"))
+	admin.GET("/rentals", c.Rental.AdminList)
+	admin.POST("/rentals/:id/force-return", c.Rental.ForceReturn)
+	admin.POST("/rentals/:id/force-cancel", c.Rental.ForceCancel)
+	admin.POST("/rentals/:id/waive-fees", c.Rental.WaiveFees)
+	admin.POST("/pickup-slots", c.Rental.CreateSlot)
+	admin.GET("/wallet/verify", c.Wallet.VerifyJournal)
+	admin.GET("/payments/reconcile", c.Payment.LastReconcile)
+	admin.POST("/payments/reconcile", c.Payment.Reconcile)
+	admin.GET("/payments/events", c.Payment.Events)
+	admin.POST("/payments/events/:id/replay", c.Payment.ReplayEvent)
+	admin.POST("/wallet/vouchers", c.Wallet.CreateVoucher)
+	admin.GET("/wallet/vouchers", c.Wallet.Vouchers)
+	admin.POST("/wallet/adjustments", c.Wallet.Adjust)
+	admin.GET("/wallet/adjustments", c.Wallet.Adjustments)
+	admin.POST("/wallet/adjustments/:id/approve", c.Wallet.ApproveAdjustment)
+	admin.POST("/wallet/adjustments/:id/reject", c.Wallet.RejectAdjustment)
 }
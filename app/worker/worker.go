@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Job does one unit of background work and reports how many rows it touched.
+type Job func(ctx context.Context) (int, error)
+
+// Run calls job every interval until ctx is done. Errors are logged and the
+// loop keeps going; a failed tick is simply retried on the next one.
+func Run(ctx context.Context, log *slog.Logger, name string, every time.Duration, job Job) {
+	if every <= 0 {
+		log.Warn("worker disabled", "worker", name)
+		return
+	}
+	log.Info("worker started", "worker", name, "every", every.String())
+
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("worker stopped", "worker", name)
+			return
+		case <-t.C:
+			n, err := job(ctx)
+			if err != nil {
+				log.Error("worker tick failed", "worker", name, "err", err)
+				continue
+			}
+			if n > 0 {
+				log.Info("worker tick", "worker", name, "processed", n)
+			}
+		}
+	}
+}
@@ -1,9 +1,45 @@
 package config
 
+import (
+	"time"
+
+	"bookrental/model"
+)
+
 type App struct {
 	Port         string `env:"APP_PORT" default:"8080"`
 	DatabaseURL  string `env:"DATABASE_URL,required"`
 	JWTSecret    string `env:"JWT_SECRET,required"`
 	ApiNinjasKey string `env:"API_NINJAS_KEY"`
 	Env          string `env:"APP_ENV" default:"dev"`
+
+	HoldSweepInterval time.Duration `env:"HOLD_SWEEP_INTERVAL" default:"1m"`
+
+	TopupExpiryInterval time.Duration `env:"TOPUP_EXPIRY_INTERVAL" default:"5m"`
+	TopupExpiryGrace    time.Duration `env:"TOPUP_EXPIRY_GRACE" default:"10m"`
+
+	WithdrawalRetryInterval time.Duration `env:"WITHDRAWAL_RETRY_INTERVAL" default:"2m"`
+
+	RentalMaxRenewals   int `env:"RENTAL_MAX_RENEWALS" default:"2"`
+	RentalMaxExtendDays int `env:"RENTAL_MAX_EXTEND_DAYS" default:"14"`
+
+	WaitlistHold time.Duration `env:"WAITLIST_HOLD" default:"24h"`
+
+	CancelRefundPolicy  string `env:"CANCEL_REFUND_POLICY" default:"full"` // full | partial | none
+	CancelRefundPercent int    `env:"CANCEL_REFUND_PERCENT" default:"50"`
+
+	RentalMaxConcurrent  int            `env:"RENTAL_MAX_CONCURRENT" default:"5"` // 0 = unlimited
+	RentalCategoryLimits map[string]int `env:"RENTAL_CATEGORY_LIMITS"`            // e.g. "comics=3,textbook=1"
+	RentalMinAccountAge  time.Duration  `env:"RENTAL_MIN_ACCOUNT_AGE" default:"0s"`
+
+	WalletAdjustApprovalOver model.Money `env:"WALLET_ADJUST_APPROVAL_OVER" default:"0"`       // 0 = no second approval
+	WalletTransferDailyLimit model.Money `env:"WALLET_TRANSFER_DAILY_LIMIT" default:"1000000"` // 0 = unlimited
+
+	ReconcileInterval time.Duration `env:"RECONCILE_INTERVAL" default:"15m"`
+	ReconcileMinAge   time.Duration `env:"RECONCILE_MIN_AGE" default:"15m"`
+	ReconcileLookback time.Duration `env:"RECONCILE_LOOKBACK" default:"72h"`
+
+	PaymentProvider             string        `env:"PAYMENT_PROVIDER" default:"xendit"` // xendit | fake
+	FakeDisbursementCallbackURL string        `env:"FAKE_DISBURSEMENT_CALLBACK_URL"`    // e.g. http://localhost:8080/v1/payment/xendit/disbursement
+	FakeDisbursementDelay       time.Duration `env:"FAKE_DISBURSEMENT_DELAY" default:"5s"`
 }
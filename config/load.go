@@ -3,6 +3,11 @@ package config
 import (
 	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"bookrental/model"
 )
 
 func Load() App {
@@ -12,6 +17,36 @@ func Load() App {
 		JWTSecret:    getenv("JWT_SECRET", "local_dev_secret"),
 		ApiNinjasKey: os.Getenv("API_NINJAS_KEY"),
 		Env:          getenv("APP_ENV", "dev"),
+
+		HoldSweepInterval: getenvDuration("HOLD_SWEEP_INTERVAL", time.Minute),
+
+		TopupExpiryInterval: getenvDuration("TOPUP_EXPIRY_INTERVAL", 5*time.Minute),
+		TopupExpiryGrace:    getenvDuration("TOPUP_EXPIRY_GRACE", 10*time.Minute),
+
+		WithdrawalRetryInterval: getenvDuration("WITHDRAWAL_RETRY_INTERVAL", 2*time.Minute),
+
+		RentalMaxRenewals:   getenvInt("RENTAL_MAX_RENEWALS", 2),
+		RentalMaxExtendDays: getenvInt("RENTAL_MAX_EXTEND_DAYS", 14),
+
+		WaitlistHold: getenvDuration("WAITLIST_HOLD", 24*time.Hour),
+
+		CancelRefundPolicy:  getenv("CANCEL_REFUND_POLICY", "full"),
+		CancelRefundPercent: getenvInt("CANCEL_REFUND_PERCENT", 50),
+
+		RentalMaxConcurrent:  getenvInt("RENTAL_MAX_CONCURRENT", 5),
+		RentalCategoryLimits: getenvLimits("RENTAL_CATEGORY_LIMITS"),
+		RentalMinAccountAge:  getenvDuration("RENTAL_MIN_ACCOUNT_AGE", 0),
+
+		WalletAdjustApprovalOver: getenvMoney("WALLET_ADJUST_APPROVAL_OVER", 0),
+		WalletTransferDailyLimit: getenvMoney("WALLET_TRANSFER_DAILY_LIMIT", model.Units(1000000)),
+
+		ReconcileInterval: getenvDuration("RECONCILE_INTERVAL", 15*time.Minute),
+		ReconcileMinAge:   getenvDuration("RECONCILE_MIN_AGE", 15*time.Minute),
+		ReconcileLookback: getenvDuration("RECONCILE_LOOKBACK", 72*time.Hour),
+
+		PaymentProvider:             getenv("PAYMENT_PROVIDER", "xendit"),
+		FakeDisbursementCallbackURL: os.Getenv("FAKE_DISBURSEMENT_CALLBACK_URL"),
+		FakeDisbursementDelay:       getenvDuration("FAKE_DISBURSEMENT_DELAY", 5*time.Second),
 	}
 	return cfg
 }
@@ -23,6 +58,63 @@ func getenv(k, def string) string {
 	return def
 }
 
+func getenvInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Warn("bad int env, using default", "key", k, "value", v)
+		return def
+	}
+	return n
+}
+
+func getenvDuration(k string, def time.Duration) time.Duration {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		slog.Warn("bad duration env, using default", "key", k, "value", v)
+		return def
+	}
+	return d
+}
+
+func getenvMoney(k string, def model.Money) model.Money {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	m, err := model.ParseMoney(v)
+	if err != nil {
+		slog.Warn("bad money env, using default", "key", k, "value", v)
+		return def
+	}
+	return m
+}
+
+// getenvLimits parses "name=n,name=n" pairs; malformed pairs are skipped.
+func getenvLimits(k string) map[string]int {
+	out := map[string]int{}
+	for _, pair := range strings.Split(os.Getenv(k), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, num, ok := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(num))
+		if !ok || err != nil || strings.TrimSpace(name) == "" {
+			slog.Warn("bad limit in env, skipping", "key", k, "pair", pair)
+			continue
+		}
+		out[strings.TrimSpace(name)] = n
+	}
+	return out
+}
+
 func must(k string) string {
 	v := os.Getenv(k)
 	if v == "" {
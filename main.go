@@ -21,14 +21,17 @@ import (
 	rentalctrl "bookrental/app/echoServer/controller/rental"
 	walletctrl "bookrental/app/echoServer/controller/wallet"
 	"bookrental/app/echoServer/validation"
+	"bookrental/app/worker"
 	"bookrental/config"
 	authrepo "bookrental/repository/auth"
 	bookrepo "bookrental/repository/book"
+	paymentrepo "bookrental/repository/payment"
 	rentalrepo "bookrental/repository/rental"
 	walletrepo "bookrental/repository/wallet"
 	xenditrepo "bookrental/repository/xendit"
 	authsvc "bookrental/service/auth"
 	booksvc "bookrental/service/book"
+	"bookrental/service/notify"
 	paymentsvc "bookrental/service/payment"
 	rentalsvc "bookrental/service/rental"
 	walletsvc "bookrental/service/wallet"
@@ -63,14 +66,51 @@ func main() {
 	br := bookrepo.New(db)
 	rr := rentalrepo.New(db)
 	wr := walletrepo.New(db)
-	xr := xenditrepo.NewHTTP(os.Getenv("XENDIT_API_KEY"))
+	pr := paymentrepo.New(db)
+	var xr xenditrepo.Repo
+	if cfg.PaymentProvider == "fake" {
+		log.Warn("using fake payment provider")
+		xr = xenditrepo.NewFake(os.Getenv("XENDIT_CALLBACK_TOKEN"), cfg.FakeDisbursementCallbackURL, cfg.FakeDisbursementDelay, log)
+	} else {
+		xr = xenditrepo.NewHTTP(os.Getenv("XENDIT_API_KEY"))
+	}
 
 	// services
 	as := authsvc.New(ar, cfg.JWTSecret)
-	bs := booksvc.New(br)
-	rs := rentalsvc.New(db, rr, wr)
-	ws := walletsvc.New(db, wr, xr)
-	whs := paymentsvc.New(db, xr, wr)
+	rs := rentalsvc.New(db, rr, wr, xr, notify.NewLog(log), rentalsvc.Config{
+		MaxRenewals:   cfg.RentalMaxRenewals,
+		MaxExtendDays: cfg.RentalMaxExtendDays,
+		WaitlistHold:  cfg.WaitlistHold,
+
+		CancelRefund:        rentalsvc.RefundPolicy(cfg.CancelRefundPolicy),
+		CancelRefundPercent: cfg.CancelRefundPercent,
+
+		Rules: []rentalsvc.Rule{
+			rentalsvc.MaxConcurrent(cfg.RentalMaxConcurrent),
+			rentalsvc.NoOverdue(),
+			rentalsvc.NoDebt(),
+			rentalsvc.CategoryLimits(cfg.RentalCategoryLimits),
+			rentalsvc.MinAccountAge(cfg.RentalMinAccountAge),
+		},
+	})
+	bs := booksvc.New(br, rs)
+	ws := walletsvc.New(db, wr, xr, walletsvc.Config{
+		AdjustApprovalOver: cfg.WalletAdjustApprovalOver,
+		TransferDailyLimit: cfg.WalletTransferDailyLimit,
+		TopupExpiryGrace:   cfg.TopupExpiryGrace,
+	})
+	whs := paymentsvc.New(xr, wr, pr, rs, ws, paymentsvc.Config{
+		ReconcileMinAge:   cfg.ReconcileMinAge,
+		ReconcileLookback: cfg.ReconcileLookback,
+	})
+
+	// background workers
+	workerCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
+	go worker.Run(workerCtx, log, "hold-sweeper", cfg.HoldSweepInterval, rs.ExpireHolds)
+	go worker.Run(workerCtx, log, "topup-expiry", cfg.TopupExpiryInterval, ws.ExpireTopups)
+	go worker.Run(workerCtx, log, "withdrawal-retry", cfg.WithdrawalRetryInterval, ws.RetryWithdrawals)
+	go worker.Run(workerCtx, log, "topup-reconcile", cfg.ReconcileInterval, whs.ReconcileTopups)
 
 	// controllers
 	v := validator.New()
@@ -78,7 +118,7 @@ func main() {
 	bookC := &bookctrl.Controller{Svc: bs, V: v, Log: log}
 	rentalC := &rentalctrl.Controller{Svc: rs, V: v, Log: log}
 	walletC := &walletctrl.Controller{Svc: ws, V: v, Log: log}
-	paymentC := &paymentctrl.Controller{Svc: whs, Log: log}
+	paymentC := &paymentctrl.Controller{Svc: whs, V: v, Log: log}
 
 	// echo
 	e := echo.New()
@@ -4,11 +4,15 @@ package model
 import "time"
 
 type Book struct {
-	ID                int64   `json:"id"`
-	Name              string  `json:"name"`
-	Category          string  `json:"category"`
-	RentalCost        float64 `json:"rental_cost"`
-	StockAvailability int64   `json:"stock_availability"`
+	ID                int64  `json:"id"`
+	Name              string `json:"name"`
+	Category          string `json:"category"`
+	RentalCost        Money  `json:"rental_cost"`
+	RentalDays        int    `json:"rental_days"`
+	LateFeePerDay     Money  `json:"late_fee_per_day"`
+	ReplacementCost   Money  `json:"replacement_cost"`
+	TotalCopies       int64  `json:"total_copies"`
+	StockAvailability int64  `json:"stock_availability"`
 }
 
 type BookItemStatus string
@@ -17,11 +21,14 @@ const (
 	ItemAvailable BookItemStatus = "AVAILABLE"
 	ItemBooked    BookItemStatus = "BOOKED"
 	ItemRented    BookItemStatus = "RENTED"
+	ItemLost      BookItemStatus = "LOST"
+	ItemDamaged   BookItemStatus = "DAMAGED"
 )
 
 type BookItem struct {
 	ID          int64          `json:"id"`
 	BookID      int64          `json:"book_id"`
 	Status      BookItemStatus `json:"status"`
+	Branch      string         `json:"branch"`
 	BookedUntil *time.Time     `json:"booked_until,omitempty"`
 }
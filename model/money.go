@@ -0,0 +1,152 @@
+// model/money.go
+package model
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount in hundredths of the currency unit, the same
+// precision as the NUMERIC(18,2) columns. Every price, balance and ledger
+// amount uses it so sums and balance_after never pick up float rounding.
+type Money int64
+
+// ErrBadMoney is returned for amounts that are not plain decimals with at
+// most two fractional digits.
+var ErrBadMoney = errors.New("invalid money amount")
+
+// maxMoneyDigits keeps parsed amounts inside NUMERIC(18,2) and int64.
+const maxMoneyDigits = 16
+
+// Units returns n whole currency units.
+func Units(n int64) Money { return Money(n * 100) }
+
+// ParseMoney reads "12", "12.5", "-12.50" and the like. Digits past the
+// second decimal are only accepted when they are zeros.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || len(whole) > maxMoneyDigits || !digits(whole) || !digits(frac) {
+		return 0, fmt.Errorf("%w: %q", ErrBadMoney, s)
+	}
+	if len(frac) > 2 {
+		if strings.Trim(frac[2:], "0") != "" {
+			return 0, fmt.Errorf("%w: %q has more than 2 decimals", ErrBadMoney, s)
+		}
+		frac = frac[:2]
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+
+	var n int64
+	for _, c := range whole + frac {
+		n = n*10 + int64(c-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return Money(n), nil
+}
+
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats m with exactly two decimals, e.g. "-1250.05".
+func (m Money) String() string {
+	n := int64(m)
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, n/100, n%100)
+}
+
+// MulInt returns m*n.
+func (m Money) MulInt(n int) Money { return m * Money(n) }
+
+// MulDiv returns m*num/den rounded half away from zero.
+func (m Money) MulDiv(num, den int64) Money {
+	if den == 0 {
+		return 0
+	}
+	p := int64(m) * num
+	q, r := p/den, p%den
+	if r != 0 && 2*abs64(r) >= abs64(den) {
+		if (p < 0) != (den < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Money(q)
+}
+
+// Percent returns p percent of m, rounded to the cent.
+func (m Money) Percent(p int) Money { return m.MulDiv(int64(p), 100) }
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Scan implements sql.Scanner. Postgres sends NUMERIC as text.
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		return m.parse(string(v))
+	case string:
+		return m.parse(v)
+	case int64:
+		*m = Units(v)
+		return nil
+	case float64:
+		*m = Money(math.Round(v * 100))
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+}
+
+func (m *Money) parse(s string) error {
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Value implements driver.Valuer; the decimal string keeps NUMERIC exact.
+func (m Money) Value() (driver.Value, error) { return m.String(), nil }
+
+// MarshalJSON writes m as a JSON number with two decimals.
+func (m Money) MarshalJSON() ([]byte, error) { return []byte(m.String()), nil }
+
+// UnmarshalJSON accepts a JSON number or a numeric string.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if uq, err := strconv.Unquote(s); err == nil {
+		s = uq
+	}
+	return m.parse(s)
+}
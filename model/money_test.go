@@ -0,0 +1,163 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		in   string
+		want Money
+	}{
+		{"12", 1200},
+		{"12.5", 1250},
+		{"12.50", 1250},
+		{".5", 50},
+		{"5.", 500},
+		{"-12.05", -1205},
+		{"-.5", -50},
+		{"+3", 300},
+		{" 7.25 ", 725},
+		{"1.2500", 125},
+		{"0.00", 0},
+		{strings.Repeat("9", maxMoneyDigits) + ".99", 999999999999999999},
+	}
+	for _, c := range cases {
+		got, err := ParseMoney(c.in)
+		if err != nil || got != c.want {
+			t.Errorf("ParseMoney(%q) = %d, %v; want %d", c.in, got, err, c.want)
+		}
+	}
+}
+
+func TestParseMoneyRejects(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"-",
+		".",
+		"abc",
+		"1.2.3",
+		"1,50",
+		"12.345",
+		"12.3401",
+		"1e3",
+		strings.Repeat("9", maxMoneyDigits+1),
+	} {
+		if got, err := ParseMoney(in); !errors.Is(err, ErrBadMoney) {
+			t.Errorf("ParseMoney(%q) = %d, %v; want ErrBadMoney", in, got, err)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	cases := map[Money]string{
+		0:      "0.00",
+		5:      "0.05",
+		1250:   "12.50",
+		-5:     "-0.05",
+		-12505: "-125.05",
+	}
+	for m, want := range cases {
+		if got := m.String(); got != want {
+			t.Errorf("Money(%d).String() = %q; want %q", int64(m), got, want)
+		}
+	}
+}
+
+func TestMulDivRoundsHalfAwayFromZero(t *testing.T) {
+	cases := []struct {
+		m        Money
+		num, den int64
+		want     Money
+	}{
+		{1000, 1, 3, 333},
+		{1000, 2, 3, 667},
+		{5, 1, 2, 3},
+		{-5, 1, 2, -3},
+		{5, -1, 2, -3},
+		{-5, -1, 2, 3},
+		{-1000, 2, 3, -667},
+		{-1000, 1, 3, -333},
+		{7, 1, -2, -4},
+		{100, 1, 0, 0},
+	}
+	for _, c := range cases {
+		if got := c.m.MulDiv(c.num, c.den); got != c.want {
+			t.Errorf("Money(%d).MulDiv(%d, %d) = %d; want %d", int64(c.m), c.num, c.den, got, c.want)
+		}
+	}
+	if got := Money(-1999).Percent(50); got != -1000 {
+		t.Errorf("Percent(50) of -19.99 = %v; want -10.00", got)
+	}
+}
+
+func TestMoneyScanValue(t *testing.T) {
+	cases := []struct {
+		src  any
+		want Money
+	}{
+		{nil, 0},
+		{[]byte("12.34"), 1234},
+		{"-0.50", -50},
+		{int64(3), 300},
+		{float64(19.99), 1999},
+	}
+	for _, c := range cases {
+		m := Money(777)
+		if err := m.Scan(c.src); err != nil || m != c.want {
+			t.Errorf("Scan(%#v) = %d, %v; want %d", c.src, m, err, c.want)
+		}
+	}
+
+	var m Money
+	if err := m.Scan(true); err == nil {
+		t.Error("Scan(bool) succeeded; want an error")
+	}
+	if err := m.Scan("1.234"); !errors.Is(err, ErrBadMoney) {
+		t.Errorf("Scan(1.234) = %v; want ErrBadMoney", err)
+	}
+
+	v, err := Money(-1205).Value()
+	if err != nil || v != "-12.05" {
+		t.Errorf("Value() = %v, %v; want \"-12.05\"", v, err)
+	}
+	var back Money
+	if err := back.Scan(v); err != nil || back != -1205 {
+		t.Errorf("Scan(Value()) = %d, %v; want -1205", back, err)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	b, err := json.Marshal(struct {
+		A Money `json:"a"`
+	}{-1250})
+	if err != nil || string(b) != `{"a":-12.50}` {
+		t.Errorf("Marshal = %s, %v; want {\"a\":-12.50}", b, err)
+	}
+
+	cases := []struct {
+		in   string
+		want Money
+	}{
+		{`12.5`, 1250},
+		{`"12.5"`, 1250},
+		{`-3`, -300},
+		{`"-3.00"`, -300},
+		{`null`, 42},
+	}
+	for _, c := range cases {
+		m := Money(42)
+		if err := json.Unmarshal([]byte(c.in), &m); err != nil || m != c.want {
+			t.Errorf("Unmarshal(%s) = %d, %v; want %d", c.in, m, err, c.want)
+		}
+	}
+	for _, in := range []string{`"12.345"`, `"abc"`, `1e2`, `true`} {
+		var m Money
+		if err := json.Unmarshal([]byte(in), &m); err == nil {
+			t.Errorf("Unmarshal(%s) = %d; want an error", in, m)
+		}
+	}
+}
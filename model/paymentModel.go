@@ -0,0 +1,58 @@
+// model/paymentModel.go
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// RentalInvoicePrefix starts the external_id of rental invoices
+// ("rental:<id>") so the invoice webhook can tell them from wallet top-ups.
+const RentalInvoicePrefix = "rental:"
+
+// WithdrawalPrefix starts the external_id of payouts ("withdrawal:<id>"),
+// which is also their idempotency key at Xendit.
+const WithdrawalPrefix = "withdrawal:"
+
+type PaymentEventKind string
+
+const (
+	PaymentEventInvoice      PaymentEventKind = "INVOICE"
+	PaymentEventDisbursement PaymentEventKind = "DISBURSEMENT"
+)
+
+type PaymentEventStatus string
+
+const (
+	PaymentEventReceived  PaymentEventStatus = "RECEIVED"  // stored, being processed
+	PaymentEventProcessed PaymentEventStatus = "PROCESSED" // handled; repeats are acknowledged
+	PaymentEventFailed    PaymentEventStatus = "FAILED"    // handler errored; may be replayed
+	PaymentEventRejected  PaymentEventStatus = "REJECTED"  // bad signature or body; never processed
+)
+
+// PaymentEvent is one inbound provider webhook as we received it. EventID
+// is the provider's delivery id, unique among verified events.
+type PaymentEvent struct {
+	ID          int64              `json:"id"`
+	Kind        PaymentEventKind   `json:"kind"`
+	EventID     string             `json:"event_id"`
+	Headers     map[string]string  `json:"headers"`
+	RawBody     RawBody            `json:"raw_body"`
+	Verified    bool               `json:"verified"`
+	Status      PaymentEventStatus `json:"status"`
+	Error       *string            `json:"error,omitempty"`
+	Attempts    int                `json:"attempts"`
+	ReceivedAt  time.Time          `json:"received_at"`
+	ProcessedAt *time.Time         `json:"processed_at,omitempty"`
+}
+
+// RawBody is a webhook body byte for byte. It marshals as the JSON it holds,
+// or as a string when it is not valid JSON.
+type RawBody []byte
+
+func (b RawBody) MarshalJSON() ([]byte, error) {
+	if json.Valid(b) {
+		return b, nil
+	}
+	return json.Marshal(string(b))
+}
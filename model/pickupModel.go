@@ -0,0 +1,14 @@
+// model/pickup.go
+package model
+
+import "time"
+
+// PickupSlot is a window in which booked copies can be collected at a branch.
+type PickupSlot struct {
+	ID       int64     `json:"id"`
+	Branch   string    `json:"branch"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Capacity int       `json:"capacity"`
+	Booked   int       `json:"booked"`
+}
@@ -11,6 +11,7 @@ const (
 	RentalActive   RentalStatus = "ACTIVE"
 	RentalReturned RentalStatus = "RETURNED"
 	RentalCanceled RentalStatus = "CANCELED"
+	RentalLost     RentalStatus = "LOST"
 )
 
 type Rental struct {
@@ -19,13 +20,19 @@ type Rental struct {
 	BookID          int64        `json:"book_id"`
 	BookItemID      int64        `json:"book_item_id"`
 	Status          RentalStatus `json:"status"`
-	RentalCost      float64      `json:"rental_cost"`
-	BookedAt        string       `json:"booked_at"`
+	RentalCost      Money        `json:"rental_cost"`
+	BookedAt        time.Time    `json:"booked_at"`
 	PaymentDueAt    time.Time    `json:"payment_due_at"`
 	PaidAt          *time.Time   `json:"paid_at,omitempty"`
 	ActivatedAt     *time.Time   `json:"activated_at,omitempty"`
+	DueAt           *time.Time   `json:"due_at,omitempty"`
 	ReturnedAt      *time.Time   `json:"returned_at,omitempty"`
 	CanceledAt      *time.Time   `json:"canceled_at,omitempty"`
+	LostAt          *time.Time   `json:"lost_at,omitempty"`
+	LateFee         Money        `json:"late_fee"`
+	RenewalCount    int          `json:"renewal_count"`
 	XenditInvoiceID *string      `json:"xendit_invoice_id,omitempty"`
+	OrderID         *int64       `json:"order_id,omitempty"`
+	PickupSlotID    *int64       `json:"pickup_slot_id,omitempty"`
 	Notes           *string      `json:"notes,omitempty"`
 }
@@ -0,0 +1,42 @@
+// model/voucherModel.go
+package model
+
+import "time"
+
+type VoucherKind string
+
+const (
+	VoucherCredit     VoucherKind = "CREDIT"      // redeemed by code for a fixed credit
+	VoucherTopupBonus VoucherKind = "TOPUP_BONUS" // applied automatically to paid top-ups
+)
+
+// Voucher is a promo code or campaign. For CREDIT vouchers Amount is the
+// credit. For TOPUP_BONUS, Percent > 0 pays that share of the top-up capped
+// at Amount; Percent 0 pays Amount flat. MaxUses 0 means no overall cap.
+type Voucher struct {
+	ID           int64       `json:"id"`
+	Code         string      `json:"code"`
+	Kind         VoucherKind `json:"kind"`
+	Amount       Money       `json:"amount"`
+	Percent      int         `json:"percent,omitempty"`
+	MinTopup     Money       `json:"min_topup"`
+	StartsAt     time.Time   `json:"starts_at"`
+	ExpiresAt    *time.Time  `json:"expires_at,omitempty"`
+	MaxUses      int         `json:"max_uses"`
+	PerUserLimit int         `json:"per_user_limit"`
+	Uses         int         `json:"uses"`
+	Active       bool        `json:"active"`
+	CreatedBy    int64       `json:"created_by"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// TopupBonus is what a TOPUP_BONUS voucher pays on a top-up of amount.
+func (v *Voucher) TopupBonus(amount Money) Money {
+	if v.Kind != VoucherTopupBonus || amount < v.MinTopup {
+		return 0
+	}
+	if v.Percent <= 0 {
+		return v.Amount
+	}
+	return min(amount.Percent(v.Percent), v.Amount)
+}
@@ -15,7 +15,7 @@ const (
 type WalletTopup struct {
 	ID              int64       `json:"id"`
 	UserID          int64       `json:"user_id"`
-	Amount          float64     `json:"amount"`
+	Amount          Money       `json:"amount"`
 	Status          TopupStatus `json:"status"`
 	XenditInvoiceID *string     `json:"xendit_invoice_id,omitempty"`
 	PaymentLink     *string     `json:"payment_link,omitempty"`
@@ -27,19 +27,85 @@ type WalletTopup struct {
 type LedgerType string
 
 const (
-	LedgerTopup  LedgerType = "TOPUP_CONFIRMED"
-	LedgerCharge LedgerType = "RENTAL_CHARGE"
-	LedgerRefund LedgerType = "RENTAL_REFUND"
-	LedgerAdjust LedgerType = "ADJUSTMENT"
+	LedgerTopup   LedgerType = "TOPUP_CONFIRMED"
+	LedgerCharge  LedgerType = "RENTAL_CHARGE"
+	LedgerRefund  LedgerType = "RENTAL_REFUND"
+	LedgerAdjust  LedgerType = "ADJUSTMENT"
+	LedgerLate    LedgerType = "LATE_FEE"
+	LedgerReplace LedgerType = "REPLACEMENT_CHARGE"
+	LedgerWaiver  LedgerType = "FEE_WAIVER"
+
+	LedgerWithdraw       LedgerType = "WITHDRAWAL"
+	LedgerWithdrawRevert LedgerType = "WITHDRAWAL_REVERSAL"
+	LedgerTransferOut    LedgerType = "TRANSFER_OUT"
+	LedgerTransferIn     LedgerType = "TRANSFER_IN"
+	LedgerVoucher        LedgerType = "VOUCHER_CREDIT"
+	LedgerTopupBonus     LedgerType = "TOPUP_BONUS"
+)
+
+type WithdrawalStatus string
+
+const (
+	WithdrawalPending   WithdrawalStatus = "PENDING"
+	WithdrawalCompleted WithdrawalStatus = "COMPLETED"
+	WithdrawalFailed    WithdrawalStatus = "FAILED"
 )
 
+// WalletWithdrawal is a cash-out of deposit balance to a bank account. The
+// balance is debited when it is requested; a failed payout credits it back.
+type WalletWithdrawal struct {
+	ID             int64            `json:"id"`
+	UserID         int64            `json:"user_id"`
+	Amount         Money            `json:"amount"`
+	Status         WithdrawalStatus `json:"status"`
+	BankCode       string           `json:"bank_code"`
+	AccountHolder  string           `json:"account_holder_name"`
+	AccountNumber  string           `json:"account_number"`
+	DisbursementID *string          `json:"disbursement_id,omitempty"`
+	FailureReason  *string          `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	SettledAt      *time.Time       `json:"settled_at,omitempty"`
+}
+
 type WalletLedger struct {
 	ID           int64      `json:"id"`
 	UserID       int64      `json:"user_id"`
 	RefTable     string     `json:"ref_table"`
 	RefID        *int64     `json:"ref_id,omitempty"`
 	EntryType    LedgerType `json:"entry_type"`
-	Amount       float64    `json:"amount"`
-	BalanceAfter float64    `json:"balance_after"`
+	Amount       Money      `json:"amount"`
+	BalanceAfter Money      `json:"balance_after"`
 	CreatedAt    time.Time  `json:"created_at"`
 }
+
+type AdjustmentStatus string
+
+const (
+	AdjustmentPending  AdjustmentStatus = "PENDING_APPROVAL"
+	AdjustmentApplied  AdjustmentStatus = "APPLIED"
+	AdjustmentRejected AdjustmentStatus = "REJECTED"
+)
+
+// WalletAdjustment is a manual credit (positive) or debit (negative) made
+// by an admin. DecidedBy is the second admin who approved or rejected it.
+type WalletAdjustment struct {
+	ID          int64            `json:"id"`
+	UserID      int64            `json:"user_id"`
+	Amount      Money            `json:"amount"`
+	Reason      string           `json:"reason"`
+	Status      AdjustmentStatus `json:"status"`
+	RequestedBy int64            `json:"requested_by"`
+	DecidedBy   *int64           `json:"decided_by,omitempty"`
+	CreatedAt   time.Time        `json:"created_at"`
+	DecidedAt   *time.Time       `json:"decided_at,omitempty"`
+}
+
+// WalletTransfer is balance gifted from one member to another.
+type WalletTransfer struct {
+	ID         int64     `json:"id"`
+	FromUserID int64     `json:"from_user_id"`
+	ToUserID   int64     `json:"to_user_id"`
+	Amount     Money     `json:"amount"`
+	Note       string    `json:"note,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -4,19 +4,25 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+
+	"bookrental/model"
 )
 
 type Book struct {
 	ID                int64
 	Name              string
 	Category          string
-	RentalCost        float64
+	RentalCost        model.Money
+	RentalDays        int
+	LateFeePerDay     model.Money
+	ReplacementCost   model.Money
 	StockAvailability int64
+	TotalCopies       int64 // copies in circulation; LOST and DAMAGED ones are excluded
 }
 
 type Repo interface {
-	CreateBook(ctx context.Context, name, category string, rentalCost float64) (int64, error)
-	AddCopies(ctx context.Context, bookID int64, n int) (int64, error)
+	CreateBook(ctx context.Context, b Book) (int64, error)
+	AddCopies(ctx context.Context, bookID int64, n int, branch string) (int64, error)
 	List(ctx context.Context) ([]Book, error)
 	Detail(ctx context.Context, id int64) (*Book, error)
 }
@@ -25,19 +31,19 @@ type repo struct{ db *sql.DB }
 
 func New(db *sql.DB) Repo { return &repo{db} }
 
-func (r *repo) CreateBook(ctx context.Context, name, category string, rentalCost float64) (int64, error) {
+func (r *repo) CreateBook(ctx context.Context, b Book) (int64, error) {
 	const q = `
-INSERT INTO books (name, category, rental_cost)
-VALUES ($1,$2,$3)
+INSERT INTO books (name, category, rental_cost, rental_days, late_fee_per_day, replacement_cost)
+VALUES ($1,$2,$3,$4,$5,$6)
 RETURNING id`
 	var id int64
-	if err := r.db.QueryRowContext(ctx, q, name, category, rentalCost).Scan(&id); err != nil {
+	if err := r.db.QueryRowContext(ctx, q, b.Name, b.Category, b.RentalCost, b.RentalDays, b.LateFeePerDay, b.ReplacementCost).Scan(&id); err != nil {
 		return 0, err
 	}
 	return id, nil
 }
 
-func (r *repo) AddCopies(ctx context.Context, bookID int64, n int) (int64, error) {
+func (r *repo) AddCopies(ctx context.Context, bookID int64, n int, branch string) (int64, error) {
 	if n <= 0 {
 		return 0, errors.New("n must be > 0")
 	}
@@ -50,9 +56,9 @@ func (r *repo) AddCopies(ctx context.Context, bookID int64, n int) (int64, error
 			_ = tx.Rollback()
 		}
 	}()
-	const ins = `INSERT INTO book_items (book_id, status) VALUES ($1,'AVAILABLE')`
+	const ins = `INSERT INTO book_items (book_id, status, branch) VALUES ($1,'AVAILABLE',$2)`
 	for i := 0; i < n; i++ {
-		if _, err = tx.ExecContext(ctx, ins, bookID); err != nil {
+		if _, err = tx.ExecContext(ctx, ins, bookID, branch); err != nil {
 			return 0, err
 		}
 	}
@@ -65,8 +71,9 @@ func (r *repo) AddCopies(ctx context.Context, bookID int64, n int) (int64, error
 func (r *repo) List(ctx context.Context) ([]Book, error) {
 
 	const q = `
-	SELECT b.id, b.name, b.category, b.rental_cost,
-		COALESCE(COUNT(bi.*) FILTER (WHERE bi.status='AVAILABLE'),0)::BIGINT AS stock_availability
+	SELECT b.id, b.name, b.category, b.rental_cost, b.rental_days, b.late_fee_per_day, b.replacement_cost,
+		COALESCE(COUNT(bi.*) FILTER (WHERE bi.status='AVAILABLE'),0)::BIGINT AS stock_availability,
+		COALESCE(COUNT(bi.*) FILTER (WHERE bi.status NOT IN ('LOST','DAMAGED')),0)::BIGINT AS total_copies
 	FROM books b
 	LEFT JOIN book_items bi ON bi.book_id=b.id
 	GROUP BY b.id
@@ -80,7 +87,7 @@ func (r *repo) List(ctx context.Context) ([]Book, error) {
 	var out []Book
 	for rows.Next() {
 		var b Book
-		if err := rows.Scan(&b.ID, &b.Name, &b.Category, &b.RentalCost, &b.StockAvailability); err != nil {
+		if err := rows.Scan(&b.ID, &b.Name, &b.Category, &b.RentalCost, &b.RentalDays, &b.LateFeePerDay, &b.ReplacementCost, &b.StockAvailability, &b.TotalCopies); err != nil {
 			return nil, err
 		}
 		out = append(out, b)
@@ -90,14 +97,15 @@ func (r *repo) List(ctx context.Context) ([]Book, error) {
 
 func (r *repo) Detail(ctx context.Context, id int64) (*Book, error) {
 	const q = `
-SELECT b.id, b.name, b.category, b.rental_cost,
-       COALESCE(COUNT(bi.*) FILTER (WHERE bi.status='AVAILABLE'),0)::BIGINT AS stock_availability
+SELECT b.id, b.name, b.category, b.rental_cost, b.rental_days, b.late_fee_per_day, b.replacement_cost,
+       COALESCE(COUNT(bi.*) FILTER (WHERE bi.status='AVAILABLE'),0)::BIGINT AS stock_availability,
+       COALESCE(COUNT(bi.*) FILTER (WHERE bi.status NOT IN ('LOST','DAMAGED')),0)::BIGINT AS total_copies
 FROM books b
 LEFT JOIN book_items bi ON bi.book_id=b.id
 WHERE b.id=$1
 GROUP BY b.id`
 	var b Book
-	if err := r.db.QueryRowContext(ctx, q, id).Scan(&b.ID, &b.Name, &b.Category, &b.RentalCost, &b.StockAvailability); err != nil {
+	if err := r.db.QueryRowContext(ctx, q, id).Scan(&b.ID, &b.Name, &b.Category, &b.RentalCost, &b.RentalDays, &b.LateFeePerDay, &b.ReplacementCost, &b.StockAvailability, &b.TotalCopies); err != nil {
 		return nil, err
 	}
 	return &b, nil
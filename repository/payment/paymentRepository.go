@@ -0,0 +1,167 @@
+package paymentrepo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bookrental/model"
+)
+
+// EventFilter narrows ListEvents; zero values match everything.
+type EventFilter struct {
+	Status model.PaymentEventStatus
+	Kind   model.PaymentEventKind
+	Limit  int
+}
+
+type Repo interface {
+	RecordEvent(ctx context.Context, ev *model.PaymentEvent) (fresh bool, err error)
+	ClaimEvent(ctx context.Context, id int64, staleAfter time.Duration) (bool, error)
+	FinishEvent(ctx context.Context, id int64, status model.PaymentEventStatus, errMsg string) error
+	GetEvent(ctx context.Context, id int64) (*model.PaymentEvent, error)
+	ListEvents(ctx context.Context, f EventFilter) ([]model.PaymentEvent, error)
+}
+
+type repo struct{ db *sql.DB }
+
+func New(db *sql.DB) Repo { return &repo{db} }
+
+const eventColumns = `
+SELECT id, kind, event_id, headers, raw_body, verified, status, error, attempts, received_at, processed_at
+FROM payment_events`
+
+func scanEvent(row interface{ Scan(...any) error }) (*model.PaymentEvent, error) {
+	var (
+		ev            model.PaymentEvent
+		headers, body []byte
+	)
+	if err := row.Scan(&ev.ID, &ev.Kind, &ev.EventID, &headers, &body, &ev.Verified, &ev.Status, &ev.Error,
+		&ev.Attempts, &ev.ReceivedAt, &ev.ProcessedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(headers, &ev.Headers); err != nil {
+		return nil, fmt.Errorf("event %d headers: %w", ev.ID, err)
+	}
+	ev.RawBody = model.RawBody(body)
+	return &ev, nil
+}
+
+// RecordEvent stores ev and fills in its id. Verified events are unique on
+// (kind, event_id): a repeat is not stored again, ev gets the id and status
+// of the earlier row and fresh is false. New verified events start out
+// RECEIVED with their first attempt counted.
+func (r *repo) RecordEvent(ctx context.Context, ev *model.PaymentEvent) (bool, error) {
+	headers, err := json.Marshal(ev.Headers)
+	if err != nil {
+		return false, err
+	}
+	var lastAttempt *time.Time
+	if ev.Status == model.PaymentEventReceived {
+		now := time.Now()
+		ev.Attempts, lastAttempt = 1, &now
+	}
+	const q = `
+INSERT INTO payment_events (kind, event_id, headers, raw_body, verified, status, error, attempts, last_attempt_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+ON CONFLICT (kind, event_id) WHERE verified DO NOTHING
+RETURNING id, received_at`
+	err = r.db.QueryRowContext(ctx, q, ev.Kind, ev.EventID, string(headers), []byte(ev.RawBody), ev.Verified,
+		ev.Status, ev.Error, ev.Attempts, lastAttempt).Scan(&ev.ID, &ev.ReceivedAt)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	err = r.db.QueryRowContext(ctx, `
+SELECT id, status, attempts, received_at FROM payment_events
+WHERE kind=$1 AND event_id=$2 AND verified`, ev.Kind, ev.EventID).Scan(&ev.ID, &ev.Status, &ev.Attempts, &ev.ReceivedAt)
+	return false, err
+}
+
+// ClaimEvent moves a FAILED event, or one stuck in RECEIVED for longer than
+// staleAfter, back to RECEIVED for another attempt. It reports false when
+// the event is not in a claimable state, e.g. someone else is on it.
+func (r *repo) ClaimEvent(ctx context.Context, id int64, staleAfter time.Duration) (bool, error) {
+	const q = `
+UPDATE payment_events
+SET status='RECEIVED', attempts = attempts + 1, last_attempt_at = NOW(), error = NULL
+WHERE id=$1 AND verified
+  AND (status='FAILED' OR (status='RECEIVED' AND last_attempt_at < $2))`
+	res, err := r.db.ExecContext(ctx, q, id, time.Now().Add(-staleAfter))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// FinishEvent records the outcome of an attempt. errMsg is stored only when
+// it is not empty.
+func (r *repo) FinishEvent(ctx context.Context, id int64, status model.PaymentEventStatus, errMsg string) error {
+	var (
+		msg         *string
+		processedAt *time.Time
+	)
+	if errMsg != "" {
+		msg = &errMsg
+	}
+	if status == model.PaymentEventProcessed {
+		now := time.Now()
+		processedAt = &now
+	}
+	const q = `
+UPDATE payment_events
+SET status=$2, error=$3, processed_at=COALESCE($4, processed_at)
+WHERE id=$1`
+	_, err := r.db.ExecContext(ctx, q, id, status, msg, processedAt)
+	return err
+}
+
+func (r *repo) GetEvent(ctx context.Context, id int64) (*model.PaymentEvent, error) {
+	return scanEvent(r.db.QueryRowContext(ctx, eventColumns+` WHERE id=$1`, id))
+}
+
+// ListEvents returns matching events, newest first.
+func (r *repo) ListEvents(ctx context.Context, f EventFilter) ([]model.PaymentEvent, error) {
+	var (
+		where []string
+		args  []any
+	)
+	if f.Status != "" {
+		args = append(args, f.Status)
+		where = append(where, fmt.Sprintf("status=$%d", len(args)))
+	}
+	if f.Kind != "" {
+		args = append(args, f.Kind)
+		where = append(where, fmt.Sprintf("kind=$%d", len(args)))
+	}
+	q := eventColumns
+	if len(where) > 0 {
+		q += "\nWHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit)
+	q += fmt.Sprintf("\nORDER BY id DESC\nLIMIT $%d", len(args))
+
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.PaymentEvent{}
+	for rows.Next() {
+		ev, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *ev)
+	}
+	return out, rows.Err()
+}
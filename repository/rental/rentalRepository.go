@@ -5,35 +5,114 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
+
+	"bookrental/model"
 )
 
+// ErrStatusChanged is returned by Transition when the rental is no longer in
+// the expected source status (someone else moved it first).
+var ErrStatusChanged = errors.New("rental status changed")
+
 type HistoryRow struct {
-	RentalID   int64      `json:"rental_id"`
-	BookID     int64      `json:"book_id"`
-	BookName   string     `json:"book_name"`
-	ItemID     int64      `json:"item_id"`
-	Price      float64    `json:"price"`
-	Status     string     `json:"status"` // ACTIVE | RETURNED
-	CreatedAt  time.Time  `json:"created_at"`
-	ReturnedAt *time.Time `json:"returned_at,omitempty"`
+	RentalID   int64       `json:"rental_id"`
+	BookID     int64       `json:"book_id"`
+	BookName   string      `json:"book_name"`
+	ItemID     int64       `json:"item_id"`
+	Price      model.Money `json:"price"`
+	Status     string      `json:"status"` // BOOKED | PAID | ACTIVE | RETURNED | CANCELED | LOST
+	CreatedAt  time.Time   `json:"created_at"`
+	DueAt      *time.Time  `json:"due_at,omitempty"`
+	Overdue    bool        `json:"overdue"`
+	LateFee    model.Money `json:"late_fee"`
+	ReturnedAt *time.Time  `json:"returned_at,omitempty"`
+}
+
+type WaitlistRow struct {
+	EntryID  int64     `json:"entry_id"`
+	BookID   int64     `json:"book_id"`
+	BookName string    `json:"book_name"`
+	Position int       `json:"position"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// RentalFilter narrows the admin rental list. Zero values mean "any".
+type RentalFilter struct {
+	Status  model.RentalStatus
+	UserID  int64
+	BookID  int64
+	Overdue bool       // ACTIVE and past due_at
+	From    *time.Time // booked_at >= From
+	To      *time.Time // booked_at < To
+	Limit   int
+	Offset  int
+}
+
+// BorrowerStats is what the eligibility rules look at for a user.
+type BorrowerStats struct {
+	CreatedAt  time.Time
+	Balance    model.Money
+	Open       int            // BOOKED, PAID or ACTIVE rentals
+	Overdue    int            // ACTIVE rentals past due_at
+	ByCategory map[string]int // open rentals per book category
 }
 
 type Repo interface {
 	// User & money
-	LockUserForUpdate(ctx context.Context, tx *sql.Tx, userID int64) (deposit float64, err error)
-	DeductDeposit(ctx context.Context, tx *sql.Tx, userID int64, amount float64) error
+	LockUserForUpdate(ctx context.Context, tx *sql.Tx, userID int64) (deposit model.Money, err error)
+	BorrowerStats(ctx context.Context, tx *sql.Tx, userID int64) (*BorrowerStats, error)
+	DeductDeposit(ctx context.Context, tx *sql.Tx, userID int64, amount model.Money) error
 
 	// Books & items
-	GetBookPrice(ctx context.Context, tx *sql.Tx, bookID int64) (price float64, err error)
+	GetBookPrice(ctx context.Context, tx *sql.Tx, bookID int64) (price model.Money, err error)
+	BookCategory(ctx context.Context, tx *sql.Tx, bookID int64) (string, error)
+	GetLoanTerms(ctx context.Context, tx *sql.Tx, bookID int64) (rentalDays int, lateFeePerDay model.Money, err error)
+	CountWaiting(ctx context.Context, tx *sql.Tx, bookID int64) (int, error)
 	LockOneAvailableItem(ctx context.Context, tx *sql.Tx, bookID int64) (itemID int64, err error)
+	LockAvailableItemAt(ctx context.Context, tx *sql.Tx, bookID int64, branch string) (itemID int64, err error)
+	ItemBranch(ctx context.Context, tx *sql.Tx, itemID int64) (string, error)
 	ReserveItem(ctx context.Context, tx *sql.Tx, itemID int64, holdUntil *time.Time) error
+	MarkItemRented(ctx context.Context, tx *sql.Tx, itemID int64) error
+	MarkItemCondition(ctx context.Context, tx *sql.Tx, itemID int64, status model.BookItemStatus) error
+	GetReplacementCost(ctx context.Context, tx *sql.Tx, bookID int64) (model.Money, error)
+	FreeCopy(ctx context.Context, tx *sql.Tx, itemID int64) error
 
 	// Rentals
-	InsertRental(ctx context.Context, tx *sql.Tx, userID, bookID, itemID int64, price float64, holdUntil *time.Time) error
-	GetRentalOwnerAndStatus(ctx context.Context, tx *sql.Tx, rentalID int64) (ownerID int64, status string, itemID int64, err error)
-	MarkReturned(ctx context.Context, tx *sql.Tx, rentalID int64) error
-	FreeCopy(ctx context.Context, tx *sql.Tx, itemID int64) error
+	InsertRental(ctx context.Context, tx *sql.Tx, userID, bookID, itemID int64, price model.Money, paymentDueAt time.Time) (int64, error)
+	GetByID(ctx context.Context, rentalID int64) (*model.Rental, error)
+	GetForUpdate(ctx context.Context, tx *sql.Tx, rentalID int64) (*model.Rental, error)
+	SetInvoice(ctx context.Context, tx *sql.Tx, rentalID int64, invoiceID string) error
+	CreateOrder(ctx context.Context, tx *sql.Tx, userID int64, total model.Money) (int64, error)
+	AttachToOrder(ctx context.Context, tx *sql.Tx, orderID int64, rentalIDs []int64) error
+	Transition(ctx context.Context, tx *sql.Tx, rentalID int64, from, to model.RentalStatus) error
+	LockExpiredHolds(ctx context.Context, tx *sql.Tx, limit int) ([]model.Rental, error)
+	LockMissedPickups(ctx context.Context, tx *sql.Tx, limit int) ([]model.Rental, error)
+	StartLoan(ctx context.Context, tx *sql.Tx, rentalID int64) (dueAt time.Time, err error)
+	SetLateFee(ctx context.Context, tx *sql.Tx, rentalID int64, fee model.Money) error
+	Extend(ctx context.Context, tx *sql.Tx, rentalID int64, days int) (dueAt time.Time, err error)
+
+	// Pickup slots
+	CreateSlot(ctx context.Context, branch string, startsAt, endsAt time.Time, capacity int) (int64, error)
+	LockSlot(ctx context.Context, tx *sql.Tx, slotID int64) (*model.PickupSlot, error)
+	SetPickupSlot(ctx context.Context, tx *sql.Tx, rentalID, slotID int64) error
+	FreeSlots(ctx context.Context, bookID int64) ([]model.PickupSlot, error)
+
+	// Admin
+	ListRentals(ctx context.Context, f RentalFilter) ([]model.Rental, error)
+	LogAdminAction(ctx context.Context, tx *sql.Tx, rentalID, adminID int64, action, reason string, amount model.Money) error
+
+	// Waitlist
+	LockBook(ctx context.Context, tx *sql.Tx, bookID int64) error
+	ShareLockBook(ctx context.Context, tx *sql.Tx, bookID int64) error
+	CountAvailable(ctx context.Context, tx *sql.Tx, bookID int64) (int64, error)
+	JoinWaitlist(ctx context.Context, tx *sql.Tx, bookID, userID int64) (entryID int64, err error)
+	LeaveWaitlist(ctx context.Context, bookID, userID int64) (bool, error)
+	MyWaitlist(ctx context.Context, userID int64) ([]WaitlistRow, error)
+	LockNextWaiting(ctx context.Context, tx *sql.Tx, bookID int64) (entryID, userID int64, err error)
+	FulfillWaiting(ctx context.Context, tx *sql.Tx, entryID, rentalID int64) error
+	SkipWaiting(ctx context.Context, tx *sql.Tx, entryID int64) error
 
 	// History
 	ListMyRentals(ctx context.Context, userID int64) ([]HistoryRow, error)
@@ -47,18 +126,58 @@ func New(db *sql.DB) Repo { return &repo{db: db} }
 
 // User & money
 
-func (r *repo) LockUserForUpdate(ctx context.Context, tx *sql.Tx, userID int64) (float64, error) {
+func (r *repo) LockUserForUpdate(ctx context.Context, tx *sql.Tx, userID int64) (model.Money, error) {
 	const q = `
 				SELECT deposit_balance
 				FROM users
 				WHERE id = $1
 				FOR UPDATE`
-	var dep float64
+	var dep model.Money
 	err := tx.QueryRowContext(ctx, q, userID).Scan(&dep)
 	return dep, err
 }
 
-func (r *repo) DeductDeposit(ctx context.Context, tx *sql.Tx, userID int64, amount float64) error {
+// BorrowerStats reads the user's account age, balance and open rentals.
+func (r *repo) BorrowerStats(ctx context.Context, tx *sql.Tx, userID int64) (*BorrowerStats, error) {
+	b := BorrowerStats{ByCategory: map[string]int{}}
+	const qUser = `
+		SELECT created_at, deposit_balance
+		FROM users
+		WHERE id = $1`
+	if err := tx.QueryRowContext(ctx, qUser, userID).Scan(&b.CreatedAt, &b.Balance); err != nil {
+		return nil, err
+	}
+
+	const qOpen = `
+		SELECT b.category,
+			COUNT(*),
+			COUNT(*) FILTER (WHERE r.status = 'ACTIVE' AND r.due_at < NOW())
+		FROM rentals r
+		JOIN books b ON b.id = r.book_id
+		WHERE r.user_id = $1
+		AND r.status IN ('BOOKED', 'PAID', 'ACTIVE')
+		GROUP BY b.category`
+	rows, err := tx.QueryContext(ctx, qOpen, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			category      string
+			open, overdue int
+		)
+		if err := rows.Scan(&category, &open, &overdue); err != nil {
+			return nil, err
+		}
+		b.ByCategory[category] = open
+		b.Open += open
+		b.Overdue += overdue
+	}
+	return &b, rows.Err()
+}
+
+func (r *repo) DeductDeposit(ctx context.Context, tx *sql.Tx, userID int64, amount model.Money) error {
 	// Guard: only deduct if sufficient.
 	const q = `
 			UPDATE users
@@ -78,21 +197,54 @@ func (r *repo) DeductDeposit(ctx context.Context, tx *sql.Tx, userID int64, amou
 
 // Books & items
 
-func (r *repo) GetBookPrice(ctx context.Context, tx *sql.Tx, bookID int64) (float64, error) {
+func (r *repo) GetBookPrice(ctx context.Context, tx *sql.Tx, bookID int64) (model.Money, error) {
 	const q = `
-			SELECT price
+			SELECT rental_cost
 			FROM books
 			WHERE id = $1`
-	var price float64
+	var price model.Money
 	err := tx.QueryRowContext(ctx, q, bookID).Scan(&price)
 	return price, err
 }
 
+func (r *repo) BookCategory(ctx context.Context, tx *sql.Tx, bookID int64) (string, error) {
+	const q = `
+			SELECT category
+			FROM books
+			WHERE id = $1`
+	var category string
+	err := tx.QueryRowContext(ctx, q, bookID).Scan(&category)
+	return category, err
+}
+
+func (r *repo) GetLoanTerms(ctx context.Context, tx *sql.Tx, bookID int64) (int, model.Money, error) {
+	const q = `
+			SELECT rental_days, late_fee_per_day
+			FROM books
+			WHERE id = $1`
+	var days int
+	var fee model.Money
+	err := tx.QueryRowContext(ctx, q, bookID).Scan(&days, &fee)
+	return days, fee, err
+}
+
+// CountWaiting is how many users are queued for a copy of bookID.
+func (r *repo) CountWaiting(ctx context.Context, tx *sql.Tx, bookID int64) (int, error) {
+	const q = `
+			SELECT COUNT(*)
+			FROM book_waitlist
+			WHERE book_id = $1
+			AND status = 'WAITING'`
+	var n int
+	err := tx.QueryRowContext(ctx, q, bookID).Scan(&n)
+	return n, err
+}
+
 func (r *repo) LockOneAvailableItem(ctx context.Context, tx *sql.Tx, bookID int64) (int64, error) {
 	// Prevent double booking with SKIP LOCKED
 	const q = `
 				SELECT id
-				FROM books
+				FROM book_items
 				WHERE book_id = $1
 				AND status = 'AVAILABLE'
 				ORDER BY id
@@ -103,6 +255,29 @@ func (r *repo) LockOneAvailableItem(ctx context.Context, tx *sql.Tx, bookID int6
 	return itemID, err
 }
 
+// LockAvailableItemAt is LockOneAvailableItem restricted to one branch.
+func (r *repo) LockAvailableItemAt(ctx context.Context, tx *sql.Tx, bookID int64, branch string) (int64, error) {
+	const q = `
+				SELECT id
+				FROM book_items
+				WHERE book_id = $1
+				AND branch = $2
+				AND status = 'AVAILABLE'
+				ORDER BY id
+				FOR UPDATE SKIP LOCKED
+				LIMIT 1`
+	var itemID int64
+	err := tx.QueryRowContext(ctx, q, bookID, branch).Scan(&itemID)
+	return itemID, err
+}
+
+func (r *repo) ItemBranch(ctx context.Context, tx *sql.Tx, itemID int64) (string, error) {
+	const q = `SELECT branch FROM book_items WHERE id = $1`
+	var branch string
+	err := tx.QueryRowContext(ctx, q, itemID).Scan(&branch)
+	return branch, err
+}
+
 func (r *repo) ReserveItem(ctx context.Context, tx *sql.Tx, itemID int64, holdUntil *time.Time) error {
 	const q = `
 	UPDATE book_items
@@ -113,55 +288,502 @@ func (r *repo) ReserveItem(ctx context.Context, tx *sql.Tx, itemID int64, holdUn
 	return err
 }
 
+func (r *repo) MarkItemRented(ctx context.Context, tx *sql.Tx, itemID int64) error {
+	const q = `
+		UPDATE book_items
+		SET status = 'RENTED',
+			booked_until = NULL
+		WHERE id = $1`
+	_, err := tx.ExecContext(ctx, q, itemID)
+	return err
+}
+
+// MarkItemCondition takes a copy out of circulation as LOST or DAMAGED.
+func (r *repo) MarkItemCondition(ctx context.Context, tx *sql.Tx, itemID int64, status model.BookItemStatus) error {
+	const q = `
+		UPDATE book_items
+		SET status = $2,
+			booked_until = NULL
+		WHERE id = $1`
+	_, err := tx.ExecContext(ctx, q, itemID, string(status))
+	return err
+}
+
+func (r *repo) GetReplacementCost(ctx context.Context, tx *sql.Tx, bookID int64) (model.Money, error) {
+	const q = `
+			SELECT replacement_cost
+			FROM books
+			WHERE id = $1`
+	var cost model.Money
+	err := tx.QueryRowContext(ctx, q, bookID).Scan(&cost)
+	return cost, err
+}
+
+func (r *repo) FreeCopy(ctx context.Context, tx *sql.Tx, itemID int64) error {
+	const q = `
+		UPDATE book_items
+		SET status = 'AVAILABLE',
+			booked_until = NULL
+		WHERE id = $1`
+	_, err := tx.ExecContext(ctx, q, itemID)
+	return err
+}
+
 // Rentals
-func (r *repo) InsertRental(ctx context.Context, tx *sql.Tx, userID, bookID, itemID int64, price float64, holdUntil *time.Time) error {
-	//deposit deducted , rental =ACTIVE
+
+// InsertRental creates a BOOKED rental holding itemID until paymentDueAt.
+func (r *repo) InsertRental(ctx context.Context, tx *sql.Tx, userID, bookID, itemID int64, price model.Money, paymentDueAt time.Time) (int64, error) {
+	const q = `
+		INSERT INTO rentals (user_id, book_id, book_item_id, rental_cost, status, payment_due_at)
+		VALUES ($1, $2, $3, $4, 'BOOKED', $5)
+		RETURNING id`
+	var id int64
+	if err := tx.QueryRowContext(ctx, q, userID, bookID, itemID, price, paymentDueAt).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+const rentalColumns = `
+		id, user_id, book_id, book_item_id, status, rental_cost,
+		booked_at, payment_due_at, paid_at, activated_at, due_at, returned_at, canceled_at, lost_at,
+		late_fee, renewal_count, xendit_invoice_id, order_id, pickup_slot_id`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRental(s scanner) (*model.Rental, error) {
+	var m model.Rental
+	if err := s.Scan(
+		&m.ID, &m.UserID, &m.BookID, &m.BookItemID, &m.Status, &m.RentalCost,
+		&m.BookedAt, &m.PaymentDueAt, &m.PaidAt, &m.ActivatedAt, &m.DueAt, &m.ReturnedAt, &m.CanceledAt, &m.LostAt,
+		&m.LateFee, &m.RenewalCount, &m.XenditInvoiceID, &m.OrderID, &m.PickupSlotID,
+	); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// collectRentals scans and closes rows.
+func collectRentals(rows *sql.Rows) ([]model.Rental, error) {
+	defer rows.Close()
+
+	var out []model.Rental
+	for rows.Next() {
+		m, err := scanRental(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *m)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) GetByID(ctx context.Context, rentalID int64) (*model.Rental, error) {
+	q := `SELECT` + rentalColumns + `
+		FROM rentals
+		WHERE id = $1`
+	return scanRental(r.db.QueryRowContext(ctx, q, rentalID))
+}
+
+func (r *repo) GetForUpdate(ctx context.Context, tx *sql.Tx, rentalID int64) (*model.Rental, error) {
+	q := `SELECT` + rentalColumns + `
+		FROM rentals
+		WHERE id = $1
+		FOR UPDATE`
+	return scanRental(tx.QueryRowContext(ctx, q, rentalID))
+}
+
+func (r *repo) SetInvoice(ctx context.Context, tx *sql.Tx, rentalID int64, invoiceID string) error {
 	const q = `
-		INSERT INTO rentals (user_id, book_id, item_id, price, status, hold_until)
-		VALUES ($1, $2, $3, $4, 'ACTIVE', $5)`
-	_, err := tx.ExecContext(ctx, q, userID, bookID, itemID, price, holdUntil)
+		UPDATE rentals
+		SET xendit_invoice_id = $2
+		WHERE id = $1`
+	_, err := tx.ExecContext(ctx, q, rentalID, invoiceID)
+	return err
+}
+
+// CreateOrder groups rentals booked together in one checkout.
+func (r *repo) CreateOrder(ctx context.Context, tx *sql.Tx, userID int64, total model.Money) (int64, error) {
+	const q = `
+		INSERT INTO rental_orders (user_id, total)
+		VALUES ($1, $2)
+		RETURNING id`
+	var id int64
+	err := tx.QueryRowContext(ctx, q, userID, total).Scan(&id)
+	return id, err
+}
+
+func (r *repo) AttachToOrder(ctx context.Context, tx *sql.Tx, orderID int64, rentalIDs []int64) error {
+	const q = `
+		UPDATE rentals
+		SET order_id = $1
+		WHERE id = ANY($2)`
+	_, err := tx.ExecContext(ctx, q, orderID, rentalIDs)
+	return err
+}
+
+// stampColumn is the timestamp recorded when a rental enters a status.
+var stampColumn = map[model.RentalStatus]string{
+	model.RentalPaid:     "paid_at",
+	model.RentalActive:   "activated_at",
+	model.RentalReturned: "returned_at",
+	model.RentalCanceled: "canceled_at",
+	model.RentalLost:     "lost_at",
+}
+
+// Transition moves a rental from one status to another and stamps the
+// matching timestamp column. Legality of the move is the service's job.
+func (r *repo) Transition(ctx context.Context, tx *sql.Tx, rentalID int64, from, to model.RentalStatus) error {
+	col, ok := stampColumn[to]
+	if !ok {
+		return fmt.Errorf("no transition into %s", to)
+	}
+	q := fmt.Sprintf(`
+		UPDATE rentals
+		SET status = $3,
+			%s = NOW()
+		WHERE id = $1
+		AND status = $2`, col)
+	res, err := tx.ExecContext(ctx, q, rentalID, string(from), string(to))
 	if err != nil {
 		return err
 	}
-	// mark item as RENTED
-	const q2 = `
-		UPDATE book_items
-		SET status = 'RENTED'
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrStatusChanged
+	}
+	return nil
+}
+
+// LockExpiredHolds locks up to limit BOOKED rentals whose payment window has
+// passed. SKIP LOCKED lets several sweepers run side by side without
+// touching the same rows.
+func (r *repo) LockExpiredHolds(ctx context.Context, tx *sql.Tx, limit int) ([]model.Rental, error) {
+	q := `SELECT` + rentalColumns + `
+		FROM rentals
+		WHERE status = 'BOOKED'
+		AND payment_due_at < NOW()
+		ORDER BY payment_due_at
+		FOR UPDATE SKIP LOCKED
+		LIMIT $1`
+	rows, err := tx.QueryContext(ctx, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectRentals(rows)
+}
+
+// LockMissedPickups claims PAID rentals whose pickup slot has ended without
+// the copy being collected.
+func (r *repo) LockMissedPickups(ctx context.Context, tx *sql.Tx, limit int) ([]model.Rental, error) {
+	q := `SELECT` + rentalColumns + `
+		FROM rentals
+		WHERE status = 'PAID'
+		AND pickup_slot_id IN (SELECT id FROM pickup_slots WHERE ends_at < NOW())
+		ORDER BY id
+		FOR UPDATE SKIP LOCKED
+		LIMIT $1`
+	rows, err := tx.QueryContext(ctx, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectRentals(rows)
+}
+
+// StartLoan sets due_at from the book's rental period, counted from now.
+func (r *repo) StartLoan(ctx context.Context, tx *sql.Tx, rentalID int64) (time.Time, error) {
+	const q = `
+		UPDATE rentals r
+		SET due_at = NOW() + make_interval(days => b.rental_days)
+		FROM books b
+		WHERE b.id = r.book_id
+		AND r.id = $1
+		RETURNING r.due_at`
+	var due time.Time
+	err := tx.QueryRowContext(ctx, q, rentalID).Scan(&due)
+	return due, err
+}
+
+func (r *repo) SetLateFee(ctx context.Context, tx *sql.Tx, rentalID int64, fee model.Money) error {
+	const q = `
+		UPDATE rentals
+		SET late_fee = $2
 		WHERE id = $1`
-	_, err = tx.ExecContext(ctx, q2, itemID)
+	_, err := tx.ExecContext(ctx, q, rentalID, fee)
 	return err
 }
 
-func (r *repo) GetRentalOwnerAndStatus(ctx context.Context, tx *sql.Tx, rentalID int64) (int64, string, int64, error) {
+// Extend pushes due_at out by days and counts the renewal.
+func (r *repo) Extend(ctx context.Context, tx *sql.Tx, rentalID int64, days int) (time.Time, error) {
 	const q = `
-		SELECT user_id, status, book_id
-		FROM rentals
+		UPDATE rentals
+		SET due_at = due_at + make_interval(days => $2),
+			renewal_count = renewal_count + 1
 		WHERE id = $1
-		FOR UPDATE`
-	var uid int64
-	var status string
-	var itemID int64
-	err := tx.QueryRowContext(ctx, q, rentalID).Scan(&uid, &status, &itemID)
-	return uid, status, itemID, err
+		RETURNING due_at`
+	var due time.Time
+	err := tx.QueryRowContext(ctx, q, rentalID, days).Scan(&due)
+	return due, err
+}
+
+// Pickup slots
+
+// slotBooked counts the rentals holding a slot; canceled ones give it back.
+const slotBooked = `(SELECT COUNT(*) FROM rentals r WHERE r.pickup_slot_id = s.id AND r.status <> 'CANCELED')`
+
+func (r *repo) CreateSlot(ctx context.Context, branch string, startsAt, endsAt time.Time, capacity int) (int64, error) {
+	const q = `
+		INSERT INTO pickup_slots (branch, starts_at, ends_at, capacity)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`
+	var id int64
+	err := r.db.QueryRowContext(ctx, q, branch, startsAt, endsAt, capacity).Scan(&id)
+	return id, err
+}
+
+// LockSlot locks a slot row so capacity checks and claims serialize.
+func (r *repo) LockSlot(ctx context.Context, tx *sql.Tx, slotID int64) (*model.PickupSlot, error) {
+	q := `
+		SELECT s.id, s.branch, s.starts_at, s.ends_at, s.capacity, ` + slotBooked + `
+		FROM pickup_slots s
+		WHERE s.id = $1
+		FOR UPDATE OF s`
+	var m model.PickupSlot
+	err := tx.QueryRowContext(ctx, q, slotID).Scan(&m.ID, &m.Branch, &m.StartsAt, &m.EndsAt, &m.Capacity, &m.Booked)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
 }
 
-func (r *repo) MarkReturned(ctx context.Context, tx *sql.Tx, rentalID int64) error {
+func (r *repo) SetPickupSlot(ctx context.Context, tx *sql.Tx, rentalID, slotID int64) error {
 	const q = `
 		UPDATE rentals
-		SET status = 'RETURNED',
-			returned_at = NOW()
+		SET pickup_slot_id = $2
 		WHERE id = $1`
-	_, err := tx.ExecContext(ctx, q, rentalID)
+	_, err := tx.ExecContext(ctx, q, rentalID, slotID)
 	return err
 }
 
-func (r *repo) FreeCopy(ctx context.Context, tx *sql.Tx, itemID int64) error {
+// FreeSlots lists upcoming slots with room left at branches that have an
+// available copy of the book.
+func (r *repo) FreeSlots(ctx context.Context, bookID int64) ([]model.PickupSlot, error) {
+	q := `
+		SELECT id, branch, starts_at, ends_at, capacity, booked
+		FROM (
+			SELECT s.id, s.branch, s.starts_at, s.ends_at, s.capacity, ` + slotBooked + ` AS booked
+			FROM pickup_slots s
+			WHERE s.ends_at > NOW()
+			AND EXISTS (
+				SELECT 1 FROM book_items bi
+				WHERE bi.book_id = $1
+				AND bi.branch = s.branch
+				AND bi.status = 'AVAILABLE'
+			)
+		) t
+		WHERE booked < capacity
+		ORDER BY starts_at, branch`
+	rows, err := r.db.QueryContext(ctx, q, bookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.PickupSlot
+	for rows.Next() {
+		var m model.PickupSlot
+		if err := rows.Scan(&m.ID, &m.Branch, &m.StartsAt, &m.EndsAt, &m.Capacity, &m.Booked); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// Admin
+
+// ListRentals returns rentals matching f, newest first.
+func (r *repo) ListRentals(ctx context.Context, f RentalFilter) ([]model.Rental, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Status != "" {
+		add("status = $%d", string(f.Status))
+	}
+	if f.UserID > 0 {
+		add("user_id = $%d", f.UserID)
+	}
+	if f.BookID > 0 {
+		add("book_id = $%d", f.BookID)
+	}
+	if f.From != nil {
+		add("booked_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("booked_at < $%d", *f.To)
+	}
+	if f.Overdue {
+		where = append(where, "status = 'ACTIVE' AND due_at < NOW()")
+	}
+
+	q := `SELECT` + rentalColumns + `
+		FROM rentals`
+	if len(where) > 0 {
+		q += "\n\t\tWHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit, f.Offset)
+	q += fmt.Sprintf("\n\t\tORDER BY booked_at DESC, id DESC\n\t\tLIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectRentals(rows)
+}
+
+func (r *repo) LogAdminAction(ctx context.Context, tx *sql.Tx, rentalID, adminID int64, action, reason string, amount model.Money) error {
 	const q = `
-		UPDATE book_items
-		SET status = 'AVAILABLE',
-			booked_until = NULL
+		INSERT INTO rental_admin_actions (rental_id, admin_id, action, reason, amount)
+		VALUES ($1, $2, $3, $4, $5)`
+	_, err := tx.ExecContext(ctx, q, rentalID, adminID, action, reason, amount)
+	return err
+}
+
+// Waitlist
+
+// LockBook takes the book row exclusively for someone joining its queue.
+// It waits for every tx holding ShareLockBook, so a copy freed concurrently
+// is either counted as available or sees the new entry, never neither.
+func (r *repo) LockBook(ctx context.Context, tx *sql.Tx, bookID int64) error {
+	const q = `
+		SELECT id
+		FROM books
+		WHERE id = $1
+		FOR NO KEY UPDATE`
+	var id int64
+	return tx.QueryRowContext(ctx, q, bookID).Scan(&id)
+}
+
+// ShareLockBook is taken while a copy of bookID is freed and offered to the
+// queue. Any number of these run side by side; only LockBook waits on them.
+func (r *repo) ShareLockBook(ctx context.Context, tx *sql.Tx, bookID int64) error {
+	const q = `
+		SELECT id
+		FROM books
+		WHERE id = $1
+		FOR SHARE`
+	var id int64
+	return tx.QueryRowContext(ctx, q, bookID).Scan(&id)
+}
+
+func (r *repo) CountAvailable(ctx context.Context, tx *sql.Tx, bookID int64) (int64, error) {
+	const q = `
+			SELECT COUNT(*)
+			FROM book_items
+			WHERE book_id = $1
+			AND status = 'AVAILABLE'`
+	var n int64
+	err := tx.QueryRowContext(ctx, q, bookID).Scan(&n)
+	return n, err
+}
+
+func (r *repo) JoinWaitlist(ctx context.Context, tx *sql.Tx, bookID, userID int64) (int64, error) {
+	const q = `
+		INSERT INTO book_waitlist (book_id, user_id)
+		VALUES ($1, $2)
+		RETURNING id`
+	var id int64
+	err := tx.QueryRowContext(ctx, q, bookID, userID).Scan(&id)
+	return id, err
+}
+
+func (r *repo) LeaveWaitlist(ctx context.Context, bookID, userID int64) (bool, error) {
+	const q = `
+		UPDATE book_waitlist
+		SET status = 'LEFT'
+		WHERE book_id = $1
+		AND user_id = $2
+		AND status = 'WAITING'`
+	res, err := r.db.ExecContext(ctx, q, bookID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// MyWaitlist lists the user's open entries with their 1-based place in line.
+func (r *repo) MyWaitlist(ctx context.Context, userID int64) ([]WaitlistRow, error) {
+	const q = `
+		SELECT w.id, w.book_id, b.name,
+			(SELECT COUNT(*)
+			 FROM book_waitlist ahead
+			 WHERE ahead.book_id = w.book_id
+			 AND ahead.status = 'WAITING'
+			 AND ahead.id <= w.id) AS position,
+			w.created_at
+		FROM book_waitlist w
+		JOIN books b ON b.id = w.book_id
+		WHERE w.user_id = $1
+		AND w.status = 'WAITING'
+		ORDER BY w.created_at`
+	rows, err := r.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []WaitlistRow
+	for rows.Next() {
+		var w WaitlistRow
+		if err := rows.Scan(&w.EntryID, &w.BookID, &w.BookName, &w.Position, &w.JoinedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// LockNextWaiting claims the oldest WAITING entry for bookID.
+func (r *repo) LockNextWaiting(ctx context.Context, tx *sql.Tx, bookID int64) (int64, int64, error) {
+	const q = `
+		SELECT id, user_id
+		FROM book_waitlist
+		WHERE book_id = $1
+		AND status = 'WAITING'
+		ORDER BY id
+		FOR UPDATE SKIP LOCKED
+		LIMIT 1`
+	var id, uid int64
+	err := tx.QueryRowContext(ctx, q, bookID).Scan(&id, &uid)
+	return id, uid, err
+}
+
+func (r *repo) FulfillWaiting(ctx context.Context, tx *sql.Tx, entryID, rentalID int64) error {
+	const q = `
+		UPDATE book_waitlist
+		SET status = 'FULFILLED',
+			rental_id = $2,
+			fulfilled_at = NOW()
 		WHERE id = $1`
-	_, err := tx.ExecContext(ctx, q, itemID)
+	_, err := tx.ExecContext(ctx, q, entryID, rentalID)
+	return err
+}
+
+// SkipWaiting takes an entry out of the queue when its user may not borrow
+// the copy they were next in line for.
+func (r *repo) SkipWaiting(ctx context.Context, tx *sql.Tx, entryID int64) error {
+	const q = `
+		UPDATE book_waitlist
+		SET status = 'SKIPPED'
+		WHERE id = $1`
+	_, err := tx.ExecContext(ctx, q, entryID)
 	return err
 }
 
@@ -170,18 +792,21 @@ func (r *repo) FreeCopy(ctx context.Context, tx *sql.Tx, itemID int64) error {
 func (r *repo) ListMyRentals(ctx context.Context, userID int64) ([]HistoryRow, error) {
 	const q = `
 			SELECT
-			r.id          AS rental_id,
-			r.book_id     AS book_id,
-			b.name        AS book_name,
-			r.item_id     AS item_id,
-			r.price       AS price,
-			r.status      AS status,
-			r.created_at  AS created_at,
-			r.returned_at AS returned_at
+			r.id           AS rental_id,
+			r.book_id      AS book_id,
+			b.name         AS book_name,
+			r.book_item_id AS item_id,
+			r.rental_cost  AS price,
+			r.status       AS status,
+			r.booked_at    AS created_at,
+			r.due_at       AS due_at,
+			(r.status = 'ACTIVE' AND r.due_at < NOW()) AS overdue,
+			r.late_fee     AS late_fee,
+			r.returned_at  AS returned_at
 			FROM rentals r
 			JOIN books b ON b.id = r.book_id
 			WHERE r.user_id = $1
-			ORDER BY r.created_at DESC, r.id DESC`
+			ORDER BY r.booked_at DESC, r.id DESC`
 	rows, err := r.db.QueryContext(ctx, q, userID)
 	if err != nil {
 		return nil, err
@@ -193,7 +818,7 @@ func (r *repo) ListMyRentals(ctx context.Context, userID int64) ([]HistoryRow, e
 		var h HistoryRow
 		if err := rows.Scan(
 			&h.RentalID, &h.BookID, &h.BookName, &h.ItemID,
-			&h.Price, &h.Status, &h.CreatedAt, &h.ReturnedAt,
+			&h.Price, &h.Status, &h.CreatedAt, &h.DueAt, &h.Overdue, &h.LateFee, &h.ReturnedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -201,14 +826,3 @@ func (r *repo) ListMyRentals(ctx context.Context, userID int64) ([]HistoryRow, e
 	}
 	return out, rows.Err()
 }
-func (r *repo) InsertRentalReturningID(ctx context.Context, tx *sql.Tx, userID, bookID int64, price float64) (int64, error) {
-	const q = `
-		INSERT INTO public.rentals (user_id, book_id, status, price)
-		VALUES ($1, $2, 'ACTIVE', $3)
-		RETURNING id`
-	var id int64
-	if err := tx.QueryRowContext(ctx, q, userID, bookID, price).Scan(&id); err != nil {
-		return 0, err
-	}
-	return id, nil
-}
@@ -0,0 +1,109 @@
+package walletrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"bookrental/model"
+)
+
+const voucherColumns = `
+SELECT id, code, kind, amount, percent, min_topup, starts_at, expires_at,
+       max_uses, per_user_limit, uses, active, created_by, created_at
+FROM vouchers`
+
+func scanVoucher(row interface{ Scan(...any) error }) (*model.Voucher, error) {
+	var v model.Voucher
+	if err := row.Scan(&v.ID, &v.Code, &v.Kind, &v.Amount, &v.Percent, &v.MinTopup, &v.StartsAt, &v.ExpiresAt,
+		&v.MaxUses, &v.PerUserLimit, &v.Uses, &v.Active, &v.CreatedBy, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func collectVouchers(rows *sql.Rows) ([]model.Voucher, error) {
+	defer rows.Close()
+	out := []model.Voucher{}
+	for rows.Next() {
+		v, err := scanVoucher(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *v)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) CreateVoucher(ctx context.Context, v *model.Voucher) (int64, error) {
+	const q = `
+INSERT INTO vouchers (code, kind, amount, percent, min_topup, starts_at, expires_at, max_uses, per_user_limit, created_by)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+RETURNING id, uses, active, created_at`
+	err := r.db.QueryRowContext(ctx, q, v.Code, v.Kind, v.Amount, v.Percent, v.MinTopup, v.StartsAt, v.ExpiresAt,
+		v.MaxUses, v.PerUserLimit, v.CreatedBy).Scan(&v.ID, &v.Uses, &v.Active, &v.CreatedAt)
+	return v.ID, err
+}
+
+func (r *repo) ListVouchers(ctx context.Context) ([]model.Voucher, error) {
+	rows, err := r.db.QueryContext(ctx, voucherColumns+`
+ORDER BY id DESC
+LIMIT 200`)
+	if err != nil {
+		return nil, err
+	}
+	return collectVouchers(rows)
+}
+
+func (r *repo) LockVoucherByCode(ctx context.Context, tx *sql.Tx, code string) (*model.Voucher, error) {
+	return scanVoucher(tx.QueryRowContext(ctx, voucherColumns+`
+WHERE code=$1
+FOR UPDATE`, code))
+}
+
+// UserRedemptions counts how often userID has used the voucher.
+func (r *repo) UserRedemptions(ctx context.Context, tx *sql.Tx, voucherID, userID int64) (int, error) {
+	var n int
+	err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM voucher_redemptions WHERE voucher_id=$1 AND user_id=$2`,
+		voucherID, userID).Scan(&n)
+	return n, err
+}
+
+// InsertRedemption records one use of a voucher. The use itself is counted
+// by ClaimVoucherUse.
+func (r *repo) InsertRedemption(ctx context.Context, tx *sql.Tx, voucherID, userID int64, amount model.Money, topupID *int64) (int64, error) {
+	const q = `
+INSERT INTO voucher_redemptions (voucher_id, user_id, amount, topup_id)
+VALUES ($1,$2,$3,$4)
+RETURNING id`
+	var id int64
+	err := tx.QueryRowContext(ctx, q, voucherID, userID, amount, topupID).Scan(&id)
+	return id, err
+}
+
+// ClaimVoucherUse counts one use of an active voucher if its overall cap
+// allows it, and reports whether it did. The conditional update is the
+// only lock taken, so concurrent claims cannot overshoot max_uses.
+func (r *repo) ClaimVoucherUse(ctx context.Context, tx *sql.Tx, voucherID int64) (bool, error) {
+	const q = `
+UPDATE vouchers SET uses = uses + 1
+WHERE id=$1 AND active AND (max_uses = 0 OR uses < max_uses)`
+	res, err := tx.ExecContext(ctx, q, voucherID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ListTopupCampaigns returns the active TOPUP_BONUS vouchers, unlocked;
+// the wallet service decides which apply to a top-up.
+func (r *repo) ListTopupCampaigns(ctx context.Context, tx *sql.Tx) ([]model.Voucher, error) {
+	rows, err := tx.QueryContext(ctx, voucherColumns+`
+WHERE kind='TOPUP_BONUS' AND active
+ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return collectVouchers(rows)
+}
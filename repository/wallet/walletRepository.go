@@ -4,34 +4,125 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
+
+	"bookrental/model"
 )
 
 type LedgerRow struct {
-	ID           int64
-	EntryType    string
-	Amount       float64
-	BalanceAfter float64
-	CreatedAt    time.Time
+	ID           int64       `json:"id"`
+	EntryType    string      `json:"entry_type"`
+	RefTable     string      `json:"ref_table"`
+	RefID        *int64      `json:"ref_id"`
+	Amount       model.Money `json:"amount"`
+	BalanceAfter model.Money `json:"balance_after"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// LedgerFilter narrows ListLedger. Rows come newest first; Before is the
+// cursor (only ids below it) and To is exclusive.
+type LedgerFilter struct {
+	UserID    int64
+	EntryType string
+	RefTable  string
+	From, To  *time.Time
+	Before    int64
+	Limit     int
 }
 
 type Repo interface {
-	InsertTopup(ctx context.Context, tx *sql.Tx, userID int64, amount float64, invID, link, expires string) (int64, error)
-	ListLedger(ctx context.Context, userID int64) ([]LedgerRow, error)
+	InsertTopup(ctx context.Context, tx *sql.Tx, userID int64, amount model.Money, invID, link, expires string) (int64, error)
+	ListLedger(ctx context.Context, f LedgerFilter) ([]LedgerRow, error)
+	ListLedgerPeriod(ctx context.Context, userID int64, from, to time.Time) ([]LedgerRow, error)
+	PeriodBalances(ctx context.Context, userID int64, from, to *time.Time) (opening, closing model.Money, err error)
+	ListRentalLedger(ctx context.Context, rentalID int64) ([]LedgerRow, error)
+
+	GetBalance(ctx context.Context, userID int64) (model.Money, error)
+	PendingTopups(ctx context.Context, userID int64) (count int, total model.Money, err error)
+	HeldForBookings(ctx context.Context, userID int64) (count int, total model.Money, err error)
+	LedgerTotals(ctx context.Context, userID int64) (map[string]model.Money, error)
+
+	FindTopupByInvoiceID(ctx context.Context, invoiceID string) (topupID int64, userID int64, amount model.Money, status string, err error)
+	MarkTopupPaidAndCredit(ctx context.Context, tx *sql.Tx, topupID, userID int64, amount model.Money) (model.Money, error)
+	FinishTopup(ctx context.Context, topupID int64, status model.TopupStatus) (bool, error)
+	ExpireTopups(ctx context.Context, grace time.Duration) (int, error)
+	ListTopups(ctx context.Context, userID int64) ([]model.WalletTopup, error)
+	ListTopupsToReconcile(ctx context.Context, minAge, lookback time.Duration) ([]model.WalletTopup, error)
+	GetTopup(ctx context.Context, id int64) (*model.WalletTopup, error)
+
+	GetUserBalanceForUpdate(ctx context.Context, tx *sql.Tx, userID int64) (model.Money, error)
+	UpdateUserBalance(ctx context.Context, tx *sql.Tx, userID int64, newBalance model.Money) error
+	InsertLedger(ctx context.Context, tx *sql.Tx, userID int64, refTable string, refID *int64, entryType string, amount model.Money, balanceAfter model.Money) error
+	NetRentalCharge(ctx context.Context, tx *sql.Tx, rentalID int64) (model.Money, error)
+	HasRentalEntry(ctx context.Context, tx *sql.Tx, rentalID int64, entryType string) (bool, error)
+	OutstandingRentalFees(ctx context.Context, tx *sql.Tx, rentalID int64) (model.Money, error)
+
+	InsertWithdrawal(ctx context.Context, tx *sql.Tx, w *model.WalletWithdrawal) (int64, error)
+	SetWithdrawalDisbursement(ctx context.Context, id int64, disbursementID string) error
+	LockWithdrawal(ctx context.Context, tx *sql.Tx, id int64) (*model.WalletWithdrawal, error)
+	FinishWithdrawal(ctx context.Context, tx *sql.Tx, id int64, status model.WithdrawalStatus, disbursementID, failureReason string) error
+	CompleteReversedWithdrawal(ctx context.Context, tx *sql.Tx, id int64, disbursementID, note string) error
+	ListUnsentWithdrawals(ctx context.Context, olderThan time.Duration, limit int) ([]model.WalletWithdrawal, error)
+	ListWithdrawals(ctx context.Context, userID int64) ([]model.WalletWithdrawal, error)
+
+	InsertAdjustment(ctx context.Context, tx *sql.Tx, a *model.WalletAdjustment) (int64, error)
+	LockAdjustment(ctx context.Context, tx *sql.Tx, id int64) (*model.WalletAdjustment, error)
+	DecideAdjustment(ctx context.Context, tx *sql.Tx, a *model.WalletAdjustment, status model.AdjustmentStatus, adminID int64) error
+	ListAdjustments(ctx context.Context, status model.AdjustmentStatus) ([]model.WalletAdjustment, error)
+
+	UserIDByUsername(ctx context.Context, username string) (int64, error)
+	InsertTransfer(ctx context.Context, tx *sql.Tx, t *model.WalletTransfer) (int64, error)
+	TransferredSince(ctx context.Context, tx *sql.Tx, userID int64, since time.Time) (model.Money, error)
+	ListTransfers(ctx context.Context, userID int64) ([]model.WalletTransfer, error)
 
-	FindTopupByInvoiceID(ctx context.Context, invoiceID string) (topupID int64, userID int64, amount float64, status string, err error)
-	MarkTopupPaidAndCredit(ctx context.Context, tx *sql.Tx, topupID, userID int64, amount float64) error
+	CreateVoucher(ctx context.Context, v *model.Voucher) (int64, error)
+	ListVouchers(ctx context.Context) ([]model.Voucher, error)
+	LockVoucherByCode(ctx context.Context, tx *sql.Tx, code string) (*model.Voucher, error)
+	UserRedemptions(ctx context.Context, tx *sql.Tx, voucherID, userID int64) (int, error)
+	InsertRedemption(ctx context.Context, tx *sql.Tx, voucherID, userID int64, amount model.Money, topupID *int64) (int64, error)
+	ClaimVoucherUse(ctx context.Context, tx *sql.Tx, voucherID int64) (bool, error)
+	ListTopupCampaigns(ctx context.Context, tx *sql.Tx) ([]model.Voucher, error)
 
-	GetUserBalanceForUpdate(ctx context.Context, tx *sql.Tx, userID int64) (float64, error)
-	UpdateUserBalance(ctx context.Context, tx *sql.Tx, userID int64, newBalance float64) error
-	InsertLedger(ctx context.Context, tx *sql.Tx, userID int64, refTable string, refID *int64, entryType string, amount float64, balanceAfter float64) error
+	VerifyJournal(ctx context.Context) (*JournalReport, error)
+}
+
+// Journal accounts. USER_WALLET lines carry the user's id; the rest are
+// house accounts.
+const (
+	AccountUserWallet = "USER_WALLET"
+	AccountRevenue    = "REVENUE"
+	AccountClearing   = "GATEWAY_CLEARING"
+	AccountFees       = "FEES"
+	AccountTransfers  = "TRANSFER_CLEARING"
+	AccountMarketing  = "MARKETING"
+)
+
+// counterAccount is the house account on the other side of each ledger
+// type. A ledger type missing here cannot be posted.
+var counterAccount = map[string]string{
+	string(model.LedgerTopup):   AccountClearing,
+	string(model.LedgerCharge):  AccountRevenue,
+	string(model.LedgerRefund):  AccountRevenue,
+	string(model.LedgerAdjust):  AccountRevenue,
+	string(model.LedgerLate):    AccountFees,
+	string(model.LedgerReplace): AccountFees,
+	string(model.LedgerWaiver):  AccountFees,
+
+	string(model.LedgerWithdraw):       AccountClearing,
+	string(model.LedgerWithdrawRevert): AccountClearing,
+	string(model.LedgerTransferOut):    AccountTransfers,
+	string(model.LedgerTransferIn):     AccountTransfers,
+	string(model.LedgerVoucher):        AccountMarketing,
+	string(model.LedgerTopupBonus):     AccountMarketing,
 }
 
 type repo struct{ db *sql.DB }
 
 func New(db *sql.DB) Repo { return &repo{db} }
 
-func (r *repo) InsertTopup(ctx context.Context, tx *sql.Tx, userID int64, amount float64, invID, link, expires string) (int64, error) {
+func (r *repo) InsertTopup(ctx context.Context, tx *sql.Tx, userID int64, amount model.Money, invID, link, expires string) (int64, error) {
 	const q = `
 INSERT INTO wallet_topups (user_id, amount, status, xendit_invoice_id, payment_link, expires_at)
 VALUES ($1,$2,'PENDING',$3,$4,$5)
@@ -43,22 +134,132 @@ RETURNING id`
 	return id, nil
 }
 
-func (r *repo) ListLedger(ctx context.Context, userID int64) ([]LedgerRow, error) {
+const ledgerColumns = `
+SELECT id, entry_type, COALESCE(ref_table, ''), ref_id, amount, balance_after, created_at
+FROM wallet_ledger`
+
+func (r *repo) ListLedger(ctx context.Context, f LedgerFilter) ([]LedgerRow, error) {
+	where := []string{"user_id = $1"}
+	args := []any{f.UserID}
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.EntryType != "" {
+		add("entry_type = $%d", f.EntryType)
+	}
+	if f.RefTable != "" {
+		add("ref_table = $%d", f.RefTable)
+	}
+	if f.From != nil {
+		add("created_at >= $%d", *f.From)
+	}
+	if f.To != nil {
+		add("created_at < $%d", *f.To)
+	}
+	if f.Before > 0 {
+		add("id < $%d", f.Before)
+	}
+	args = append(args, f.Limit)
+	q := ledgerColumns + "\nWHERE " + strings.Join(where, " AND ") +
+		fmt.Sprintf("\nORDER BY id DESC\nLIMIT $%d", len(args))
+
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectLedger(rows)
+}
+
+// ListLedgerPeriod returns every line in [from, to), oldest first.
+func (r *repo) ListLedgerPeriod(ctx context.Context, userID int64, from, to time.Time) ([]LedgerRow, error) {
+	const q = ledgerColumns + `
+WHERE user_id=$1 AND created_at >= $2 AND created_at < $3
+ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, q, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return collectLedger(rows)
+}
+
+// PeriodBalances returns the user's balance at the start and end of a
+// period, summed from the journal. A nil from opens at zero; a nil to
+// closes at the current balance.
+func (r *repo) PeriodBalances(ctx context.Context, userID int64, from, to *time.Time) (opening, closing model.Money, err error) {
 	const q = `
-SELECT id, entry_type, amount, balance_after, created_at
+SELECT
+	COALESCE(SUM(jl.amount) FILTER (WHERE e.created_at < $2::timestamptz), 0),
+	COALESCE(SUM(jl.amount) FILTER (WHERE $3::timestamptz IS NULL OR e.created_at < $3::timestamptz), 0)
+FROM journal_lines jl
+JOIN journal_entries e ON e.id = jl.entry_id
+WHERE jl.account = 'USER_WALLET' AND jl.user_id = $1`
+	err = r.db.QueryRowContext(ctx, q, userID, from, to).Scan(&opening, &closing)
+	return opening, closing, err
+}
+
+func (r *repo) GetBalance(ctx context.Context, userID int64) (model.Money, error) {
+	var bal model.Money
+	err := r.db.QueryRowContext(ctx, `SELECT deposit_balance FROM users WHERE id=$1`, userID).Scan(&bal)
+	return bal, err
+}
+
+// PendingTopups counts top-ups still waiting on payment and not yet past
+// their invoice expiry.
+func (r *repo) PendingTopups(ctx context.Context, userID int64) (count int, total model.Money, err error) {
+	const q = `
+SELECT COUNT(*), COALESCE(SUM(amount), 0)
+FROM wallet_topups
+WHERE user_id=$1 AND status='PENDING' AND (expires_at IS NULL OR expires_at > NOW())`
+	err = r.db.QueryRowContext(ctx, q, userID).Scan(&count, &total)
+	return count, total, err
+}
+
+// HeldForBookings sums the rental cost of BOOKED rentals: copies on hold
+// whose charge will be taken from the deposit. Rentals booked with an
+// invoice are paid through Xendit, not the wallet, and are left out.
+func (r *repo) HeldForBookings(ctx context.Context, userID int64) (count int, total model.Money, err error) {
+	const q = `
+SELECT COUNT(*), COALESCE(SUM(rental_cost), 0)
+FROM rentals
+WHERE user_id=$1 AND status='BOOKED' AND xendit_invoice_id IS NULL`
+	err = r.db.QueryRowContext(ctx, q, userID).Scan(&count, &total)
+	return count, total, err
+}
+
+// LedgerTotals sums every ledger line the user ever had, by entry type.
+func (r *repo) LedgerTotals(ctx context.Context, userID int64) (map[string]model.Money, error) {
+	const q = `
+SELECT entry_type, SUM(amount)
 FROM wallet_ledger
 WHERE user_id=$1
-ORDER BY created_at DESC`
+GROUP BY entry_type`
 	rows, err := r.db.QueryContext(ctx, q, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	out := map[string]model.Money{}
+	for rows.Next() {
+		var (
+			t   string
+			sum model.Money
+		)
+		if err := rows.Scan(&t, &sum); err != nil {
+			return nil, err
+		}
+		out[t] = sum
+	}
+	return out, rows.Err()
+}
+
+func collectLedger(rows *sql.Rows) ([]LedgerRow, error) {
+	defer rows.Close()
 	var out []LedgerRow
 	for rows.Next() {
 		var l LedgerRow
-		if err := rows.Scan(&l.ID, &l.EntryType, &l.Amount, &l.BalanceAfter, &l.CreatedAt); err != nil {
+		if err := rows.Scan(&l.ID, &l.EntryType, &l.RefTable, &l.RefID, &l.Amount, &l.BalanceAfter, &l.CreatedAt); err != nil {
 			return nil, err
 		}
 		out = append(out, l)
@@ -66,68 +267,636 @@ ORDER BY created_at DESC`
 	return out, rows.Err()
 }
 
-func (r *repo) FindTopupByInvoiceID(ctx context.Context, invoiceID string) (int64, int64, float64, string, error) {
+// ListRentalLedger returns the lines posted against a rental, oldest first.
+func (r *repo) ListRentalLedger(ctx context.Context, rentalID int64) ([]LedgerRow, error) {
+	const q = ledgerColumns + `
+WHERE ref_table='rentals' AND ref_id=$1
+ORDER BY created_at, id`
+	rows, err := r.db.QueryContext(ctx, q, rentalID)
+	if err != nil {
+		return nil, err
+	}
+	return collectLedger(rows)
+}
+
+func (r *repo) FindTopupByInvoiceID(ctx context.Context, invoiceID string) (int64, int64, model.Money, string, error) {
 	const q = `
 SELECT id, user_id, amount, status
 FROM wallet_topups
 WHERE xendit_invoice_id=$1`
 	var id, uid int64
-	var amt float64
+	var amt model.Money
 	var status string
 	err := r.db.QueryRowContext(ctx, q, invoiceID).Scan(&id, &uid, &amt, &status)
 	return id, uid, amt, status, err
 }
 
-func (r *repo) MarkTopupPaidAndCredit(ctx context.Context, tx *sql.Tx, topupID, userID int64, amount float64) error {
-	//mark topup as PAID
+// MarkTopupPaidAndCredit marks the top-up PAID, credits it and returns the
+// new balance. The user row stays locked in tx.
+func (r *repo) MarkTopupPaidAndCredit(ctx context.Context, tx *sql.Tx, topupID, userID int64, amount model.Money) (model.Money, error) {
+	//mark topup as PAID; money that arrived wins over our own expiry
 	const q1 = `
 	UPDATE wallet_topups
 	SET status='PAID', paid_at=NOW()
-	WHERE id=$1 AND status='PENDING'`
+	WHERE id=$1 AND status IN ('PENDING','EXPIRED')`
 	res, err := tx.ExecContext(ctx, q1, topupID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if n, _ := res.RowsAffected(); n == 0 {
-		return errors.New("topup not pending or not found")
+		return 0, errors.New("topup not pending or not found")
 	}
 
 	//update user balance (credit)
-	var current float64
+	var current model.Money
 	const qBal = `SELECT deposit_balance FROM users WHERE id=$1 FOR UPDATE`
 	if err := tx.QueryRowContext(ctx, qBal, userID).Scan(&current); err != nil {
-		return err
+		return 0, err
 	}
 	newBal := current + amount
 
 	const qUp = `UPDATE users SET deposit_balance=$2 WHERE id=$1`
 	if _, err := tx.ExecContext(ctx, qUp, userID, newBal); err != nil {
-		return err
+		return 0, err
 	}
 
 	// ledger entry
-	return r.InsertLedger(ctx, tx, userID, "wallet_topups", &topupID, "TOPUP_CONFIRMED", amount, newBal)
+	if err := r.InsertLedger(ctx, tx, userID, "wallet_topups", &topupID, "TOPUP_CONFIRMED", amount, newBal); err != nil {
+		return 0, err
+	}
+	return newBal, nil
+}
+
+// FinishTopup moves a PENDING top-up to EXPIRED or FAILED. It reports
+// false when the top-up had already left PENDING.
+func (r *repo) FinishTopup(ctx context.Context, topupID int64, status model.TopupStatus) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE wallet_topups SET status=$2 WHERE id=$1 AND status='PENDING'`, topupID, status)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
 }
 
-func (r *repo) GetUserBalanceForUpdate(ctx context.Context, tx *sql.Tx, userID int64) (float64, error) {
+// ExpireTopups marks PENDING top-ups EXPIRED once their invoice expiry is
+// more than grace in the past. The grace covers clock skew with the
+// provider; a late PAID callback still settles an EXPIRED top-up.
+func (r *repo) ExpireTopups(ctx context.Context, grace time.Duration) (int, error) {
+	res, err := r.db.ExecContext(ctx, `
+UPDATE wallet_topups
+SET status='EXPIRED'
+WHERE status='PENDING' AND expires_at < $1`, time.Now().Add(-grace))
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+const topupColumns = `
+SELECT id, user_id, amount, status, xendit_invoice_id, payment_link, expires_at, paid_at, created_at
+FROM wallet_topups`
+
+func scanTopup(row interface{ Scan(...any) error }) (*model.WalletTopup, error) {
+	var t model.WalletTopup
+	if err := row.Scan(&t.ID, &t.UserID, &t.Amount, &t.Status, &t.XenditInvoiceID, &t.PaymentLink,
+		&t.ExpiresAt, &t.PaidAt, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListTopups returns the user's last 100 top-ups, newest first.
+func (r *repo) ListTopups(ctx context.Context, userID int64) ([]model.WalletTopup, error) {
+	rows, err := r.db.QueryContext(ctx, topupColumns+`
+WHERE user_id=$1
+ORDER BY id DESC
+LIMIT 100`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.WalletTopup{}
+	for rows.Next() {
+		t, err := scanTopup(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+// ListTopupsToReconcile returns top-ups whose outcome may have been lost:
+// PENDING ones older than minAge, and ones we EXPIRED ourselves within
+// lookback, which a missed PAID webhook could still be owed on.
+func (r *repo) ListTopupsToReconcile(ctx context.Context, minAge, lookback time.Duration) ([]model.WalletTopup, error) {
+	now := time.Now()
+	rows, err := r.db.QueryContext(ctx, topupColumns+`
+WHERE xendit_invoice_id IS NOT NULL
+  AND ((status='PENDING' AND created_at < $1) OR (status='EXPIRED' AND created_at > $2))
+ORDER BY id
+LIMIT 500`, now.Add(-minAge), now.Add(-lookback))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []model.WalletTopup
+	for rows.Next() {
+		t, err := scanTopup(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) GetTopup(ctx context.Context, id int64) (*model.WalletTopup, error) {
+	return scanTopup(r.db.QueryRowContext(ctx, topupColumns+`
+WHERE id=$1`, id))
+}
+
+func (r *repo) GetUserBalanceForUpdate(ctx context.Context, tx *sql.Tx, userID int64) (model.Money, error) {
 	const q = `SELECT deposit_balance FROM users WHERE id=$1 FOR UPDATE`
-	var bal float64
+	var bal model.Money
 	if err := tx.QueryRowContext(ctx, q, userID).Scan(&bal); err != nil {
 		return 0, err
 	}
 	return bal, nil
 }
 
-func (r *repo) UpdateUserBalance(ctx context.Context, tx *sql.Tx, userID int64, newBalance float64) error {
+func (r *repo) UpdateUserBalance(ctx context.Context, tx *sql.Tx, userID int64, newBalance model.Money) error {
 	const q = `UPDATE users SET deposit_balance=$2 WHERE id=$1`
 	_, err := tx.ExecContext(ctx, q, userID, newBalance)
 	return err
 }
 
-func (r *repo) InsertLedger(ctx context.Context, tx *sql.Tx, userID int64, refTable string, refID *int64, entryType string, amount float64, balanceAfter float64) error {
-	const q = `
+// InsertLedger records a movement on the user's wallet. The wallet_ledger
+// row is the user-facing statement line; the journal entry posted with it
+// is the book of record: a USER_WALLET line for the change in the user's
+// balance and an opposite line on the house account for entryType, so
+// every entry sums to zero.
+func (r *repo) InsertLedger(ctx context.Context, tx *sql.Tx, userID int64, refTable string, refID *int64, entryType string, amount model.Money, balanceAfter model.Money) error {
+	counter, ok := counterAccount[entryType]
+	if !ok {
+		return fmt.Errorf("no journal account for ledger type %s", entryType)
+	}
+
+	const qLedger = `
 INSERT INTO wallet_ledger (user_id, ref_table, ref_id, entry_type, amount, balance_after)
-VALUES ($1,$2,$3,$4,$5,$6)`
-	_, err := tx.ExecContext(ctx, q, userID, refTable, refID, entryType, amount, balanceAfter)
+VALUES ($1,$2,$3,$4,$5,$6)
+RETURNING id`
+	var ledgerID int64
+	if err := tx.QueryRowContext(ctx, qLedger, userID, refTable, refID, entryType, amount, balanceAfter).Scan(&ledgerID); err != nil {
+		return err
+	}
+
+	const qEntry = `
+INSERT INTO journal_entries (ledger_id, entry_type, ref_table, ref_id)
+VALUES ($1,$2,$3,$4)
+RETURNING id`
+	var entryID int64
+	if err := tx.QueryRowContext(ctx, qEntry, ledgerID, entryType, refTable, refID).Scan(&entryID); err != nil {
+		return err
+	}
+
+	const qLines = `
+INSERT INTO journal_lines (entry_id, account, user_id, amount)
+VALUES ($1,'USER_WALLET',$2,$3), ($1,$4,NULL,$5)`
+	_, err := tx.ExecContext(ctx, qLines, entryID, userID, amount, counter, -amount)
 	return err
 }
+
+// NetRentalCharge is what the user has paid for a rental and not yet been
+// refunded. Charges are stored negative and refunds positive.
+func (r *repo) NetRentalCharge(ctx context.Context, tx *sql.Tx, rentalID int64) (model.Money, error) {
+	const q = `
+SELECT COALESCE(-SUM(amount), 0)
+FROM wallet_ledger
+WHERE ref_table='rentals' AND ref_id=$1
+AND entry_type IN ('RENTAL_CHARGE','RENTAL_REFUND')`
+	var net model.Money
+	err := tx.QueryRowContext(ctx, q, rentalID).Scan(&net)
+	return net, err
+}
+
+// HasRentalEntry reports whether a ledger line of entryType already exists
+// for the rental; used to keep webhook replays from posting twice.
+func (r *repo) HasRentalEntry(ctx context.Context, tx *sql.Tx, rentalID int64, entryType string) (bool, error) {
+	const q = `
+SELECT EXISTS (
+	SELECT 1 FROM wallet_ledger
+	WHERE ref_table='rentals' AND ref_id=$1 AND entry_type=$2
+)`
+	var ok bool
+	err := tx.QueryRowContext(ctx, q, rentalID, entryType).Scan(&ok)
+	return ok, err
+}
+
+// OutstandingRentalFees is the late and replacement charges on a rental that
+// have not been waived yet. Charges are stored negative and waivers positive.
+func (r *repo) OutstandingRentalFees(ctx context.Context, tx *sql.Tx, rentalID int64) (model.Money, error) {
+	const q = `
+SELECT COALESCE(-SUM(amount), 0)
+FROM wallet_ledger
+WHERE ref_table='rentals' AND ref_id=$1
+AND entry_type IN ('LATE_FEE','REPLACEMENT_CHARGE','FEE_WAIVER')`
+	var fees model.Money
+	err := tx.QueryRowContext(ctx, q, rentalID).Scan(&fees)
+	return fees, err
+}
+
+const withdrawalColumns = `
+SELECT id, user_id, amount, status, bank_code, account_holder, account_number,
+       disbursement_id, failure_reason, created_at, settled_at
+FROM wallet_withdrawals`
+
+func scanWithdrawal(row interface{ Scan(...any) error }) (*model.WalletWithdrawal, error) {
+	var w model.WalletWithdrawal
+	if err := row.Scan(&w.ID, &w.UserID, &w.Amount, &w.Status, &w.BankCode, &w.AccountHolder, &w.AccountNumber,
+		&w.DisbursementID, &w.FailureReason, &w.CreatedAt, &w.SettledAt); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (r *repo) InsertWithdrawal(ctx context.Context, tx *sql.Tx, w *model.WalletWithdrawal) (int64, error) {
+	const q = `
+INSERT INTO wallet_withdrawals (user_id, amount, status, bank_code, account_holder, account_number)
+VALUES ($1,$2,'PENDING',$3,$4,$5)
+RETURNING id, created_at`
+	if err := tx.QueryRowContext(ctx, q, w.UserID, w.Amount, w.BankCode, w.AccountHolder, w.AccountNumber).Scan(&w.ID, &w.CreatedAt); err != nil {
+		return 0, err
+	}
+	return w.ID, nil
+}
+
+// SetWithdrawalDisbursement records the provider's id once the payout was
+// accepted. A callback may already have set it.
+func (r *repo) SetWithdrawalDisbursement(ctx context.Context, id int64, disbursementID string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE wallet_withdrawals SET disbursement_id=$2 WHERE id=$1 AND disbursement_id IS NULL`, id, disbursementID)
+	return err
+}
+
+func (r *repo) LockWithdrawal(ctx context.Context, tx *sql.Tx, id int64) (*model.WalletWithdrawal, error) {
+	return scanWithdrawal(tx.QueryRowContext(ctx, withdrawalColumns+`
+WHERE id=$1
+FOR UPDATE`, id))
+}
+
+// FinishWithdrawal moves a PENDING withdrawal to its final status. Empty
+// disbursementID or failureReason leave the stored values alone.
+func (r *repo) FinishWithdrawal(ctx context.Context, tx *sql.Tx, id int64, status model.WithdrawalStatus, disbursementID, failureReason string) error {
+	const q = `
+UPDATE wallet_withdrawals
+SET status=$2,
+    disbursement_id=COALESCE(disbursement_id, NULLIF($3,'')),
+    failure_reason=NULLIF($4,''),
+    settled_at=NOW()
+WHERE id=$1 AND status='PENDING'`
+	res, err := tx.ExecContext(ctx, q, id, status, disbursementID, failureReason)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("withdrawal %d is not pending", id)
+	}
+	return nil
+}
+
+// CompleteReversedWithdrawal marks a FAILED withdrawal COMPLETED after all,
+// keeping note in failure_reason so the history shows what happened.
+func (r *repo) CompleteReversedWithdrawal(ctx context.Context, tx *sql.Tx, id int64, disbursementID, note string) error {
+	const q = `
+UPDATE wallet_withdrawals
+SET status='COMPLETED',
+    disbursement_id=COALESCE(disbursement_id, NULLIF($2,'')),
+    failure_reason=$3,
+    settled_at=NOW()
+WHERE id=$1 AND status='FAILED'`
+	res, err := tx.ExecContext(ctx, q, id, disbursementID, note)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("withdrawal %d is not failed", id)
+	}
+	return nil
+}
+
+// ListUnsentWithdrawals returns PENDING withdrawals the provider has not
+// confirmed receiving, oldest first, once they are older than olderThan.
+func (r *repo) ListUnsentWithdrawals(ctx context.Context, olderThan time.Duration, limit int) ([]model.WalletWithdrawal, error) {
+	rows, err := r.db.QueryContext(ctx, withdrawalColumns+`
+WHERE status='PENDING' AND disbursement_id IS NULL AND created_at < $1
+ORDER BY id
+LIMIT $2`, time.Now().Add(-olderThan), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.WalletWithdrawal{}
+	for rows.Next() {
+		w, err := scanWithdrawal(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *w)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) ListWithdrawals(ctx context.Context, userID int64) ([]model.WalletWithdrawal, error) {
+	rows, err := r.db.QueryContext(ctx, withdrawalColumns+`
+WHERE user_id=$1
+ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.WalletWithdrawal{}
+	for rows.Next() {
+		w, err := scanWithdrawal(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *w)
+	}
+	return out, rows.Err()
+}
+
+const adjustmentColumns = `
+SELECT id, user_id, amount, reason, status, requested_by, decided_by, created_at, decided_at
+FROM wallet_adjustments`
+
+func scanAdjustment(row interface{ Scan(...any) error }) (*model.WalletAdjustment, error) {
+	var a model.WalletAdjustment
+	if err := row.Scan(&a.ID, &a.UserID, &a.Amount, &a.Reason, &a.Status, &a.RequestedBy, &a.DecidedBy, &a.CreatedAt, &a.DecidedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *repo) InsertAdjustment(ctx context.Context, tx *sql.Tx, a *model.WalletAdjustment) (int64, error) {
+	const q = `
+INSERT INTO wallet_adjustments (user_id, amount, reason, status, requested_by)
+VALUES ($1,$2,$3,$4,$5)
+RETURNING id, created_at`
+	if err := tx.QueryRowContext(ctx, q, a.UserID, a.Amount, a.Reason, a.Status, a.RequestedBy).Scan(&a.ID, &a.CreatedAt); err != nil {
+		return 0, err
+	}
+	return a.ID, nil
+}
+
+func (r *repo) LockAdjustment(ctx context.Context, tx *sql.Tx, id int64) (*model.WalletAdjustment, error) {
+	return scanAdjustment(tx.QueryRowContext(ctx, adjustmentColumns+`
+WHERE id=$1
+FOR UPDATE`, id))
+}
+
+// DecideAdjustment records the second admin's decision on a pending
+// adjustment and updates a to match.
+func (r *repo) DecideAdjustment(ctx context.Context, tx *sql.Tx, a *model.WalletAdjustment, status model.AdjustmentStatus, adminID int64) error {
+	const q = `
+UPDATE wallet_adjustments
+SET status=$2, decided_by=$3, decided_at=NOW()
+WHERE id=$1 AND status='PENDING_APPROVAL'
+RETURNING decided_at`
+	var at time.Time
+	if err := tx.QueryRowContext(ctx, q, a.ID, status, adminID).Scan(&at); err != nil {
+		return err
+	}
+	a.Status, a.DecidedBy, a.DecidedAt = status, &adminID, &at
+	return nil
+}
+
+// ListAdjustments returns up to 200 adjustments, newest first; an empty
+// status returns all of them.
+func (r *repo) ListAdjustments(ctx context.Context, status model.AdjustmentStatus) ([]model.WalletAdjustment, error) {
+	rows, err := r.db.QueryContext(ctx, adjustmentColumns+`
+WHERE $1 = '' OR status::text = $1
+ORDER BY id DESC
+LIMIT 200`, string(status))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.WalletAdjustment{}
+	for rows.Next() {
+		a, err := scanAdjustment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *a)
+	}
+	return out, rows.Err()
+}
+
+func (r *repo) UserIDByUsername(ctx context.Context, username string) (int64, error) {
+	var id int64
+	err := r.db.QueryRowContext(ctx, `SELECT id FROM users WHERE username=$1`, username).Scan(&id)
+	return id, err
+}
+
+func (r *repo) InsertTransfer(ctx context.Context, tx *sql.Tx, t *model.WalletTransfer) (int64, error) {
+	const q = `
+INSERT INTO wallet_transfers (from_user_id, to_user_id, amount, note)
+VALUES ($1,$2,$3,$4)
+RETURNING id, created_at`
+	if err := tx.QueryRowContext(ctx, q, t.FromUserID, t.ToUserID, t.Amount, t.Note).Scan(&t.ID, &t.CreatedAt); err != nil {
+		return 0, err
+	}
+	return t.ID, nil
+}
+
+// TransferredSince sums what userID sent to others after since. Run it with
+// the sender locked so concurrent transfers see each other.
+func (r *repo) TransferredSince(ctx context.Context, tx *sql.Tx, userID int64, since time.Time) (model.Money, error) {
+	var sum model.Money
+	err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(amount), 0) FROM wallet_transfers WHERE from_user_id=$1 AND created_at > $2`,
+		userID, since).Scan(&sum)
+	return sum, err
+}
+
+// ListTransfers returns the last 200 transfers the user sent or received.
+func (r *repo) ListTransfers(ctx context.Context, userID int64) ([]model.WalletTransfer, error) {
+	const q = `
+SELECT id, from_user_id, to_user_id, amount, note, created_at
+FROM wallet_transfers
+WHERE from_user_id=$1 OR to_user_id=$1
+ORDER BY id DESC
+LIMIT 200`
+	rows, err := r.db.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.WalletTransfer{}
+	for rows.Next() {
+		var t model.WalletTransfer
+		if err := rows.Scan(&t.ID, &t.FromUserID, &t.ToUserID, &t.Amount, &t.Note, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// JournalReport is the outcome of VerifyJournal. Each list is capped at
+// verifyLimit rows.
+type JournalReport struct {
+	UsersChecked int               `json:"users_checked"`
+	OK           bool              `json:"ok"`
+	Unbalanced   []UnbalancedEntry `json:"unbalanced_entries"`
+	Unposted     []int64           `json:"unposted_ledger_ids"`
+	Mismatches   []BalanceMismatch `json:"balance_mismatches"`
+	Drift        []LedgerDrift     `json:"balance_after_drift"`
+}
+
+// UnbalancedEntry is a journal entry whose lines do not sum to zero.
+type UnbalancedEntry struct {
+	EntryID int64       `json:"entry_id"`
+	Sum     model.Money `json:"sum"`
+}
+
+// BalanceMismatch is a user whose deposit_balance differs from the sum of
+// their USER_WALLET journal lines.
+type BalanceMismatch struct {
+	UserID   int64       `json:"user_id"`
+	Balance  model.Money `json:"deposit_balance"`
+	Journal  model.Money `json:"journal_balance"`
+	Variance model.Money `json:"variance"`
+}
+
+// LedgerDrift is a wallet_ledger row whose balance_after differs from the
+// user's running journal balance at that entry.
+type LedgerDrift struct {
+	LedgerID     int64       `json:"ledger_id"`
+	UserID       int64       `json:"user_id"`
+	BalanceAfter model.Money `json:"balance_after"`
+	Running      model.Money `json:"running_balance"`
+}
+
+const verifyLimit = 100
+
+// VerifyJournal recomputes every user's balance from the journal and
+// reports where it disagrees with users.deposit_balance or with the
+// balance_after printed on their statement.
+func (r *repo) VerifyJournal(ctx context.Context) (*JournalReport, error) {
+	rep := &JournalReport{}
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&rep.UsersChecked); err != nil {
+		return nil, err
+	}
+
+	const qUnbalanced = `
+SELECT entry_id, SUM(amount)
+FROM journal_lines
+GROUP BY entry_id
+HAVING SUM(amount) <> 0
+ORDER BY entry_id
+LIMIT $1`
+	if err := r.collect(ctx, qUnbalanced, func(rows *sql.Rows) error {
+		var u UnbalancedEntry
+		if err := rows.Scan(&u.EntryID, &u.Sum); err != nil {
+			return err
+		}
+		rep.Unbalanced = append(rep.Unbalanced, u)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unbalanced entries: %w", err)
+	}
+
+	const qUnposted = `
+SELECT l.id
+FROM wallet_ledger l
+LEFT JOIN journal_entries e ON e.ledger_id = l.id
+WHERE e.id IS NULL
+ORDER BY l.id
+LIMIT $1`
+	if err := r.collect(ctx, qUnposted, func(rows *sql.Rows) error {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		rep.Unposted = append(rep.Unposted, id)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unposted ledger rows: %w", err)
+	}
+
+	const qMismatch = `
+SELECT u.id, u.deposit_balance, COALESCE(j.total, 0)
+FROM users u
+LEFT JOIN (
+	SELECT user_id, SUM(amount) AS total
+	FROM journal_lines
+	WHERE account = 'USER_WALLET'
+	GROUP BY user_id
+) j ON j.user_id = u.id
+WHERE u.deposit_balance <> COALESCE(j.total, 0)
+ORDER BY u.id
+LIMIT $1`
+	if err := r.collect(ctx, qMismatch, func(rows *sql.Rows) error {
+		var m BalanceMismatch
+		if err := rows.Scan(&m.UserID, &m.Balance, &m.Journal); err != nil {
+			return err
+		}
+		m.Variance = m.Balance - m.Journal
+		rep.Mismatches = append(rep.Mismatches, m)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("balance mismatches: %w", err)
+	}
+
+	const qDrift = `
+SELECT ledger_id, user_id, balance_after, running
+FROM (
+	SELECT l.id AS ledger_id, l.user_id, l.balance_after,
+		SUM(jl.amount) OVER (PARTITION BY jl.user_id ORDER BY e.id) AS running
+	FROM journal_lines jl
+	JOIN journal_entries e ON e.id = jl.entry_id
+	JOIN wallet_ledger l ON l.id = e.ledger_id
+	WHERE jl.account = 'USER_WALLET'
+) t
+WHERE balance_after <> running
+ORDER BY ledger_id
+LIMIT $1`
+	if err := r.collect(ctx, qDrift, func(rows *sql.Rows) error {
+		var d LedgerDrift
+		if err := rows.Scan(&d.LedgerID, &d.UserID, &d.BalanceAfter, &d.Running); err != nil {
+			return err
+		}
+		rep.Drift = append(rep.Drift, d)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("balance_after drift: %w", err)
+	}
+
+	rep.OK = len(rep.Unbalanced) == 0 && len(rep.Unposted) == 0 && len(rep.Mismatches) == 0 && len(rep.Drift) == 0
+	return rep, nil
+}
+
+// collect runs a verifier query limited to verifyLimit rows.
+func (r *repo) collect(ctx context.Context, q string, scan func(*sql.Rows) error) error {
+	rows, err := r.db.QueryContext(ctx, q, verifyLimit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
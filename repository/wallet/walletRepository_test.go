@@ -0,0 +1,82 @@
+package walletrepo
+
+import (
+	"context"
+	"database/sql/driver"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+
+	"bookrental/model"
+	"bookrental/util/sqlstub"
+)
+
+// ledgerTypes reads every LedgerType constant declared in package model, so
+// a type added there is checked here without editing this test.
+func ledgerTypes(t *testing.T) map[string]string {
+	t.Helper()
+	pkgs, err := parser.ParseDir(token.NewFileSet(), "../../model", nil, 0)
+	if err != nil {
+		t.Fatalf("parse model: %v", err)
+	}
+	out := map[string]string{}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.CONST {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					vs := spec.(*ast.ValueSpec)
+					if id, ok := vs.Type.(*ast.Ident); !ok || id.Name != "LedgerType" {
+						continue
+					}
+					for i, name := range vs.Names {
+						lit, ok := vs.Values[i].(*ast.BasicLit)
+						if !ok || lit.Kind != token.STRING {
+							t.Fatalf("model.%s is not a string literal", name.Name)
+						}
+						out[name.Name], _ = strconv.Unquote(lit.Value)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+func TestEveryLedgerTypeHasCounterAccount(t *testing.T) {
+	types := ledgerTypes(t)
+	if len(types) == 0 {
+		t.Fatal("found no LedgerType constants in package model")
+	}
+	for name, value := range types {
+		if _, ok := counterAccount[value]; !ok {
+			t.Errorf("model.%s (%s) has no counter account; InsertLedger would refuse it", name, value)
+		}
+	}
+	if len(counterAccount) != len(types) {
+		t.Errorf("counterAccount has %d entries for %d ledger types", len(counterAccount), len(types))
+	}
+}
+
+func TestHeldForBookingsLeavesOutInvoiceRentals(t *testing.T) {
+	db := sqlstub.New()
+	db.Return([]string{"count", "sum"}, []driver.Value{int64(2), "80.00"})
+
+	n, total, err := New(db.DB).HeldForBookings(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || total != model.Units(80) {
+		t.Errorf("got %d, %s; want 2, 80.00", n, total)
+	}
+	q := db.Queries()[0]
+	if !strings.Contains(q, "status='BOOKED'") || !strings.Contains(q, "xendit_invoice_id IS NULL") {
+		t.Errorf("query should count only deposit-paid BOOKED rentals:\n%s", q)
+	}
+}
@@ -0,0 +1,114 @@
+package xenditrepo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bookrental/util/httpx"
+)
+
+// fakeRepo stands in for Xendit in local development. Invoices get a dummy
+// link and are never paid on their own. Disbursements are accepted as
+// PENDING and, when a callback URL is set, reported back as COMPLETED after
+// delay, the way Xendit would call us; otherwise post the callback by hand.
+type fakeRepo struct {
+	token       string
+	callbackURL string
+	delay       time.Duration
+	log         *slog.Logger
+	seq         atomic.Int64
+
+	mu       sync.Mutex
+	invoices map[string]*Invoice
+}
+
+// NewFake returns a provider that talks to nobody. token is the callback
+// token it expects back (and sends on its own callbacks).
+func NewFake(token, disbursementCallbackURL string, delay time.Duration, log *slog.Logger) Repo {
+	return &fakeRepo{token: token, callbackURL: disbursementCallbackURL, delay: delay, log: log, invoices: map[string]*Invoice{}}
+}
+
+func (r *fakeRepo) CreateInvoice(req CreateInvoiceReq) (*CreateInvoiceResp, error) {
+	id := fmt.Sprintf("fake-inv-%d", r.seq.Add(1))
+	r.log.Info("fake invoice created", "invoice_id", id, "external_id", req.ExternalID, "amount", req.Amount.String())
+	inv := &Invoice{
+		ID:         id,
+		ExternalID: req.ExternalID,
+		Status:     "PENDING",
+		Amount:     req.Amount,
+		InvoiceURL: "http://localhost/fake-invoice/" + id,
+		ExpiryDate: time.Now().Add(time.Duration(req.ExpirySec) * time.Second).UTC(),
+	}
+	r.mu.Lock()
+	r.invoices[id] = inv
+	r.mu.Unlock()
+	return &CreateInvoiceResp{
+		InvoiceID:  id,
+		InvoiceURL: inv.InvoiceURL,
+		ExpiresAt:  inv.ExpiryDate.Format(time.RFC3339),
+	}, nil
+}
+
+// GetInvoice reports invoices made since start-up; nobody pays them, so
+// they stay PENDING until their expiry passes.
+func (r *fakeRepo) GetInvoice(invoiceID string) (*Invoice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	inv, ok := r.invoices[invoiceID]
+	if !ok {
+		return nil, ErrInvoiceNotFound
+	}
+	out := *inv
+	if out.Status == "PENDING" && time.Now().After(out.ExpiryDate) {
+		out.Status = "EXPIRED"
+	}
+	return &out, nil
+}
+
+func (r *fakeRepo) CreateDisbursement(req CreateDisbursementReq) (*CreateDisbursementResp, error) {
+	id := fmt.Sprintf("fake-disb-%d", r.seq.Add(1))
+	r.log.Info("fake disbursement created", "disbursement_id", id, "external_id", req.ExternalID, "amount", req.Amount.String())
+	if r.callbackURL != "" {
+		go r.complete(id, req)
+	}
+	return &CreateDisbursementResp{DisbursementID: id, Status: "PENDING"}, nil
+}
+
+// complete posts a COMPLETED disbursement callback once delay has passed.
+func (r *fakeRepo) complete(id string, req CreateDisbursementReq) {
+	time.Sleep(r.delay)
+	b, _ := json.Marshal(map[string]any{
+		"id":          id,
+		"external_id": req.ExternalID,
+		"amount":      req.Amount,
+		"status":      "COMPLETED",
+	})
+	httpReq, err := http.NewRequest("POST", r.callbackURL, bytes.NewReader(b))
+	if err != nil {
+		r.log.Error("fake disbursement callback", "err", err)
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Callback-Token", r.token)
+	resp, err := httpx.Client().Do(httpReq)
+	if err != nil {
+		r.log.Error("fake disbursement callback", "err", err)
+		return
+	}
+	resp.Body.Close()
+	r.log.Info("fake disbursement callback sent", "disbursement_id", id, "status", resp.Status)
+}
+
+func (r *fakeRepo) VerifyCallbackSignature(sigHeader string, rawBody []byte) error {
+	if sigHeader != r.token {
+		return errors.New("bad token")
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"time"
 )
@@ -53,7 +54,7 @@ func (r *httpRepo) CreateInvoice(req CreateInvoiceReq) (*CreateInvoiceResp, erro
 
 	if resp.StatusCode >= 300 {
 		bs, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("xendit create invoice failed: %s: %s", resp.Status, string(bs))
+		return nil, &APIError{Op: "create invoice", StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bs)}
 	}
 
 	var out struct {
@@ -75,6 +76,82 @@ func (r *httpRepo) CreateInvoice(req CreateInvoiceReq) (*CreateInvoiceResp, erro
 	}, nil
 }
 
+func (r *httpRepo) CreateDisbursement(req CreateDisbursementReq) (*CreateDisbursementResp, error) {
+	body := map[string]any{
+		"external_id":         req.ExternalID,
+		"amount":              req.Amount,
+		"bank_code":           req.BankCode,
+		"account_holder_name": req.AccountHolderName,
+		"account_number":      req.AccountNumber,
+		"description":         req.Description,
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal body: %w", err)
+	}
+
+	httpReq, err := http.NewRequest("POST", "https://api.xendit.co/disbursements", bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	httpReq.SetBasicAuth(r.apiKey, "")
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-IDEMPOTENCY-KEY", req.ExternalID)
+
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		bs, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{Op: "create disbursement", StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bs)}
+	}
+
+	var out struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	if out.ID == "" {
+		return nil, errors.New("xendit: empty disbursement id")
+	}
+
+	return &CreateDisbursementResp{DisbursementID: out.ID, Status: out.Status}, nil
+}
+
+func (r *httpRepo) GetInvoice(invoiceID string) (*Invoice, error) {
+	httpReq, err := http.NewRequest("GET", "https://api.xendit.co/v2/invoices/"+url.PathEscape(invoiceID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	httpReq.SetBasicAuth(r.apiKey, "")
+
+	resp, err := r.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrInvoiceNotFound
+	}
+	if resp.StatusCode >= 300 {
+		bs, _ := io.ReadAll(resp.Body)
+		return nil, &APIError{Op: "get invoice", StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bs)}
+	}
+
+	var out Invoice
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
 func (r *httpRepo) VerifyCallbackSignature(sigHeader string, rawBody []byte) error {
 	if sigHeader != os.Getenv("XENDIT_CALLBACK_TOKEN") {
 		return errors.New("bad token")
@@ -1,10 +1,17 @@
 package xenditrepo
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"bookrental/model"
+)
 
 type CreateInvoiceReq struct {
 	ExternalID  string
-	Amount      float64
+	Amount      model.Money
 	PayerEmail  string
 	Description string
 	ExpirySec   int
@@ -17,17 +24,67 @@ type CreateInvoiceResp struct {
 }
 
 type Invoice struct {
-	ID         string     `json:"id"`
-	ExternalID string     `json:"external_id"`
-	Status     string     `json:"status"`
-	Amount     float64    `json:"amount"`
-	PaidAmount float64    `json:"paid_amount"`
-	InvoiceURL string     `json:"invoice_url"`
-	ExpiryDate time.Time  `json:"expiry_date"`
-	PaidAt     *time.Time `json:"paid_at,omitempty"`
+	ID         string      `json:"id"`
+	ExternalID string      `json:"external_id"`
+	Status     string      `json:"status"`
+	Amount     model.Money `json:"amount"`
+	PaidAmount model.Money `json:"paid_amount"`
+	InvoiceURL string      `json:"invoice_url"`
+	ExpiryDate time.Time   `json:"expiry_date"`
+	PaidAt     *time.Time  `json:"paid_at,omitempty"`
+}
+
+// CreateDisbursementReq pays money out to a bank account. ExternalID is
+// also sent as the idempotency key, so retrying the same request cannot
+// pay twice.
+type CreateDisbursementReq struct {
+	ExternalID        string
+	Amount            model.Money
+	BankCode          string
+	AccountHolderName string
+	AccountNumber     string
+	Description       string
+}
+
+type CreateDisbursementResp struct {
+	DisbursementID string
+	Status         string
+}
+
+// ErrInvoiceNotFound is returned by GetInvoice for ids the provider does
+// not know.
+var ErrInvoiceNotFound = errors.New("xendit: invoice not found")
+
+// APIError is a non-2xx answer from Xendit.
+type APIError struct {
+	Op         string // e.g. "create disbursement"
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("xendit %s failed: %s: %s", e.Op, e.Status, e.Body)
+}
+
+// IsRejected reports whether err is a definite refusal: a 4xx that says the
+// request was not, and will not be, carried out. Timeouts, rate limits,
+// conflicts, 5xx and transport errors leave the outcome unknown.
+func IsRejected(err error) bool {
+	var ae *APIError
+	if !errors.As(err, &ae) || ae.StatusCode < 400 || ae.StatusCode >= 500 {
+		return false
+	}
+	switch ae.StatusCode {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return true
 }
 
 type Repo interface {
 	CreateInvoice(req CreateInvoiceReq) (*CreateInvoiceResp, error)
+	CreateDisbursement(req CreateDisbursementReq) (*CreateDisbursementResp, error)
+	GetInvoice(invoiceID string) (*Invoice, error)
 	VerifyCallbackSignature(sigHeader string, rawBody []byte) error
 }
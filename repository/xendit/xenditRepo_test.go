@@ -0,0 +1,30 @@
+package xenditrepo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestIsRejected(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&APIError{StatusCode: 400}, true},
+		{&APIError{StatusCode: 403}, true},
+		{fmt.Errorf("send: %w", &APIError{StatusCode: 422}), true},
+		{&APIError{StatusCode: 408}, false},
+		{&APIError{StatusCode: 409}, false},
+		{&APIError{StatusCode: 429}, false},
+		{&APIError{StatusCode: 500}, false},
+		{&APIError{StatusCode: 503}, false},
+		{errors.New("dial tcp: i/o timeout"), false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := IsRejected(c.err); got != c.want {
+			t.Errorf("IsRejected(%v) = %v; want %v", c.err, got, c.want)
+		}
+	}
+}
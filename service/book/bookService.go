@@ -3,38 +3,67 @@ package booksvc
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	repo "bookrental/repository/book"
 )
 
 type Book = repo.Book
 
+// defaultRentalDays is the loan period for books created without one.
+const defaultRentalDays = 7
+
+// defaultBranch is where copies added without a branch are shelved.
+const defaultBranch = "main"
+
 type Repo interface {
-	CreateBook(ctx context.Context, name, category string, cost float64) (int64, error)
-	AddCopies(ctx context.Context, bookID int64, n int) (int64, error)
+	CreateBook(ctx context.Context, b Book) (int64, error)
+	AddCopies(ctx context.Context, bookID int64, n int, branch string) (int64, error)
 	List(ctx context.Context) ([]Book, error)
 	Detail(ctx context.Context, id int64) (*Book, error)
 }
 
 type Service interface {
-	Create(ctx context.Context, name, category string, cost float64) (int64, error)
-	AddCopies(ctx context.Context, bookID int64, n int) (int64, error)
+	Create(ctx context.Context, b Book) (int64, error)
+	AddCopies(ctx context.Context, bookID int64, n int, branch string) (int64, error)
 	List(ctx context.Context) ([]Book, error)
 	Detail(ctx context.Context, id int64) (*Book, error)
 }
 
-type service struct{ r Repo }
+// Waitlist hands free copies of a book to the users queued for it.
+type Waitlist interface {
+	OfferCopies(ctx context.Context, bookID int64) (int, error)
+}
+
+type service struct {
+	r Repo
+	w Waitlist
+}
 
-func New(r Repo) Service { return &service{r: r} }
+func New(r Repo, w Waitlist) Service { return &service{r: r, w: w} }
 
-func (s *service) Create(ctx context.Context, name, category string, cost float64) (int64, error) {
-	if name == "" || category == "" || cost < 0 {
+func (s *service) Create(ctx context.Context, b Book) (int64, error) {
+	if b.Name == "" || b.Category == "" || b.RentalCost < 0 || b.RentalDays < 0 || b.LateFeePerDay < 0 || b.ReplacementCost < 0 {
 		return 0, errors.New("invalid payload")
 	}
-	return s.r.CreateBook(ctx, name, category, cost)
+	if b.RentalDays == 0 {
+		b.RentalDays = defaultRentalDays
+	}
+	return s.r.CreateBook(ctx, b)
 }
-func (s *service) AddCopies(ctx context.Context, bookID int64, n int) (int64, error) {
-	return s.r.AddCopies(ctx, bookID, n)
+func (s *service) AddCopies(ctx context.Context, bookID int64, n int, branch string) (int64, error) {
+	if branch == "" {
+		branch = defaultBranch
+	}
+	added, err := s.r.AddCopies(ctx, bookID, n, branch)
+	if err != nil {
+		return 0, err
+	}
+	// Anyone already queued gets the new copies before they show as free.
+	if _, err := s.w.OfferCopies(ctx, bookID); err != nil {
+		return added, fmt.Errorf("offer copies to waitlist: %w", err)
+	}
+	return added, nil
 }
 func (s *service) List(ctx context.Context) ([]Book, error)            { return s.r.List(ctx) }
 func (s *service) Detail(ctx context.Context, id int64) (*Book, error) { return s.r.Detail(ctx, id) }
@@ -10,47 +10,69 @@ import (
 )
 
 type repoMock struct {
-	createFn    func(ctx context.Context, name, category string, cost float64) (int64, error)
-	addCopiesFn func(ctx context.Context, bookID int64, n int) (int64, error)
+	createFn    func(ctx context.Context, b booksvc.Book) (int64, error)
+	addCopiesFn func(ctx context.Context, bookID int64, n int, branch string) (int64, error)
 	listFn      func(ctx context.Context) ([]booksvc.Book, error)
 	detailFn    func(ctx context.Context, id int64) (*booksvc.Book, error)
 }
 
-func (m *repoMock) CreateBook(ctx context.Context, name, category string, cost float64) (int64, error) {
-	return m.createFn(ctx, name, category, cost)
+func (m *repoMock) CreateBook(ctx context.Context, b booksvc.Book) (int64, error) {
+	return m.createFn(ctx, b)
 }
-func (m *repoMock) AddCopies(ctx context.Context, bookID int64, n int) (int64, error) {
-	return m.addCopiesFn(ctx, bookID, n)
+func (m *repoMock) AddCopies(ctx context.Context, bookID int64, n int, branch string) (int64, error) {
+	return m.addCopiesFn(ctx, bookID, n, branch)
 }
 func (m *repoMock) List(ctx context.Context) ([]booksvc.Book, error) { return m.listFn(ctx) }
 func (m *repoMock) Detail(ctx context.Context, id int64) (*booksvc.Book, error) {
 	return m.detailFn(ctx, id)
 }
 
+type waitlistMock struct {
+	offered []int64
+	err     error
+}
+
+func (w *waitlistMock) OfferCopies(ctx context.Context, bookID int64) (int, error) {
+	w.offered = append(w.offered, bookID)
+	return 0, w.err
+}
+
 func TestCreate_Validation(t *testing.T) {
-	s := booksvc.New(&repoMock{})
-	if _, err := s.Create(context.Background(), "", "cat", 10); err == nil {
+	s := booksvc.New(&repoMock{}, &waitlistMock{})
+	if _, err := s.Create(context.Background(), booksvc.Book{Name: "", Category: "cat", RentalCost: 10}); err == nil {
 		t.Fatal("expected error for empty name")
 	}
-	if _, err := s.Create(context.Background(), "name", "", 10); err == nil {
+	if _, err := s.Create(context.Background(), booksvc.Book{Name: "name", Category: "", RentalCost: 10}); err == nil {
 		t.Fatal("expected error for empty category")
 	}
-	if _, err := s.Create(context.Background(), "name", "cat", -1); err == nil {
+	if _, err := s.Create(context.Background(), booksvc.Book{Name: "name", Category: "cat", RentalCost: -1}); err == nil {
 		t.Fatal("expected error for negative cost")
 	}
+	if _, err := s.Create(context.Background(), booksvc.Book{Name: "name", Category: "cat", RentalCost: 10, RentalDays: -1}); err == nil {
+		t.Fatal("expected error for negative rental days")
+	}
+	if _, err := s.Create(context.Background(), booksvc.Book{Name: "name", Category: "cat", RentalCost: 10, LateFeePerDay: -1}); err == nil {
+		t.Fatal("expected error for negative late fee")
+	}
+	if _, err := s.Create(context.Background(), booksvc.Book{Name: "name", Category: "cat", RentalCost: 10, ReplacementCost: -1}); err == nil {
+		t.Fatal("expected error for negative replacement cost")
+	}
 }
 
 func TestCreate_Success(t *testing.T) {
 	m := &repoMock{
-		createFn: func(ctx context.Context, name, category string, cost float64) (int64, error) {
-			if name != "Clean Code" || category != "Prog" || cost != 18000 {
+		createFn: func(ctx context.Context, b booksvc.Book) (int64, error) {
+			if b.Name != "Clean Code" || b.Category != "Prog" || b.RentalCost != 18000 {
 				return 0, errors.New("bad args")
 			}
+			if b.RentalDays != 7 {
+				return 0, errors.New("rental days not defaulted")
+			}
 			return 42, nil
 		},
 	}
-	s := booksvc.New(m)
-	id, err := s.Create(context.Background(), "Clean Code", "Prog", 18000)
+	s := booksvc.New(m, &waitlistMock{})
+	id, err := s.Create(context.Background(), booksvc.Book{Name: "Clean Code", Category: "Prog", RentalCost: 18000})
 	if err != nil || id != 42 {
 		t.Fatalf("got id=%v err=%v; want 42 nil", id, err)
 	}
@@ -58,13 +80,13 @@ func TestCreate_Success(t *testing.T) {
 
 func TestPassThroughs(t *testing.T) {
 	m := &repoMock{
-		addCopiesFn: func(ctx context.Context, bookID int64, n int) (int64, error) { return 3, nil },
+		addCopiesFn: func(ctx context.Context, bookID int64, n int, branch string) (int64, error) { return 3, nil },
 		listFn:      func(ctx context.Context) ([]booksvc.Book, error) { return nil, nil },
 		detailFn:    func(ctx context.Context, id int64) (*booksvc.Book, error) { return &booksvc.Book{}, nil },
 	}
-	s := booksvc.New(m)
+	s := booksvc.New(m, &waitlistMock{})
 
-	if n, err := s.AddCopies(context.Background(), 7, 3); err != nil || n != 3 {
+	if n, err := s.AddCopies(context.Background(), 7, 3, "north"); err != nil || n != 3 {
 		t.Fatalf("AddCopies got %v %v; want 3 nil", n, err)
 	}
 	if _, err := s.List(context.Background()); err != nil {
@@ -74,3 +96,49 @@ func TestPassThroughs(t *testing.T) {
 		t.Fatalf("Detail error: %v", err)
 	}
 }
+
+func TestAddCopies_DefaultBranch(t *testing.T) {
+	var got string
+	m := &repoMock{
+		addCopiesFn: func(ctx context.Context, bookID int64, n int, branch string) (int64, error) {
+			got = branch
+			return int64(n), nil
+		},
+	}
+	s := booksvc.New(m, &waitlistMock{})
+	if _, err := s.AddCopies(context.Background(), 7, 1, ""); err != nil {
+		t.Fatalf("AddCopies error: %v", err)
+	}
+	if got != "main" {
+		t.Fatalf("branch got %q; want main", got)
+	}
+}
+
+func TestAddCopies_OffersToWaitlist(t *testing.T) {
+	m := &repoMock{
+		addCopiesFn: func(ctx context.Context, bookID int64, n int, branch string) (int64, error) { return int64(n), nil },
+	}
+	w := &waitlistMock{}
+	s := booksvc.New(m, w)
+	if _, err := s.AddCopies(context.Background(), 7, 2, "north"); err != nil {
+		t.Fatalf("AddCopies error: %v", err)
+	}
+	if len(w.offered) != 1 || w.offered[0] != 7 {
+		t.Fatalf("offered %v; want book 7 offered once", w.offered)
+	}
+
+	w.err = errors.New("boom")
+	if n, err := s.AddCopies(context.Background(), 7, 2, "north"); !errors.Is(err, w.err) || n != 2 {
+		t.Fatalf("got %v %v; want 2 with the waitlist error", n, err)
+	}
+
+	failing := &repoMock{
+		addCopiesFn: func(ctx context.Context, bookID int64, n int, branch string) (int64, error) {
+			return 0, errors.New("insert")
+		},
+	}
+	w = &waitlistMock{}
+	if _, err := booksvc.New(failing, w).AddCopies(context.Background(), 7, 2, "north"); err == nil || len(w.offered) != 0 {
+		t.Fatalf("err %v, offered %v; want the repo error and no offer", err, w.offered)
+	}
+}
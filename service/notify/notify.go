@@ -0,0 +1,22 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Notifier tells a user that something happened to their account.
+type Notifier interface {
+	Notify(ctx context.Context, userID int64, subject, body string) error
+}
+
+type logNotifier struct{ log *slog.Logger }
+
+// NewLog returns a Notifier that only writes to the log. It stands in until
+// an email/push channel is wired up.
+func NewLog(log *slog.Logger) Notifier { return &logNotifier{log: log} }
+
+func (n *logNotifier) Notify(ctx context.Context, userID int64, subject, body string) error {
+	n.log.InfoContext(ctx, "notify", "user_id", userID, "subject", subject, "body", body)
+	return nil
+}
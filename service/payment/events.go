@@ -0,0 +1,167 @@
+package paymentsvc
+
+import (
+	"bookrental/model"
+	paymentrepo "bookrental/repository/payment"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// callbackTokenHeader carries the shared secret Xendit signs callbacks with.
+// It is checked but never stored.
+const callbackTokenHeader = "X-Callback-Token"
+
+// webhookIDHeader is Xendit's id for one webhook; retries repeat it.
+const webhookIDHeader = "Webhook-Id"
+
+// staleEvent is how long an event may sit in RECEIVED before a retry or a
+// replay may assume the earlier attempt died and take it over.
+const staleEvent = 10 * time.Minute
+
+// receive verifies and stores a webhook, then processes it once. Repeats
+// of an event that was processed, or is being processed, are acknowledged
+// without running again; repeats of a failed one run it again.
+func (s *service) receive(ctx context.Context, kind model.PaymentEventKind, headers http.Header, raw []byte) error {
+	ev := &model.PaymentEvent{
+		Kind:    kind,
+		Headers: storedHeaders(headers),
+		RawBody: model.RawBody(raw),
+		Status:  model.PaymentEventReceived,
+	}
+	verifyErr := s.xv.VerifyCallbackSignature(headers.Get(callbackTokenHeader), raw)
+	ev.Verified = verifyErr == nil
+
+	key, keyErr := eventKey(headers, raw)
+	ev.EventID = key
+	var reject error
+	switch {
+	case verifyErr != nil:
+		reject = fmt.Errorf("invalid callback signature: %w", verifyErr)
+	case keyErr != nil:
+		reject = keyErr
+	}
+	if reject != nil {
+		msg := reject.Error()
+		ev.Status, ev.Error = model.PaymentEventRejected, &msg
+	}
+
+	fresh, err := s.events.RecordEvent(ctx, ev)
+	if err != nil {
+		return fmt.Errorf("record event: %w", err)
+	}
+	if reject != nil {
+		return reject
+	}
+	if !fresh {
+		claimed, err := s.events.ClaimEvent(ctx, ev.ID, staleEvent)
+		if err != nil {
+			return fmt.Errorf("claim event: %w", err)
+		}
+		if !claimed {
+			return nil
+		}
+	}
+	return s.process(ctx, ev)
+}
+
+// process runs the handler for a claimed event and records the outcome.
+func (s *service) process(ctx context.Context, ev *model.PaymentEvent) error {
+	var err error
+	switch ev.Kind {
+	case model.PaymentEventInvoice:
+		err = s.processInvoice(ctx, ev.RawBody)
+	case model.PaymentEventDisbursement:
+		err = s.processDisbursement(ctx, ev.RawBody)
+	default:
+		err = fmt.Errorf("unknown event kind %q", ev.Kind)
+	}
+
+	status, msg := model.PaymentEventProcessed, ""
+	if err != nil {
+		status, msg = model.PaymentEventFailed, err.Error()
+	}
+	if ferr := s.events.FinishEvent(ctx, ev.ID, status, msg); ferr != nil && err == nil {
+		return fmt.Errorf("finish event: %w", ferr)
+	}
+	return err
+}
+
+// Events lists stored webhooks for admins, newest first.
+func (s *service) Events(ctx context.Context, f paymentrepo.EventFilter) ([]model.PaymentEvent, error) {
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+	return s.events.ListEvents(ctx, f)
+}
+
+// ReplayEvent runs a failed event through its handler again. The signature
+// was checked on receipt and is not checked again.
+// Business rules:
+// - Event must exist (404)
+// - Only verified events that failed, or stalled mid-processing, replay (409)
+// - A handler error is reported with the updated event (422)
+func (s *service) ReplayEvent(ctx context.Context, id int64) (*model.PaymentEvent, error) {
+	ev, err := s.events.GetEvent(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, echo.NewHTTPError(404, echo.Map{"message": "event not found"})
+	}
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("get event: %v", err)})
+	}
+	claimed, err := s.events.ClaimEvent(ctx, id, staleEvent)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("claim event: %v", err)})
+	}
+	if !claimed {
+		return nil, echo.NewHTTPError(409, echo.Map{"message": fmt.Sprintf("event is %s and cannot be replayed", ev.Status)})
+	}
+
+	procErr := s.process(ctx, ev)
+	if ev, err = s.events.GetEvent(ctx, id); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("get event: %v", err)})
+	}
+	if procErr != nil {
+		return nil, echo.NewHTTPError(422, echo.Map{"message": "replay failed", "error": procErr.Error(), "event": ev})
+	}
+	return ev, nil
+}
+
+// eventKey is the idempotency key of a webhook: the provider's webhook id
+// when it sends one, otherwise the object id and status, which a retry of
+// the same callback repeats.
+func eventKey(headers http.Header, raw []byte) (string, error) {
+	var body struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return "", fmt.Errorf("bad webhook json: %w", err)
+	}
+	if body.ID == "" || body.Status == "" {
+		return "", errors.New("missing event fields")
+	}
+	if id := strings.TrimSpace(headers.Get(webhookIDHeader)); id != "" {
+		return id, nil
+	}
+	return body.ID + ":" + body.Status, nil
+}
+
+// storedHeaders flattens headers for storage, leaving out the callback token.
+func storedHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		if http.CanonicalHeaderKey(k) == callbackTokenHeader {
+			continue
+		}
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
@@ -0,0 +1,258 @@
+package paymentsvc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"bookrental/model"
+	paymentrepo "bookrental/repository/payment"
+	walletrepo "bookrental/repository/wallet"
+	xenditrepo "bookrental/repository/xendit"
+)
+
+func TestEventKey(t *testing.T) {
+	body := []byte(`{"id":"disb-1","external_id":"withdrawal:7","status":"COMPLETED"}`)
+
+	key, err := eventKey(http.Header{}, body)
+	if err != nil || key != "disb-1:COMPLETED" {
+		t.Errorf("without webhook id: got %q, %v; want disb-1:COMPLETED", key, err)
+	}
+	h := http.Header{}
+	h.Set("webhook-id", "wh-42")
+	if key, _ := eventKey(h, body); key != "wh-42" {
+		t.Errorf("with webhook id: got %q; want wh-42", key)
+	}
+	if _, err := eventKey(http.Header{}, []byte(`{"id":"x"}`)); err == nil {
+		t.Error("missing status: want error")
+	}
+	if _, err := eventKey(http.Header{}, []byte(`not json`)); err == nil {
+		t.Error("bad json: want error")
+	}
+}
+
+func TestStoredHeadersDropsToken(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Callback-Token", "secret")
+	h.Add("Content-Type", "application/json")
+	got := storedHeaders(h)
+	if _, ok := got["X-Callback-Token"]; ok {
+		t.Error("callback token was stored")
+	}
+	if got["Content-Type"] != "application/json" {
+		t.Errorf("Content-Type = %q", got["Content-Type"])
+	}
+}
+
+// memEvents keeps events in memory with the same uniqueness rule as the table.
+type memEvents struct {
+	paymentrepo.Repo
+	rows []*model.PaymentEvent
+}
+
+func (m *memEvents) RecordEvent(ctx context.Context, ev *model.PaymentEvent) (bool, error) {
+	for _, r := range m.rows {
+		if ev.Verified && r.Verified && r.Kind == ev.Kind && r.EventID == ev.EventID {
+			ev.ID, ev.Status, ev.Attempts = r.ID, r.Status, r.Attempts
+			return false, nil
+		}
+	}
+	if ev.Status == model.PaymentEventReceived {
+		ev.Attempts = 1
+	}
+	ev.ID = int64(len(m.rows) + 1)
+	cp := *ev
+	m.rows = append(m.rows, &cp)
+	return true, nil
+}
+
+func (m *memEvents) ClaimEvent(ctx context.Context, id int64, staleAfter time.Duration) (bool, error) {
+	r := m.rows[id-1]
+	if !r.Verified || r.Status != model.PaymentEventFailed {
+		return false, nil
+	}
+	r.Status = model.PaymentEventReceived
+	r.Attempts++
+	return true, nil
+}
+
+func (m *memEvents) FinishEvent(ctx context.Context, id int64, status model.PaymentEventStatus, errMsg string) error {
+	m.rows[id-1].Status = status
+	return nil
+}
+
+func (m *memEvents) GetEvent(ctx context.Context, id int64) (*model.PaymentEvent, error) {
+	cp := *m.rows[id-1]
+	return &cp, nil
+}
+
+type tokenOnly struct{ xenditrepo.Repo }
+
+func (tokenOnly) VerifyCallbackSignature(sig string, raw []byte) error {
+	if sig != "tok" {
+		return errors.New("bad token")
+	}
+	return nil
+}
+
+type countingPayouts struct {
+	Wallet
+	settled int
+	err     error
+}
+
+func (p *countingPayouts) SettleWithdrawal(ctx context.Context, id int64, disbursementID string) error {
+	p.settled++
+	return p.err
+}
+
+func (p *countingPayouts) ReverseWithdrawal(ctx context.Context, id int64, disbursementID, reason string) error {
+	return nil
+}
+
+func TestDisbursementWebhookIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	events := &memEvents{}
+	payouts := &countingPayouts{err: errors.New("db down")}
+	s := &service{xv: tokenOnly{}, events: events, wallet: payouts}
+
+	body := []byte(`{"id":"disb-1","external_id":"withdrawal:7","status":"COMPLETED"}`)
+	h := http.Header{}
+	h.Set("X-Callback-Token", "tok")
+
+	if err := s.HandleDisbursement(ctx, h, body); err == nil {
+		t.Fatal("first delivery: want handler error")
+	}
+	if got := events.rows[0].Status; got != model.PaymentEventFailed {
+		t.Fatalf("after failure: status %s; want FAILED", got)
+	}
+
+	// The provider retries; the failed event runs again and succeeds.
+	payouts.err = nil
+	if err := s.HandleDisbursement(ctx, h, body); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	// A further repeat is acknowledged without running the handler.
+	if err := s.HandleDisbursement(ctx, h, body); err != nil {
+		t.Fatalf("repeat: %v", err)
+	}
+	if payouts.settled != 2 || len(events.rows) != 1 || events.rows[0].Status != model.PaymentEventProcessed {
+		t.Errorf("settled %d times, %d rows, status %s; want 2, 1, PROCESSED",
+			payouts.settled, len(events.rows), events.rows[0].Status)
+	}
+
+	// Forged requests are stored as rejected and never reach the handler.
+	h.Set("X-Callback-Token", "nope")
+	if err := s.HandleDisbursement(ctx, h, body); err == nil {
+		t.Error("bad token: want error")
+	}
+	if len(events.rows) != 2 || events.rows[1].Status != model.PaymentEventRejected || payouts.settled != 2 {
+		t.Errorf("forged request: %d rows, status %s, settled %d", len(events.rows), events.rows[1].Status, payouts.settled)
+	}
+	if _, err := s.ReplayEvent(ctx, 2); err == nil {
+		t.Error("replaying a rejected event: want error")
+	}
+}
+
+// topupLookup answers FindTopupByInvoiceID with a PENDING top-up, or err.
+type topupLookup struct {
+	walletrepo.Repo
+	err      error
+	finished int
+}
+
+func (w *topupLookup) FindTopupByInvoiceID(ctx context.Context, invoiceID string) (int64, int64, model.Money, string, error) {
+	if w.err != nil {
+		return 0, 0, 0, "", w.err
+	}
+	return 1, 7, model.Units(50), string(model.TopupPending), nil
+}
+
+func (w *topupLookup) FinishTopup(ctx context.Context, topupID int64, status model.TopupStatus) (bool, error) {
+	w.finished++
+	return true, nil
+}
+
+type countingTopups struct {
+	Wallet
+	confirmed int
+}
+
+func (c *countingTopups) ConfirmTopup(ctx context.Context, topupID, userID int64, amount model.Money) error {
+	c.confirmed++
+	return nil
+}
+
+func TestTopupWebhookLookupErrors(t *testing.T) {
+	ctx := context.Background()
+	for _, status := range []string{"PAID", "EXPIRED"} {
+		body := []byte(`{"id":"inv-1","external_id":"topup-1","status":"` + status + `"}`)
+
+		// An invoice we never issued is acknowledged and dropped.
+		lookup, wallet := &topupLookup{err: sql.ErrNoRows}, &countingTopups{}
+		s := &service{wRepo: lookup, wallet: wallet}
+		if err := s.processInvoice(ctx, body); err != nil {
+			t.Errorf("%s, unknown invoice: %v; want it ignored", status, err)
+		}
+
+		// A failed lookup is returned so the event is retried.
+		lookup.err = errors.New("connection refused")
+		if err := s.processInvoice(ctx, body); !errors.Is(err, lookup.err) {
+			t.Errorf("%s, lookup failed: got %v; want the error returned", status, err)
+		}
+
+		lookup.err = nil
+		if err := s.processInvoice(ctx, body); err != nil {
+			t.Errorf("%s: %v", status, err)
+		}
+		if wallet.confirmed+lookup.finished != 1 {
+			t.Errorf("%s: confirmed %d, finished %d; want the top-up handled once", status, wallet.confirmed, lookup.finished)
+		}
+	}
+}
+
+// rentalCalls records which rental invoice callbacks were routed.
+type rentalCalls struct {
+	paid, expired []int64
+}
+
+func (r *rentalCalls) MarkInvoicePaid(ctx context.Context, rentalID int64, invoiceID string) error {
+	r.paid = append(r.paid, rentalID)
+	return nil
+}
+
+func (r *rentalCalls) ExpireInvoice(ctx context.Context, rentalID int64, invoiceID string) error {
+	r.expired = append(r.expired, rentalID)
+	return nil
+}
+
+func TestRentalInvoiceStatuses(t *testing.T) {
+	cases := []struct {
+		status        string
+		paid, expired int
+	}{
+		{"PAID", 1, 0},
+		{"SETTLED", 1, 0},
+		{"EXPIRED", 0, 1},
+		{"PENDING", 0, 0},
+	}
+	for _, c := range cases {
+		rentals := &rentalCalls{}
+		s := &service{rentals: rentals}
+		body := []byte(`{"id":"inv-1","external_id":"` + model.RentalInvoicePrefix + `5","status":"` + c.status + `"}`)
+		if err := s.processInvoice(context.Background(), body); err != nil {
+			t.Fatalf("%s: %v", c.status, err)
+		}
+		if len(rentals.paid) != c.paid || len(rentals.expired) != c.expired {
+			t.Errorf("%s: paid %v, expired %v; want %d paid, %d expired", c.status, rentals.paid, rentals.expired, c.paid, c.expired)
+		}
+		for _, id := range append(rentals.paid, rentals.expired...) {
+			if id != 5 {
+				t.Errorf("%s: routed to rental %d; want 5", c.status, id)
+			}
+		}
+	}
+}
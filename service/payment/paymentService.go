@@ -1,6 +1,8 @@
 package paymentsvc
 
 import (
+	"bookrental/model"
+	paymentrepo "bookrental/repository/payment"
 	walletrepo "bookrental/repository/wallet"
 	xenditrepo "bookrental/repository/xendit"
 	"context"
@@ -8,20 +10,61 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Service interface {
-	HandleXendit(ctx context.Context, sigHeader string, raw []byte) error
+	HandleXendit(ctx context.Context, headers http.Header, raw []byte) error
+	HandleDisbursement(ctx context.Context, headers http.Header, raw []byte) error
+	Events(ctx context.Context, f paymentrepo.EventFilter) ([]model.PaymentEvent, error)
+	ReplayEvent(ctx context.Context, id int64) (*model.PaymentEvent, error)
+
+	Reconcile(ctx context.Context) (*ReconcileReport, error)
+	ReconcileTopups(ctx context.Context) (int, error)
+	LastReconcile() *ReconcileReport
+}
+
+// Config tunes the top-up reconciliation. Top-ups younger than
+// ReconcileMinAge are left to their webhook; ones we expired ourselves are
+// re-checked for ReconcileLookback in case a payment still landed.
+type Config struct {
+	ReconcileMinAge   time.Duration
+	ReconcileLookback time.Duration
+}
+
+// Rentals settles rentals paid by invoice. Implemented by the rental service;
+// kept as an interface here so the packages don't import each other.
+type Rentals interface {
+	MarkInvoicePaid(ctx context.Context, rentalID int64, invoiceID string) error
+	ExpireInvoice(ctx context.Context, rentalID int64, invoiceID string) error
+}
+
+// Wallet credits paid top-ups and settles wallet cash-outs. Implemented by
+// the wallet service, which owns the bonus and payout rules.
+type Wallet interface {
+	ConfirmTopup(ctx context.Context, topupID, userID int64, amount model.Money) error
+	SettleWithdrawal(ctx context.Context, withdrawalID int64, disbursementID string) error
+	ReverseWithdrawal(ctx context.Context, withdrawalID int64, disbursementID, reason string) error
 }
 
 type service struct {
-	db    *sql.DB
-	xv    xenditrepo.Repo
-	wRepo walletrepo.Repo
+	xv      xenditrepo.Repo
+	wRepo   walletrepo.Repo
+	events  paymentrepo.Repo
+	rentals Rentals
+	wallet  Wallet
+	cfg     Config
+
+	mu         sync.Mutex
+	lastReport *ReconcileReport
 }
 
-func New(db *sql.DB, xv xenditrepo.Repo, w walletrepo.Repo) Service {
-	return &service{db: db, xv: xv, wRepo: w}
+func New(xv xenditrepo.Repo, w walletrepo.Repo, events paymentrepo.Repo, rentals Rentals, wallet Wallet, cfg Config) Service {
+	return &service{xv: xv, wRepo: w, events: events, rentals: rentals, wallet: wallet, cfg: cfg}
 }
 
 type xInvoiceEvent struct {
@@ -30,61 +73,119 @@ type xInvoiceEvent struct {
 	ExternalID string `json:"external_id"`
 }
 
-func (s *service) HandleXendit(ctx context.Context, sigHeader string, raw []byte) error {
-	// Verify HMAC signature from Xendit
-	if err := s.xv.VerifyCallbackSignature(sigHeader, raw); err != nil {
-		return fmt.Errorf("invalid callback signature: %w", err)
-	}
+func (s *service) HandleXendit(ctx context.Context, headers http.Header, raw []byte) error {
+	return s.receive(ctx, model.PaymentEventInvoice, headers, raw)
+}
 
-	// Parse JSON
+// processInvoice applies a verified invoice callback.
+func (s *service) processInvoice(ctx context.Context, raw []byte) error {
 	var ev xInvoiceEvent
 	if err := json.Unmarshal(raw, &ev); err != nil {
 		return fmt.Errorf("bad webhook json: %w", err)
 	}
-	if ev.ID == "" || ev.Status == "" {
-		return errors.New("missing invoice fields")
+
+	// Rental invoices carry "rental:<id>"; everything else is a top-up
+	if strings.HasPrefix(ev.ExternalID, model.RentalInvoicePrefix) {
+		return s.onRentalInvoice(ctx, ev)
 	}
 
 	//  Handle event types
 	switch ev.Status {
-	case "PAID":
+	case "PAID", "SETTLED":
 		return s.onTopupPaid(ctx, ev.ID)
 	case "EXPIRED":
-
-		return nil
+		return s.onTopupClosed(ctx, ev.ID, model.TopupExpired)
+	case "FAILED":
+		return s.onTopupClosed(ctx, ev.ID, model.TopupFailed)
 	default:
 
 		return nil
 	}
 }
 
-func (s *service) onTopupPaid(ctx context.Context, invoiceID string) (err error) {
+// onTopupClosed records a top-up that will never be paid. Unknown invoices
+// and top-ups that already left PENDING are ignored; a lookup that fails is
+// returned so the event is retried.
+func (s *service) onTopupClosed(ctx context.Context, invoiceID string, status model.TopupStatus) error {
+	topupID, _, _, current, err := s.wRepo.FindTopupByInvoiceID(ctx, invoiceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("find topup: %w", err)
+	}
+	if current != string(model.TopupPending) {
+		return nil
+	}
+	_, err = s.wRepo.FinishTopup(ctx, topupID, status)
+	return err
+}
 
+// onTopupPaid credits a paid top-up. Unknown invoices are ignored; a lookup
+// that fails is returned so the event is retried.
+func (s *service) onTopupPaid(ctx context.Context, invoiceID string) error {
 	topupID, userID, amt, status, err := s.wRepo.FindTopupByInvoiceID(ctx, invoiceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
 	if err != nil {
+		return fmt.Errorf("find topup: %w", err)
+	}
 
+	if status == "PAID" {
 		return nil
 	}
 
-	if status == "PAID" {
+	// mark paid + credit balance + ledger + bonuses, in the wallet service's tx
+	return s.wallet.ConfirmTopup(ctx, topupID, userID, amt)
+}
+
+func (s *service) onRentalInvoice(ctx context.Context, ev xInvoiceEvent) error {
+	rentalID, err := strconv.ParseInt(strings.TrimPrefix(ev.ExternalID, model.RentalInvoicePrefix), 10, 64)
+	if err != nil || rentalID <= 0 {
+		return fmt.Errorf("bad rental external_id %q", ev.ExternalID)
+	}
+	switch ev.Status {
+	case "PAID", "SETTLED":
+		return s.rentals.MarkInvoicePaid(ctx, rentalID, ev.ID)
+	case "EXPIRED":
+		return s.rentals.ExpireInvoice(ctx, rentalID, ev.ID)
+	default:
 		return nil
 	}
+}
 
-	// tx: mark paid + credit balance + ledger
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
+type xDisbursementEvent struct {
+	ID          string `json:"id"`
+	ExternalID  string `json:"external_id"`
+	Status      string `json:"status"`
+	FailureCode string `json:"failure_code"`
+}
+
+func (s *service) HandleDisbursement(ctx context.Context, headers http.Header, raw []byte) error {
+	return s.receive(ctx, model.PaymentEventDisbursement, headers, raw)
+}
+
+// processDisbursement applies a verified disbursement callback.
+func (s *service) processDisbursement(ctx context.Context, raw []byte) error {
+	var ev xDisbursementEvent
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		return fmt.Errorf("bad webhook json: %w", err)
 	}
-	defer func() {
-		if err != nil {
-			_ = tx.Rollback()
-		}
-	}()
-
-	if err = s.wRepo.MarkTopupPaidAndCredit(ctx, tx, topupID, userID, amt); err != nil {
-		return err
+	if !strings.HasPrefix(ev.ExternalID, model.WithdrawalPrefix) {
+		return fmt.Errorf("unknown disbursement external_id %q", ev.ExternalID)
+	}
+	withdrawalID, err := strconv.ParseInt(strings.TrimPrefix(ev.ExternalID, model.WithdrawalPrefix), 10, 64)
+	if err != nil || withdrawalID <= 0 {
+		return fmt.Errorf("bad withdrawal external_id %q", ev.ExternalID)
 	}
 
-	// Commit
-	return tx.Commit()
+	switch ev.Status {
+	case "COMPLETED":
+		return s.wallet.SettleWithdrawal(ctx, withdrawalID, ev.ID)
+	case "FAILED":
+		return s.wallet.ReverseWithdrawal(ctx, withdrawalID, ev.ID, ev.FailureCode)
+	default:
+		return nil
+	}
 }
@@ -0,0 +1,151 @@
+package paymentsvc
+
+import (
+	"bookrental/model"
+	xenditrepo "bookrental/repository/xendit"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Reconcile actions. Everything but ActionNone ends up in the report.
+const (
+	ActionNone   = ""
+	ActionCredit = "credited" // paid at the provider, webhook never arrived
+	ActionExpire = "expired"
+	ActionFail   = "failed"
+	ActionFlag   = "flagged" // needs a human; nothing was changed
+	ActionError  = "error"   // provider or database call failed; retried next run
+)
+
+// Discrepancy is one top-up whose local state disagreed with the provider.
+type Discrepancy struct {
+	TopupID        int64       `json:"topup_id"`
+	UserID         int64       `json:"user_id"`
+	InvoiceID      string      `json:"invoice_id"`
+	LocalStatus    string      `json:"local_status"`
+	ProviderStatus string      `json:"provider_status,omitempty"`
+	LocalAmount    model.Money `json:"local_amount"`
+	ProviderAmount model.Money `json:"provider_amount,omitempty"`
+	Action         string      `json:"action"`
+	Note           string      `json:"note,omitempty"`
+}
+
+// ReconcileReport is the outcome of one reconciliation run.
+type ReconcileReport struct {
+	StartedAt     time.Time     `json:"started_at"`
+	FinishedAt    time.Time     `json:"finished_at"`
+	Checked       int           `json:"checked"`
+	Fixed         int           `json:"fixed"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// Reconcile asks the provider about every top-up whose webhook may have
+// been lost and settles or closes it through the same code path as the
+// webhook. Amount mismatches and invoices the provider does not know are
+// only reported. The report is kept as the latest run.
+func (s *service) Reconcile(ctx context.Context) (*ReconcileReport, error) {
+	rep := &ReconcileReport{StartedAt: time.Now(), Discrepancies: []Discrepancy{}}
+	topups, err := s.wRepo.ListTopupsToReconcile(ctx, s.cfg.ReconcileMinAge, s.cfg.ReconcileLookback)
+	if err != nil {
+		return nil, fmt.Errorf("list topups: %w", err)
+	}
+
+	for _, t := range topups {
+		if ctx.Err() != nil {
+			break
+		}
+		rep.Checked++
+		d := Discrepancy{
+			TopupID:     t.ID,
+			UserID:      t.UserID,
+			InvoiceID:   *t.XenditInvoiceID,
+			LocalStatus: string(t.Status),
+			LocalAmount: t.Amount,
+		}
+
+		inv, err := s.xv.GetInvoice(d.InvoiceID)
+		switch {
+		case errors.Is(err, xenditrepo.ErrInvoiceNotFound):
+			d.Action, d.Note = ActionFlag, "invoice unknown to provider"
+		case err != nil:
+			d.Action, d.Note = ActionError, err.Error()
+		default:
+			d.ProviderStatus, d.ProviderAmount = inv.Status, inv.Amount
+			d.Action, d.Note = reconcileAction(t, inv)
+		}
+
+		if err := s.applyReconcile(ctx, d); err != nil {
+			d.Action, d.Note = ActionError, err.Error()
+		} else if d.Action == ActionCredit || d.Action == ActionExpire || d.Action == ActionFail {
+			rep.Fixed++
+		}
+		if d.Action != ActionNone {
+			rep.Discrepancies = append(rep.Discrepancies, d)
+		}
+	}
+	rep.FinishedAt = time.Now()
+
+	s.mu.Lock()
+	s.lastReport = rep
+	s.mu.Unlock()
+	return rep, nil
+}
+
+// ReconcileTopups is Reconcile shaped for the background worker; it
+// reports how many top-ups disagreed with the provider.
+func (s *service) ReconcileTopups(ctx context.Context) (int, error) {
+	rep, err := s.Reconcile(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(rep.Discrepancies), nil
+}
+
+// LastReconcile returns the most recent report, or nil before the first run.
+func (s *service) LastReconcile() *ReconcileReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastReport
+}
+
+func (s *service) applyReconcile(ctx context.Context, d Discrepancy) error {
+	switch d.Action {
+	case ActionCredit:
+		return s.onTopupPaid(ctx, d.InvoiceID)
+	case ActionExpire:
+		return s.onTopupClosed(ctx, d.InvoiceID, model.TopupExpired)
+	case ActionFail:
+		return s.onTopupClosed(ctx, d.InvoiceID, model.TopupFailed)
+	}
+	return nil
+}
+
+// reconcileAction decides what to do with a local top-up given the
+// provider's view of its invoice.
+func reconcileAction(t model.WalletTopup, inv *xenditrepo.Invoice) (action, note string) {
+	switch inv.Status {
+	case "PAID", "SETTLED":
+		if inv.Amount != t.Amount {
+			return ActionFlag, fmt.Sprintf("provider amount %s differs from top-up amount %s", inv.Amount, t.Amount)
+		}
+		return ActionCredit, ""
+	case "EXPIRED":
+		if t.Status == model.TopupPending {
+			return ActionExpire, ""
+		}
+	case "FAILED":
+		if t.Status == model.TopupPending {
+			return ActionFail, ""
+		}
+		return ActionFlag, "provider reports FAILED, local " + string(t.Status)
+	case "PENDING":
+		if t.Status == model.TopupExpired {
+			return ActionFlag, "expired locally but still payable at provider"
+		}
+	default:
+		return ActionFlag, "unknown provider status"
+	}
+	return ActionNone, ""
+}
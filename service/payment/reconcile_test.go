@@ -0,0 +1,36 @@
+package paymentsvc
+
+import (
+	"testing"
+
+	"bookrental/model"
+	xenditrepo "bookrental/repository/xendit"
+)
+
+func TestReconcileAction(t *testing.T) {
+	amt := model.Units(50)
+	cases := []struct {
+		name     string
+		local    model.TopupStatus
+		provider string
+		amount   model.Money
+		want     string
+	}{
+		{"paid, webhook lost", model.TopupPending, "PAID", amt, ActionCredit},
+		{"settled after local expiry", model.TopupExpired, "SETTLED", amt, ActionCredit},
+		{"paid with a different amount", model.TopupPending, "PAID", model.Units(5), ActionFlag},
+		{"expired at provider", model.TopupPending, "EXPIRED", amt, ActionExpire},
+		{"both expired", model.TopupExpired, "EXPIRED", amt, ActionNone},
+		{"failed at provider", model.TopupPending, "FAILED", amt, ActionFail},
+		{"still open", model.TopupPending, "PENDING", amt, ActionNone},
+		{"expired here, open there", model.TopupExpired, "PENDING", amt, ActionFlag},
+		{"unknown status", model.TopupPending, "WHATEVER", amt, ActionFlag},
+	}
+	for _, c := range cases {
+		top := model.WalletTopup{Status: c.local, Amount: amt}
+		inv := &xenditrepo.Invoice{Status: c.provider, Amount: c.amount}
+		if got, note := reconcileAction(top, inv); got != c.want {
+			t.Errorf("%s: action = %q (%s); want %q", c.name, got, note, c.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package rental
+
+import (
+	"context"
+	"fmt"
+
+	"bookrental/model"
+	rentalrepo "bookrental/repository/rental"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RentalFilter narrows AdminList.
+type RentalFilter = rentalrepo.RentalFilter
+
+// Admin actions recorded in rental_admin_actions.
+const (
+	actionForceReturn = "FORCE_RETURN"
+	actionForceCancel = "FORCE_CANCEL"
+	actionWaiveFees   = "WAIVE_FEES"
+)
+
+const (
+	defaultAdminPage = 50
+	maxAdminPage     = 200
+)
+
+// WaiveReceipt reports how much was credited back by WaiveFees.
+type WaiveReceipt struct {
+	Waived model.Money `json:"waived"`
+}
+
+// AdminList returns any user's rentals matching f.
+func (s *service) AdminList(ctx context.Context, f RentalFilter) ([]model.Rental, error) {
+	if f.Limit <= 0 {
+		f.Limit = defaultAdminPage
+	}
+	if f.Limit > maxAdminPage {
+		f.Limit = maxAdminPage
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+	rows, err := s.rr.ListRentals(ctx, f)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("list rentals: %v", err)})
+	}
+	return rows, nil
+}
+
+// ForceReturn checks a copy back in on the renter's behalf. Late fees apply
+// as for a normal return; waive them separately if needed.
+// Business rules:
+// - Rental must be ACTIVE (409)
+// - Rental must exist (404)
+func (s *service) ForceReturn(ctx context.Context, adminID, rentalID int64, reason string) (rc *ReturnReceipt, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	var handoff *notice
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else if err = tx.Commit(); err == nil {
+			s.send(ctx, []*notice{handoff})
+		}
+	}()
+
+	r, err := s.loadForUpdate(ctx, tx, rentalID)
+	if err != nil {
+		return nil, err
+	}
+	if rc, handoff, err = s.returnRental(ctx, tx, r); err != nil {
+		return nil, err
+	}
+	if err = s.rr.LogAdminAction(ctx, tx, r.ID, adminID, actionForceReturn, reason, rc.LateFee); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("log action: %v", err)})
+	}
+	return rc, nil
+}
+
+// ForceCancel cancels a BOOKED or PAID rental on the renter's behalf. The
+// renter did not choose this, so the charge is always refunded in full.
+// Business rules:
+// - Rental must be BOOKED or PAID (409)
+// - Rental must exist (404)
+func (s *service) ForceCancel(ctx context.Context, adminID, rentalID int64, reason string) (rc *CancelReceipt, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	var handoff *notice
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else if err = tx.Commit(); err == nil {
+			s.send(ctx, []*notice{handoff})
+		}
+	}()
+
+	r, err := s.loadForUpdate(ctx, tx, rentalID)
+	if err != nil {
+		return nil, err
+	}
+	if rc, handoff, err = s.cancelRental(ctx, tx, r, 100); err != nil {
+		return nil, err
+	}
+	if err = s.rr.LogAdminAction(ctx, tx, r.ID, adminID, actionForceCancel, reason, rc.Refunded); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("log action: %v", err)})
+	}
+	return rc, nil
+}
+
+// WaiveFees credits back the late and replacement charges still standing on
+// a rental with a FEE_WAIVER ledger line and clears the rental's late fee,
+// so detail and history no longer show it.
+// Business rules:
+// - Rental must exist (404)
+// - There must be something left to waive (409)
+func (s *service) WaiveFees(ctx context.Context, adminID, rentalID int64, reason string) (wr *WaiveReceipt, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	r, err := s.loadForUpdate(ctx, tx, rentalID)
+	if err != nil {
+		return nil, err
+	}
+	fees, err := s.wr.OutstandingRentalFees(ctx, tx, r.ID)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("outstanding fees: %v", err)})
+	}
+	if fees <= 0 {
+		return nil, echo.NewHTTPError(409, echo.Map{"message": "no fees to waive"})
+	}
+	if _, err = s.postToWallet(ctx, tx, r, model.LedgerWaiver, fees); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("waive: %v", err)})
+	}
+	if r.LateFee != 0 {
+		if err = s.rr.SetLateFee(ctx, tx, r.ID, 0); err != nil {
+			return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("clear late fee: %v", err)})
+		}
+	}
+	if err = s.rr.LogAdminAction(ctx, tx, r.ID, adminID, actionWaiveFees, reason, fees); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("log action: %v", err)})
+	}
+	return &WaiveReceipt{Waived: fees}, nil
+}
@@ -0,0 +1,89 @@
+package rental
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bookrental/model"
+)
+
+func TestForceReturnChargesLateFee(t *testing.T) {
+	rr, wr := newFakeRentals(), newFakeWallet()
+	rr.lateFeePerDay = model.Units(2)
+	due := time.Now().Add(-3*24*time.Hour - time.Hour)
+	rr.add(model.Rental{ID: 1, UserID: 7, BookID: 1, BookItemID: 11, Status: model.RentalActive, DueAt: &due})
+	s, _ := newTestService(rr, wr, Config{})
+
+	rc, err := s.ForceReturn(context.Background(), 99, 1, "left at the desk")
+	if err != nil {
+		t.Fatalf("ForceReturn: %v", err)
+	}
+	if rr.rentals[1].Status != model.RentalReturned || len(rr.freed) != 1 {
+		t.Errorf("status %s, freed %v; want RETURNED and the copy freed", rr.rentals[1].Status, rr.freed)
+	}
+	if rc.LateFee <= 0 || rr.rentals[1].LateFee != rc.LateFee || wr.bal[7] != -rc.LateFee {
+		t.Errorf("late fee %v, stored %v, balance %v", rc.LateFee, rr.rentals[1].LateFee, wr.bal[7])
+	}
+	if len(rr.adminActions) != 1 || rr.adminActions[0] != actionForceReturn {
+		t.Errorf("admin actions %v", rr.adminActions)
+	}
+}
+
+func TestForceReturnRequiresActive(t *testing.T) {
+	rr, wr := newFakeRentals(), newFakeWallet()
+	rr.add(model.Rental{ID: 1, UserID: 7, Status: model.RentalBooked})
+	s, _ := newTestService(rr, wr, Config{})
+
+	if _, err := s.ForceReturn(context.Background(), 99, 1, "x"); httpCode(err) != 409 {
+		t.Errorf("err = %v; want 409", err)
+	}
+	if _, err := s.ForceReturn(context.Background(), 99, 2, "x"); httpCode(err) != 404 {
+		t.Errorf("unknown rental: err = %v; want 404", err)
+	}
+}
+
+func TestForceCancelRefundsInFull(t *testing.T) {
+	rr, wr := newFakeRentals(), newFakeWallet()
+	rr.add(model.Rental{ID: 1, UserID: 7, BookID: 1, BookItemID: 11, Status: model.RentalPaid, RentalCost: model.Units(40)})
+	wr.ledger = append(wr.ledger, ledgerLine{7, 1, model.LedgerCharge, -model.Units(40)})
+	// The renter's policy would keep half; a forced cancel never does.
+	s, _ := newTestService(rr, wr, Config{CancelRefund: RefundPartial, CancelRefundPercent: 50})
+
+	rc, err := s.ForceCancel(context.Background(), 99, 1, "damaged on the shelf")
+	if err != nil {
+		t.Fatalf("ForceCancel: %v", err)
+	}
+	if rc.Refunded != model.Units(40) || wr.bal[7] != model.Units(40) || rr.rentals[1].Status != model.RentalCanceled {
+		t.Errorf("refunded %v, balance %v, status %s", rc.Refunded, wr.bal[7], rr.rentals[1].Status)
+	}
+
+	rr.add(model.Rental{ID: 2, UserID: 7, Status: model.RentalReturned})
+	if _, err := s.ForceCancel(context.Background(), 99, 2, "x"); httpCode(err) != 409 {
+		t.Errorf("cancel a returned rental: err = %v; want 409", err)
+	}
+}
+
+func TestWaiveFees(t *testing.T) {
+	rr, wr := newFakeRentals(), newFakeWallet()
+	rr.add(model.Rental{ID: 1, UserID: 7, Status: model.RentalReturned, LateFee: model.Units(6)})
+	wr.bal[7] = -model.Units(26)
+	wr.ledger = append(wr.ledger,
+		ledgerLine{7, 1, model.LedgerLate, -model.Units(6)},
+		ledgerLine{7, 1, model.LedgerReplace, -model.Units(20)})
+	s, _ := newTestService(rr, wr, Config{})
+
+	rc, err := s.WaiveFees(context.Background(), 99, 1, "first offence")
+	if err != nil {
+		t.Fatalf("WaiveFees: %v", err)
+	}
+	if rc.Waived != model.Units(26) || wr.bal[7] != 0 {
+		t.Errorf("waived %v, balance %v; want 26.00 and 0", rc.Waived, wr.bal[7])
+	}
+	if rr.rentals[1].LateFee != 0 {
+		t.Errorf("late_fee = %v; want cleared", rr.rentals[1].LateFee)
+	}
+	if _, err := s.WaiveFees(context.Background(), 99, 1, "again"); httpCode(err) != 409 {
+		t.Errorf("second waive: err = %v; want 409", err)
+	}
+}
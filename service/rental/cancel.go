@@ -0,0 +1,92 @@
+package rental
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"bookrental/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RefundPolicy decides how much of a rental's charge comes back when the
+// user cancels before pickup. Once a rental is ACTIVE it cannot be canceled,
+// so nothing is ever refunded after pickup.
+type RefundPolicy string
+
+const (
+	RefundFull    RefundPolicy = "full"
+	RefundPartial RefundPolicy = "partial"
+	RefundNone    RefundPolicy = "none"
+)
+
+// percent is the share of the charge refunded under p; partial is the
+// configured percentage for RefundPartial. Unknown policies refund in full.
+func (p RefundPolicy) percent(partial int) int {
+	switch p {
+	case RefundNone:
+		return 0
+	case RefundPartial:
+		return min(max(partial, 0), 100)
+	default:
+		return 100
+	}
+}
+
+// CancelReceipt is what the user got back for a canceled rental.
+type CancelReceipt struct {
+	Refunded model.Money `json:"refunded"`
+}
+
+// Cancel lets the owner cancel a BOOKED or PAID rental. The copy is released
+// (or handed to the next in line) and the refund is credited, all in one tx.
+// Business rules:
+// - Only owner can cancel (403)
+// - Rental must be BOOKED or PAID (409)
+func (s *service) Cancel(ctx context.Context, userID, rentalID int64) (rc *CancelReceipt, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	var handoff *notice
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else if err = tx.Commit(); err == nil {
+			s.send(ctx, []*notice{handoff})
+		}
+	}()
+
+	r, err := s.loadForUpdate(ctx, tx, rentalID)
+	if err != nil {
+		return nil, err
+	}
+	if r.UserID != userID {
+		return nil, echo.NewHTTPError(403, echo.Map{"message": "not the owner of this rental"})
+	}
+	rc, handoff, err = s.cancelRental(ctx, tx, r, s.cfg.CancelRefund.percent(s.cfg.CancelRefundPercent))
+	return rc, err
+}
+
+// cancelRental moves a locked BOOKED/PAID rental to CANCELED, refunds
+// percent of what was charged and hands the copy on.
+func (s *service) cancelRental(ctx context.Context, tx *sql.Tx, r *model.Rental, percent int) (*CancelReceipt, *notice, error) {
+	if err := s.transition(ctx, tx, r, model.RentalCanceled); err != nil {
+		return nil, nil, err
+	}
+	refunded, err := s.refundCharged(ctx, tx, r, percent)
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("refund: %v", err)})
+	}
+	handoff, err := s.releaseCopy(ctx, tx, r.BookID, r.BookItemID)
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("release copy: %v", err)})
+	}
+	return &CancelReceipt{Refunded: refunded}, handoff, nil
+}
+
+// refundShare is percent of amount, rounded to the cent.
+func refundShare(amount model.Money, percent int) model.Money {
+	return amount.Percent(percent)
+}
@@ -0,0 +1,47 @@
+package rental
+
+import (
+	"testing"
+
+	"bookrental/model"
+)
+
+func TestRefundPolicyPercent(t *testing.T) {
+	cases := []struct {
+		policy  RefundPolicy
+		partial int
+		want    int
+	}{
+		{RefundFull, 50, 100},
+		{RefundNone, 50, 0},
+		{RefundPartial, 50, 50},
+		{RefundPartial, 150, 100},
+		{RefundPartial, -5, 0},
+		{"", 50, 100},
+	}
+	for _, c := range cases {
+		if got := c.policy.percent(c.partial); got != c.want {
+			t.Errorf("%q.percent(%d) = %d; want %d", c.policy, c.partial, got, c.want)
+		}
+	}
+}
+
+func TestRefundShare(t *testing.T) {
+	cases := []struct {
+		amount  model.Money
+		percent int
+		want    model.Money
+	}{
+		{model.Units(15000), 100, model.Units(15000)},
+		{model.Units(15000), 50, model.Units(7500)},
+		{model.Units(15000), 0, 0},
+		{9999, 50, 5000}, // 99.99 → 50.00
+		{1, 50, 1},       // half a cent rounds up
+		{-3, 50, -2},     // and away from zero
+	}
+	for _, c := range cases {
+		if got := refundShare(c.amount, c.percent); got != c.want {
+			t.Errorf("refundShare(%v, %d) = %v; want %v", c.amount, c.percent, got, c.want)
+		}
+	}
+}
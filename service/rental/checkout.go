@@ -0,0 +1,173 @@
+package rental
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"bookrental/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CheckoutItem is one rental created by a checkout.
+type CheckoutItem struct {
+	BookID   int64       `json:"book_id"`
+	RentalID int64       `json:"rental_id"`
+	Price    model.Money `json:"price"`
+}
+
+// CheckoutResult is the order a successful checkout produced.
+type CheckoutResult struct {
+	OrderID int64          `json:"order_id"`
+	Total   model.Money    `json:"total"`
+	Items   []CheckoutItem `json:"items"`
+}
+
+// CheckoutFailure explains why one book in the cart could not be booked.
+type CheckoutFailure struct {
+	BookID int64  `json:"book_id"`
+	Reason string `json:"reason"`
+}
+
+// cartLine is a book whose copy is locked and ready to be booked.
+type cartLine struct {
+	bookID, itemID int64
+	price          model.Money
+}
+
+// Checkout books every title in bookIDs in one tx, as if BookWithDeposit
+// had been called for each, under a shared order. The user row is locked
+// once; each copy is claimed with SKIP LOCKED. If any book cannot be booked
+// nothing is, and the 409 lists a reason per failed book. A title may only
+// be in the cart once. With a slot every copy comes from the slot's branch
+// and is held until the slot ends; the slot must have room for the whole cart.
+func (s *service) Checkout(ctx context.Context, userID int64, bookIDs []int64, holdMinutes int, slotID int64) (res *CheckoutResult, err error) {
+	if len(bookIDs) == 0 {
+		return nil, echo.NewHTTPError(400, echo.Map{"message": "cart is empty"})
+	}
+	seen := make(map[int64]bool, len(bookIDs))
+	for _, id := range bookIDs {
+		if seen[id] {
+			return nil, echo.NewHTTPError(400, echo.Map{"message": fmt.Sprintf("book %d is in the cart twice", id)})
+		}
+		seen[id] = true
+	}
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	deposit, err := s.rr.LockUserForUpdate(ctx, tx, userID)
+	if err != nil {
+		return nil, echo.NewHTTPError(404, echo.Map{"message": "user not found"})
+	}
+	if err = s.checkEligibility(ctx, tx, userID, bookIDs); err != nil {
+		return nil, err
+	}
+
+	var slot *model.PickupSlot
+	if slotID > 0 {
+		if slot, err = s.claimSlot(ctx, tx, slotID); err != nil {
+			return nil, err
+		}
+		if free := slot.Capacity - slot.Booked; free < len(bookIDs) {
+			return nil, echo.NewHTTPError(409, echo.Map{"message": "pickup slot is full", "free": free})
+		}
+	}
+
+	var (
+		lines    []cartLine
+		failures []CheckoutFailure
+		total    model.Money
+	)
+	for _, bookID := range bookIDs {
+		price, err := s.rr.GetBookPrice(ctx, tx, bookID)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("book price: %w", err)
+			}
+			failures = append(failures, CheckoutFailure{BookID: bookID, Reason: "book not found"})
+			continue
+		}
+		var itemID int64
+		reason := "no available copy"
+		if slot != nil {
+			itemID, err = s.rr.LockAvailableItemAt(ctx, tx, bookID, slot.Branch)
+			reason += " at " + slot.Branch
+		} else {
+			itemID, err = s.rr.LockOneAvailableItem(ctx, tx, bookID)
+		}
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("lock item: %w", err)
+			}
+			failures = append(failures, CheckoutFailure{BookID: bookID, Reason: reason})
+			continue
+		}
+		lines = append(lines, cartLine{bookID: bookID, itemID: itemID, price: price})
+		total += price
+	}
+	if len(failures) > 0 {
+		return nil, echo.NewHTTPError(409, echo.Map{"message": "checkout failed", "failures": failures})
+	}
+	if deposit < total {
+		return nil, echo.NewHTTPError(402, echo.Map{
+			"message": "insufficient deposit",
+			"total":   total,
+			"needed":  total - deposit,
+		})
+	}
+
+	if holdMinutes <= 0 {
+		holdMinutes = defaultHoldMinutes
+	}
+	dueAt := time.Now().Add(time.Duration(holdMinutes) * time.Minute)
+	if slot != nil {
+		dueAt = slot.EndsAt
+	}
+
+	res = &CheckoutResult{Total: total}
+	rentalIDs := make([]int64, 0, len(lines))
+	for _, l := range lines {
+		if err = s.rr.ReserveItem(ctx, tx, l.itemID, &dueAt); err != nil {
+			return nil, fmt.Errorf("reserve item: %w", err)
+		}
+		rentalID, err := s.rr.InsertRental(ctx, tx, userID, l.bookID, l.itemID, l.price, dueAt)
+		if err != nil {
+			return nil, fmt.Errorf("insert rental: %w", err)
+		}
+		if slot != nil {
+			if err = s.rr.SetPickupSlot(ctx, tx, rentalID, slot.ID); err != nil {
+				return nil, fmt.Errorf("set slot: %w", err)
+			}
+		}
+		r := &model.Rental{ID: rentalID, UserID: userID, BookID: l.bookID, BookItemID: l.itemID,
+			Status: model.RentalBooked, RentalCost: l.price, PaymentDueAt: dueAt}
+		if err = s.payFromDeposit(ctx, tx, r, deposit); err != nil {
+			return nil, err
+		}
+		deposit -= l.price
+
+		rentalIDs = append(rentalIDs, rentalID)
+		res.Items = append(res.Items, CheckoutItem{BookID: l.bookID, RentalID: rentalID, Price: l.price})
+	}
+
+	if res.OrderID, err = s.rr.CreateOrder(ctx, tx, userID, total); err != nil {
+		return nil, fmt.Errorf("create order: %w", err)
+	}
+	if err = s.rr.AttachToOrder(ctx, tx, res.OrderID, rentalIDs); err != nil {
+		return nil, fmt.Errorf("attach to order: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,111 @@
+package rental
+
+import (
+	"context"
+	"testing"
+
+	"bookrental/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// checkoutFixture has user 7 with a 100.00 deposit and three titles at
+// 40.00 each; book 3 has no free copy.
+func checkoutFixture() (*fakeRentals, *fakeWallet) {
+	rr, wr := newFakeRentals(), newFakeWallet()
+	rr.deposits[7] = model.Units(100)
+	for book := int64(1); book <= 3; book++ {
+		rr.prices[book] = model.Units(40)
+	}
+	rr.items[11] = 1
+	rr.items[21] = 2
+	rr.items[22] = 2
+	return rr, wr
+}
+
+func httpCode(err error) int {
+	if he, ok := err.(*echo.HTTPError); ok {
+		return he.Code
+	}
+	return 0
+}
+
+func TestCheckoutBooksWholeCart(t *testing.T) {
+	rr, wr := checkoutFixture()
+	s, db := newTestService(rr, wr, Config{})
+
+	res, err := s.Checkout(context.Background(), 7, []int64{1, 2}, 0, 0)
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	if res.Total != model.Units(80) || len(res.Items) != 2 || len(rr.orders[res.OrderID]) != 2 {
+		t.Errorf("total %v, %d items, order %v; want 80.00 over 2 rentals", res.Total, len(res.Items), rr.orders[res.OrderID])
+	}
+	if rr.deposits[7] != model.Units(20) {
+		t.Errorf("deposit left %v; want 20.00", rr.deposits[7])
+	}
+	for _, it := range res.Items {
+		if rr.rentals[it.RentalID].Status != model.RentalPaid {
+			t.Errorf("rental %d is %s; want PAID", it.RentalID, rr.rentals[it.RentalID].Status)
+		}
+	}
+	if db.Commits() != 1 {
+		t.Errorf("commits = %d; want 1", db.Commits())
+	}
+}
+
+func TestCheckoutInsufficientDeposit(t *testing.T) {
+	rr, wr := checkoutFixture()
+	rr.deposits[7] = model.Units(50)
+	s, db := newTestService(rr, wr, Config{})
+
+	_, err := s.Checkout(context.Background(), 7, []int64{1, 2}, 0, 0)
+	if httpCode(err) != 402 {
+		t.Fatalf("err = %v; want 402", err)
+	}
+	if needed := err.(*echo.HTTPError).Message.(echo.Map)["needed"]; needed != model.Units(30) {
+		t.Errorf("needed = %v; want 30.00", needed)
+	}
+	if len(rr.rentals) != 0 || len(wr.ledger) != 0 || db.Rollbacks() != 1 {
+		t.Errorf("%d rentals, %d ledger lines, %d rollbacks; want nothing booked and the tx rolled back",
+			len(rr.rentals), len(wr.ledger), db.Rollbacks())
+	}
+}
+
+func TestCheckoutReportsEachFailedBook(t *testing.T) {
+	rr, wr := checkoutFixture()
+	s, db := newTestService(rr, wr, Config{})
+
+	_, err := s.Checkout(context.Background(), 7, []int64{1, 3, 9}, 0, 0)
+	if httpCode(err) != 409 {
+		t.Fatalf("err = %v; want 409", err)
+	}
+	failures := err.(*echo.HTTPError).Message.(echo.Map)["failures"].([]CheckoutFailure)
+	want := []CheckoutFailure{{3, "no available copy"}, {9, "book not found"}}
+	if len(failures) != len(want) {
+		t.Fatalf("failures = %v; want %v", failures, want)
+	}
+	for i := range want {
+		if failures[i] != want[i] {
+			t.Errorf("failure %d = %v; want %v", i, failures[i], want[i])
+		}
+	}
+	// Book 1 was bookable, but all-or-nothing means it is not booked.
+	if len(rr.rentals) != 0 || rr.deposits[7] != model.Units(100) || db.Rollbacks() != 1 {
+		t.Errorf("%d rentals, deposit %v, %d rollbacks; want nothing booked",
+			len(rr.rentals), rr.deposits[7], db.Rollbacks())
+	}
+}
+
+func TestCheckoutRejectsDuplicateBooks(t *testing.T) {
+	rr, wr := checkoutFixture()
+	s, db := newTestService(rr, wr, Config{})
+
+	_, err := s.Checkout(context.Background(), 7, []int64{2, 1, 2}, 0, 0)
+	if httpCode(err) != 400 {
+		t.Fatalf("err = %v; want 400", err)
+	}
+	if len(rr.rentals) != 0 || db.Commits()+db.Rollbacks() != 0 {
+		t.Error("duplicate cart should be refused before any tx is opened")
+	}
+}
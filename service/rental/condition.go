@@ -0,0 +1,88 @@
+package rental
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"bookrental/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ConditionReceipt is what a LOST/DAMAGED report cost the renter.
+type ConditionReceipt struct {
+	Condition         model.BookItemStatus `json:"condition"`
+	ReplacementCharge model.Money          `json:"replacement_charge"`
+	LateFee           model.Money          `json:"late_fee"`
+	BalanceAfter      model.Money          `json:"balance_after"`
+	InDebt            bool                 `json:"in_debt"`
+}
+
+// ReportCondition closes an ACTIVE rental whose copy was lost or came back
+// damaged. The copy leaves circulation, and the renter is charged charge (or
+// the book's replacement_cost when nil) even if that drives the balance
+// negative. A DAMAGED copy counts as returned, so late fees still apply; a
+// LOST one moves the rental to LOST.
+func (s *service) ReportCondition(ctx context.Context, rentalID int64, condition model.BookItemStatus, charge *model.Money) (rc *ConditionReceipt, err error) {
+	if condition != model.ItemLost && condition != model.ItemDamaged {
+		return nil, echo.NewHTTPError(400, echo.Map{"message": "condition must be LOST or DAMAGED"})
+	}
+	if charge != nil && *charge < 0 {
+		return nil, echo.NewHTTPError(400, echo.Map{"message": "charge must be >= 0"})
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	r, err := s.loadForUpdate(ctx, tx, rentalID)
+	if err != nil {
+		return nil, err
+	}
+	to := model.RentalReturned
+	if condition == model.ItemLost {
+		to = model.RentalLost
+	}
+	if err = s.transition(ctx, tx, r, to); err != nil {
+		return nil, err
+	}
+	if err = s.rr.MarkItemCondition(ctx, tx, r.BookItemID, condition); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("mark item: %v", err)})
+	}
+
+	rc = &ConditionReceipt{Condition: condition}
+	if condition == model.ItemDamaged {
+		late, err := s.chargeLateFee(ctx, tx, r, time.Now())
+		if err != nil {
+			return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("late fee: %v", err)})
+		}
+		rc.LateFee = late.LateFee
+	}
+
+	amount, err := s.rr.GetReplacementCost(ctx, tx, r.BookID)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("replacement cost: %v", err)})
+	}
+	if charge != nil {
+		amount = *charge
+	}
+	if amount > 0 {
+		if rc.BalanceAfter, err = s.postToWallet(ctx, tx, r, model.LedgerReplace, -amount); err != nil {
+			return nil, echo.NewHTTPError(500, echo.Map{"message": err.Error()})
+		}
+	} else if rc.BalanceAfter, err = s.wr.GetUserBalanceForUpdate(ctx, tx, r.UserID); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("balance: %v", err)})
+	}
+	rc.ReplacementCharge = amount
+	rc.InDebt = rc.BalanceAfter < 0
+	return rc, nil
+}
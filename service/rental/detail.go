@@ -0,0 +1,110 @@
+package rental
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"bookrental/model"
+	walletrepo "bookrental/repository/wallet"
+
+	"github.com/labstack/echo/v4"
+)
+
+// LedgerLine is a wallet ledger entry posted against a rental.
+type LedgerLine struct {
+	ID           int64       `json:"id"`
+	EntryType    string      `json:"entry_type"`
+	Amount       model.Money `json:"amount"`
+	BalanceAfter model.Money `json:"balance_after"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// TimelineEvent is one step in a rental's life.
+type TimelineEvent struct {
+	At     time.Time    `json:"at"`
+	Event  string       `json:"event"`
+	Amount *model.Money `json:"amount,omitempty"`
+}
+
+// RentalDetail is everything known about one rental.
+type RentalDetail struct {
+	Rental   *model.Rental   `json:"rental"`
+	CopyID   int64           `json:"copy_id"`
+	Ledger   []LedgerLine    `json:"ledger"`
+	Timeline []TimelineEvent `json:"timeline"`
+}
+
+// Detail returns a rental with its ledger lines and timeline.
+// Rules:
+// - Rental must exist (404)
+// - Only owner or an admin can view it (403)
+func (s *service) Detail(ctx context.Context, userID, rentalID int64, admin bool) (*RentalDetail, error) {
+	r, err := s.rr.GetByID(ctx, rentalID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, echo.NewHTTPError(404, echo.Map{"message": "rental not found"})
+		}
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("load rental: %v", err)})
+	}
+	if r.UserID != userID && !admin {
+		return nil, echo.NewHTTPError(403, echo.Map{"message": "not the owner of this rental"})
+	}
+
+	rows, err := s.wr.ListRentalLedger(ctx, rentalID)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("list ledger: %v", err)})
+	}
+	lines := ledgerLines(rows)
+
+	return &RentalDetail{
+		Rental:   r,
+		CopyID:   r.BookItemID,
+		Ledger:   lines,
+		Timeline: timeline(r, lines),
+	}, nil
+}
+
+func ledgerLines(rows []walletrepo.LedgerRow) []LedgerLine {
+	out := make([]LedgerLine, 0, len(rows))
+	for _, l := range rows {
+		out = append(out, LedgerLine{
+			ID:           l.ID,
+			EntryType:    l.EntryType,
+			Amount:       l.Amount,
+			BalanceAfter: l.BalanceAfter,
+			CreatedAt:    l.CreatedAt,
+		})
+	}
+	return out
+}
+
+// timeline merges the rental's status timestamps with its ledger lines in
+// chronological order. Ties keep status changes ahead of money movements.
+func timeline(r *model.Rental, ledger []LedgerLine) []TimelineEvent {
+	events := []TimelineEvent{{At: r.BookedAt, Event: string(model.RentalBooked)}}
+	stamps := []struct {
+		at    *time.Time
+		event model.RentalStatus
+	}{
+		{r.PaidAt, model.RentalPaid},
+		{r.ActivatedAt, model.RentalActive},
+		{r.ReturnedAt, model.RentalReturned},
+		{r.CanceledAt, model.RentalCanceled},
+		{r.LostAt, model.RentalLost},
+	}
+	for _, st := range stamps {
+		if st.at != nil {
+			events = append(events, TimelineEvent{At: *st.at, Event: string(st.event)})
+		}
+	}
+	for _, l := range ledger {
+		amount := l.Amount
+		events = append(events, TimelineEvent{At: l.CreatedAt, Event: l.EntryType, Amount: &amount})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+	return events
+}
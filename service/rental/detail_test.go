@@ -0,0 +1,48 @@
+package rental
+
+import (
+	"testing"
+	"time"
+
+	"bookrental/model"
+)
+
+func TestTimelineOrdersStatusesAndLedger(t *testing.T) {
+	booked := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	paid := booked.Add(10 * time.Minute)
+	active := booked.Add(2 * time.Hour)
+	returned := booked.Add(8 * 24 * time.Hour)
+	r := &model.Rental{
+		Status:      model.RentalReturned,
+		BookedAt:    booked,
+		PaidAt:      &paid,
+		ActivatedAt: &active,
+		ReturnedAt:  &returned,
+	}
+	ledger := []LedgerLine{
+		{EntryType: "LATE_FEE", Amount: -2500, CreatedAt: returned},
+		{EntryType: "RENTAL_CHARGE", Amount: -10000, CreatedAt: paid},
+	}
+
+	got := timeline(r, ledger)
+	want := []string{"BOOKED", "PAID", "RENTAL_CHARGE", "ACTIVE", "RETURNED", "LATE_FEE"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events; want %d", len(got), len(want))
+	}
+	for i, ev := range got {
+		if ev.Event != want[i] {
+			t.Errorf("event %d: got %s; want %s", i, ev.Event, want[i])
+		}
+	}
+	if got[2].Amount == nil || *got[2].Amount != -10000 {
+		t.Errorf("charge amount not carried into timeline: %+v", got[2])
+	}
+}
+
+func TestTimelineSkipsMissingStamps(t *testing.T) {
+	r := &model.Rental{Status: model.RentalBooked, BookedAt: time.Now()}
+	got := timeline(r, nil)
+	if len(got) != 1 || got[0].Event != "BOOKED" {
+		t.Fatalf("got %+v; want only BOOKED", got)
+	}
+}
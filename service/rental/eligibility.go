@@ -0,0 +1,171 @@
+package rental
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	rentalrepo "bookrental/repository/rental"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Borrower is a user's standing at the moment they ask to borrow.
+type Borrower = rentalrepo.BorrowerStats
+
+// Violation is one eligibility rule a borrowing request failed.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Rule decides whether b may take out one more copy of each title in
+// categories (one entry per requested book). It returns nil to allow.
+type Rule interface {
+	Check(b *Borrower, categories []string, now time.Time) *Violation
+}
+
+// MaxConcurrent caps how many rentals a user may hold at once. Holds
+// (BOOKED, PAID) count alongside ACTIVE loans, otherwise the cap could be
+// dodged by booking and never picking up. limit <= 0 disables it.
+func MaxConcurrent(limit int) Rule { return maxConcurrent{limit} }
+
+type maxConcurrent struct{ limit int }
+
+func (r maxConcurrent) Check(b *Borrower, categories []string, _ time.Time) *Violation {
+	if r.limit <= 0 || b.Open+len(categories) <= r.limit {
+		return nil
+	}
+	return &Violation{
+		Rule:    "max_concurrent_rentals",
+		Message: fmt.Sprintf("at most %d rentals at a time; you have %d", r.limit, b.Open),
+	}
+}
+
+// NoOverdue blocks borrowing while any loan is past its due date.
+func NoOverdue() Rule { return noOverdue{} }
+
+type noOverdue struct{}
+
+func (noOverdue) Check(b *Borrower, _ []string, _ time.Time) *Violation {
+	if b.Overdue == 0 {
+		return nil
+	}
+	return &Violation{
+		Rule:    "no_overdue_items",
+		Message: fmt.Sprintf("return your %d overdue item(s) first", b.Overdue),
+	}
+}
+
+// NoDebt blocks borrowing while the deposit balance is negative.
+func NoDebt() Rule { return noDebt{} }
+
+type noDebt struct{}
+
+func (noDebt) Check(b *Borrower, _ []string, _ time.Time) *Violation {
+	if b.Balance >= 0 {
+		return nil
+	}
+	return &Violation{
+		Rule:    "no_negative_balance",
+		Message: fmt.Sprintf("settle your balance of %s first", b.Balance),
+	}
+}
+
+// CategoryLimits caps open rentals per book category. Category names are
+// matched case-insensitively; categories not listed are unlimited.
+func CategoryLimits(limits map[string]int) Rule {
+	norm := make(map[string]int, len(limits))
+	for c, n := range limits {
+		norm[strings.ToLower(c)] = n
+	}
+	return categoryLimits(norm)
+}
+
+type categoryLimits map[string]int
+
+func (r categoryLimits) Check(b *Borrower, categories []string, _ time.Time) *Violation {
+	want := map[string]int{}
+	for _, c := range categories {
+		want[strings.ToLower(c)]++
+	}
+	held := map[string]int{}
+	for c, n := range b.ByCategory {
+		held[strings.ToLower(c)] += n
+	}
+	var over []string
+	for c, n := range want {
+		if limit, ok := r[c]; ok && held[c]+n > limit {
+			over = append(over, fmt.Sprintf("%s (max %d, you have %d)", c, limit, held[c]))
+		}
+	}
+	if len(over) == 0 {
+		return nil
+	}
+	return &Violation{
+		Rule:    "category_limit",
+		Message: "category limit reached: " + strings.Join(over, ", "),
+	}
+}
+
+// MinAccountAge requires the account to exist for at least min before
+// borrowing. min <= 0 disables it.
+func MinAccountAge(min time.Duration) Rule { return minAccountAge{min} }
+
+type minAccountAge struct{ min time.Duration }
+
+func (r minAccountAge) Check(b *Borrower, _ []string, now time.Time) *Violation {
+	if r.min <= 0 || now.Sub(b.CreatedAt) >= r.min {
+		return nil
+	}
+	return &Violation{
+		Rule:    "min_account_age",
+		Message: fmt.Sprintf("accounts can borrow from %s", b.CreatedAt.Add(r.min).Format(time.RFC3339)),
+	}
+}
+
+// evaluate runs every rule and collects the failures.
+func evaluate(rules []Rule, b *Borrower, categories []string, now time.Time) []Violation {
+	var failed []Violation
+	for _, r := range rules {
+		if v := r.Check(b, categories, now); v != nil {
+			failed = append(failed, *v)
+		}
+	}
+	return failed
+}
+
+// checkEligibility runs the configured rules for userID borrowing bookIDs.
+// The user row must already be locked in tx so concurrent bookings by the
+// same user see each other's rentals. Unknown books are skipped here and
+// reported by the caller.
+func (s *service) checkEligibility(ctx context.Context, tx *sql.Tx, userID int64, bookIDs []int64) error {
+	if len(s.cfg.Rules) == 0 {
+		return nil
+	}
+	b, err := s.rr.BorrowerStats(ctx, tx, userID)
+	if err != nil {
+		return echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("borrower stats: %v", err)})
+	}
+	categories := make([]string, 0, len(bookIDs))
+	for _, id := range bookIDs {
+		c, err := s.rr.BookCategory(ctx, tx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("book category: %v", err)})
+		}
+		categories = append(categories, c)
+	}
+	if failed := evaluate(s.cfg.Rules, b, categories, time.Now()); len(failed) > 0 {
+		return echo.NewHTTPError(422, echo.Map{
+			"message":      "not eligible to borrow",
+			"failed_rules": failed,
+		})
+	}
+	return nil
+}
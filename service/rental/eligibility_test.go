@@ -0,0 +1,63 @@
+package rental
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEligibilityRules(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	good := func() *Borrower {
+		return &Borrower{
+			CreatedAt:  now.Add(-30 * 24 * time.Hour),
+			Balance:    50000,
+			Open:       2,
+			ByCategory: map[string]int{"Comics": 2},
+		}
+	}
+	rules := []Rule{
+		MaxConcurrent(3),
+		NoOverdue(),
+		NoDebt(),
+		CategoryLimits(map[string]int{"comics": 3}),
+		MinAccountAge(7 * 24 * time.Hour),
+	}
+
+	cases := []struct {
+		name   string
+		tweak  func(b *Borrower)
+		cats   []string
+		failed []string
+	}{
+		{"all pass", func(b *Borrower) {}, []string{"comics"}, nil},
+		{"too many open", func(b *Borrower) { b.Open = 3 }, []string{"novel"}, []string{"max_concurrent_rentals"}},
+		{"cart pushes over cap", func(b *Borrower) {}, []string{"novel", "novel"}, []string{"max_concurrent_rentals"}},
+		{"overdue", func(b *Borrower) { b.Overdue = 1 }, []string{"novel"}, []string{"no_overdue_items"}},
+		{"in debt", func(b *Borrower) { b.Balance = -1 }, []string{"novel"}, []string{"no_negative_balance"}},
+		{"category full", func(b *Borrower) { b.ByCategory["Comics"] = 3; b.Open = 1 }, []string{"Comics"}, []string{"category_limit"}},
+		{"new account", func(b *Borrower) { b.CreatedAt = now.Add(-time.Hour) }, []string{"novel"}, []string{"min_account_age"}},
+		{"several at once", func(b *Borrower) { b.Overdue = 2; b.Balance = -10 }, []string{"novel"}, []string{"no_overdue_items", "no_negative_balance"}},
+	}
+	for _, c := range cases {
+		b := good()
+		c.tweak(b)
+		got := evaluate(rules, b, c.cats, now)
+		if len(got) != len(c.failed) {
+			t.Errorf("%s: got %v; want rules %v", c.name, got, c.failed)
+			continue
+		}
+		for i := range got {
+			if got[i].Rule != c.failed[i] {
+				t.Errorf("%s: failure %d got %s; want %s", c.name, i, got[i].Rule, c.failed[i])
+			}
+		}
+	}
+}
+
+func TestEligibilityRulesDisabledByZero(t *testing.T) {
+	b := &Borrower{CreatedAt: time.Now(), Open: 100}
+	rules := []Rule{MaxConcurrent(0), MinAccountAge(0), CategoryLimits(nil)}
+	if got := evaluate(rules, b, []string{"any"}, time.Now()); len(got) != 0 {
+		t.Fatalf("got %v; want no failures", got)
+	}
+}
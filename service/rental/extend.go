@@ -0,0 +1,107 @@
+package rental
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"bookrental/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ExtendReceipt is the new due date and what the renewal cost.
+type ExtendReceipt struct {
+	DueAt        time.Time   `json:"due_at"`
+	Charged      model.Money `json:"charged"`
+	RenewalCount int         `json:"renewal_count"`
+}
+
+// proRated is the share of a full-period cost for days of a rentalDays loan.
+func proRated(cost model.Money, rentalDays, days int) model.Money {
+	if rentalDays <= 0 {
+		return cost
+	}
+	return cost.MulDiv(int64(days), int64(rentalDays))
+}
+
+// Extend renews an ACTIVE rental by days.
+// Business rules:
+// - Only owner can extend (403)
+// - Rental must be ACTIVE and not yet overdue (409)
+// - No one may be waiting for the same book (409)
+// - Renewal count must stay within the configured maximum (409)
+// - Deposit must cover the pro-rated cost (402)
+func (s *service) Extend(ctx context.Context, userID, rentalID int64, days int) (rc *ExtendReceipt, err error) {
+	if days <= 0 || (s.cfg.MaxExtendDays > 0 && days > s.cfg.MaxExtendDays) {
+		return nil, echo.NewHTTPError(400, echo.Map{"message": "invalid days", "max_days": s.cfg.MaxExtendDays})
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	r, err := s.loadForUpdate(ctx, tx, rentalID)
+	if err != nil {
+		return nil, err
+	}
+	if r.UserID != userID {
+		return nil, echo.NewHTTPError(403, echo.Map{"message": "not the owner of this rental"})
+	}
+	if r.Status != model.RentalActive || r.DueAt == nil {
+		return nil, echo.NewHTTPError(409, echo.Map{"message": "rental is not ACTIVE"})
+	}
+	if time.Now().After(*r.DueAt) {
+		return nil, echo.NewHTTPError(409, echo.Map{"message": "rental is overdue, return it instead"})
+	}
+	if r.RenewalCount >= s.cfg.MaxRenewals {
+		return nil, echo.NewHTTPError(409, echo.Map{
+			"message":      "renewal limit reached",
+			"max_renewals": s.cfg.MaxRenewals,
+		})
+	}
+
+	waiting, err := s.rr.CountWaiting(ctx, tx, r.BookID)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("count waitlist: %v", err)})
+	}
+	if waiting > 0 {
+		return nil, echo.NewHTTPError(409, echo.Map{"message": "another reader is waiting for this book"})
+	}
+
+	rentalDays, _, err := s.rr.GetLoanTerms(ctx, tx, r.BookID)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("loan terms: %v", err)})
+	}
+	cost := proRated(r.RentalCost, rentalDays, days)
+
+	bal, err := s.wr.GetUserBalanceForUpdate(ctx, tx, userID)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("lock balance: %v", err)})
+	}
+	if bal < cost {
+		return nil, echo.NewHTTPError(402, echo.Map{
+			"message": "insufficient deposit",
+			"needed":  cost - bal,
+		})
+	}
+
+	due, err := s.rr.Extend(ctx, tx, r.ID, days)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("extend rental: %v", err)})
+	}
+	if cost > 0 {
+		if _, err = s.postToWallet(ctx, tx, r, model.LedgerCharge, -cost); err != nil {
+			return nil, echo.NewHTTPError(500, echo.Map{"message": err.Error()})
+		}
+	}
+	return &ExtendReceipt{DueAt: due, Charged: cost, RenewalCount: r.RenewalCount + 1}, nil
+}
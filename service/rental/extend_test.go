@@ -0,0 +1,27 @@
+package rental
+
+import (
+	"testing"
+
+	"bookrental/model"
+)
+
+func TestProRated(t *testing.T) {
+	cases := []struct {
+		cost             model.Money
+		rentalDays, days int
+		want             model.Money
+	}{
+		{model.Units(14000), 7, 7, model.Units(14000)},
+		{model.Units(14000), 7, 3, model.Units(6000)},
+		{model.Units(10000), 3, 1, 333333}, // 3333.33
+		{model.Units(10000), 3, 2, 666667}, // 6666.67
+		{model.Units(10000), 0, 5, model.Units(10000)},
+		{0, 7, 3, 0},
+	}
+	for _, c := range cases {
+		if got := proRated(c.cost, c.rentalDays, c.days); got != c.want {
+			t.Errorf("proRated(%v, %d, %d) = %v; want %v", c.cost, c.rentalDays, c.days, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,450 @@
+package rental
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"bookrental/model"
+	rentalrepo "bookrental/repository/rental"
+	walletrepo "bookrental/repository/wallet"
+	xenditrepo "bookrental/repository/xendit"
+	"bookrental/util/sqlstub"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeRentals is an in-memory rental repository for service tests. Methods
+// a test does not need fall through to the nil embedded Repo and panic.
+type fakeRentals struct {
+	rentalrepo.Repo
+
+	rentals  map[int64]*model.Rental
+	items    map[int64]int64 // item id → book id, for free copies only
+	prices   map[int64]model.Money
+	deposits map[int64]model.Money
+	nextID   int64
+	orders   map[int64][]int64 // order id → rental ids
+	branches map[int64]string  // item id → branch
+	slots    map[int64]*model.PickupSlot
+
+	expired, missed []model.Rental
+	waitlist        []*waitEntry // in join order
+	stats           map[int64]*Borrower
+
+	transitionErr map[int64]error // rental id → error from Transition
+	lateFeeErr    error           // returned by SetLateFee
+	freed         []int64
+	reserved      []int64
+	lateFeePerDay model.Money
+	adminActions  []string
+}
+
+// waitEntry is one book_waitlist row.
+type waitEntry struct {
+	id, bookID, userID int64
+	status             string
+	rentalID           int64
+}
+
+func newFakeRentals() *fakeRentals {
+	return &fakeRentals{
+		rentals:       map[int64]*model.Rental{},
+		items:         map[int64]int64{},
+		prices:        map[int64]model.Money{},
+		deposits:      map[int64]model.Money{},
+		orders:        map[int64][]int64{},
+		branches:      map[int64]string{},
+		slots:         map[int64]*model.PickupSlot{},
+		nextID:        100,
+		transitionErr: map[int64]error{},
+		stats:         map[int64]*Borrower{},
+	}
+}
+
+func (f *fakeRentals) add(r model.Rental) *model.Rental {
+	f.rentals[r.ID] = &r
+	return &r
+}
+
+func (f *fakeRentals) LockUserForUpdate(ctx context.Context, tx *sql.Tx, userID int64) (model.Money, error) {
+	d, ok := f.deposits[userID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return d, nil
+}
+
+// BorrowerStats is stats[userID], or a long-standing user with nothing open.
+func (f *fakeRentals) BorrowerStats(ctx context.Context, tx *sql.Tx, userID int64) (*Borrower, error) {
+	if b, ok := f.stats[userID]; ok {
+		return b, nil
+	}
+	return &Borrower{CreatedAt: time.Now().AddDate(-1, 0, 0), ByCategory: map[string]int{}}, nil
+}
+
+func (f *fakeRentals) BookCategory(ctx context.Context, tx *sql.Tx, bookID int64) (string, error) {
+	return "novel", nil
+}
+
+func (f *fakeRentals) DeductDeposit(ctx context.Context, tx *sql.Tx, userID int64, amount model.Money) error {
+	if f.deposits[userID] < amount {
+		return errors.New("insufficient deposit")
+	}
+	f.deposits[userID] -= amount
+	return nil
+}
+
+func (f *fakeRentals) CreateOrder(ctx context.Context, tx *sql.Tx, userID int64, total model.Money) (int64, error) {
+	id := int64(len(f.orders) + 1)
+	f.orders[id] = nil
+	return id, nil
+}
+
+func (f *fakeRentals) AttachToOrder(ctx context.Context, tx *sql.Tx, orderID int64, rentalIDs []int64) error {
+	f.orders[orderID] = rentalIDs
+	return nil
+}
+
+func (f *fakeRentals) GetForUpdate(ctx context.Context, tx *sql.Tx, id int64) (*model.Rental, error) {
+	r, ok := f.rentals[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	cp := *r
+	return &cp, nil
+}
+
+func (f *fakeRentals) GetByID(ctx context.Context, id int64) (*model.Rental, error) {
+	return f.GetForUpdate(ctx, nil, id)
+}
+
+func (f *fakeRentals) Transition(ctx context.Context, tx *sql.Tx, id int64, from, to model.RentalStatus) error {
+	if err := f.transitionErr[id]; err != nil {
+		return err
+	}
+	r, ok := f.rentals[id]
+	if !ok || r.Status != from {
+		return rentalrepo.ErrStatusChanged
+	}
+	r.Status = to
+	return nil
+}
+
+func (f *fakeRentals) LockExpiredHolds(ctx context.Context, tx *sql.Tx, limit int) ([]model.Rental, error) {
+	return f.expired, nil
+}
+
+// LockMissedPickups returns missed plus every PAID rental whose slot ended.
+func (f *fakeRentals) LockMissedPickups(ctx context.Context, tx *sql.Tx, limit int) ([]model.Rental, error) {
+	out := append([]model.Rental(nil), f.missed...)
+	for _, r := range f.rentals {
+		if r.Status != model.RentalPaid || r.PickupSlotID == nil {
+			continue
+		}
+		if slot, ok := f.slots[*r.PickupSlotID]; ok && slot.EndsAt.Before(time.Now()) {
+			out = append(out, *r)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRentals) FreeCopy(ctx context.Context, tx *sql.Tx, itemID int64) error {
+	f.freed = append(f.freed, itemID)
+	return nil
+}
+
+// wait queues userID for bookID as the repo's JoinWaitlist would.
+func (f *fakeRentals) wait(bookID, userID int64) *waitEntry {
+	e := &waitEntry{id: int64(len(f.waitlist) + 1), bookID: bookID, userID: userID, status: "WAITING"}
+	f.waitlist = append(f.waitlist, e)
+	return e
+}
+
+func (f *fakeRentals) SkipWaiting(ctx context.Context, tx *sql.Tx, entryID int64) error {
+	f.waitlist[entryID-1].status = "SKIPPED"
+	return nil
+}
+
+// LockBook only checks the book exists; the fake needs no locking.
+func (f *fakeRentals) LockBook(ctx context.Context, tx *sql.Tx, bookID int64) error {
+	if _, ok := f.prices[bookID]; !ok {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (f *fakeRentals) ShareLockBook(ctx context.Context, tx *sql.Tx, bookID int64) error {
+	return nil
+}
+
+func (f *fakeRentals) CountAvailable(ctx context.Context, tx *sql.Tx, bookID int64) (int64, error) {
+	var n int64
+	for _, book := range f.items {
+		if book == bookID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakeRentals) JoinWaitlist(ctx context.Context, tx *sql.Tx, bookID, userID int64) (int64, error) {
+	for _, e := range f.waitlist {
+		if e.bookID == bookID && e.userID == userID && e.status == "WAITING" {
+			return 0, &pgconn.PgError{Code: "23505"}
+		}
+	}
+	return f.wait(bookID, userID).id, nil
+}
+
+func (f *fakeRentals) LeaveWaitlist(ctx context.Context, bookID, userID int64) (bool, error) {
+	for _, e := range f.waitlist {
+		if e.bookID == bookID && e.userID == userID && e.status == "WAITING" {
+			e.status = "LEFT"
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MyWaitlist numbers each open entry among the WAITING ones for its book.
+func (f *fakeRentals) MyWaitlist(ctx context.Context, userID int64) ([]WaitlistRow, error) {
+	var out []WaitlistRow
+	for _, e := range f.waitlist {
+		if e.userID != userID || e.status != "WAITING" {
+			continue
+		}
+		pos := 0
+		for _, ahead := range f.waitlist {
+			if ahead.bookID == e.bookID && ahead.status == "WAITING" && ahead.id <= e.id {
+				pos++
+			}
+		}
+		out = append(out, WaitlistRow{EntryID: e.id, BookID: e.bookID, Position: pos})
+	}
+	return out, nil
+}
+
+func (f *fakeRentals) LockNextWaiting(ctx context.Context, tx *sql.Tx, bookID int64) (int64, int64, error) {
+	for _, e := range f.waitlist {
+		if e.bookID == bookID && e.status == "WAITING" {
+			return e.id, e.userID, nil
+		}
+	}
+	return 0, 0, sql.ErrNoRows
+}
+
+func (f *fakeRentals) FulfillWaiting(ctx context.Context, tx *sql.Tx, entryID, rentalID int64) error {
+	e := f.waitlist[entryID-1]
+	e.status, e.rentalID = "FULFILLED", rentalID
+	return nil
+}
+
+func (f *fakeRentals) GetBookPrice(ctx context.Context, tx *sql.Tx, bookID int64) (model.Money, error) {
+	p, ok := f.prices[bookID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return p, nil
+}
+
+func (f *fakeRentals) LockOneAvailableItem(ctx context.Context, tx *sql.Tx, bookID int64) (int64, error) {
+	for item, book := range f.items {
+		if book == bookID {
+			delete(f.items, item)
+			return item, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (f *fakeRentals) LockAvailableItemAt(ctx context.Context, tx *sql.Tx, bookID int64, branch string) (int64, error) {
+	for item, book := range f.items {
+		if book == bookID && f.branches[item] == branch {
+			delete(f.items, item)
+			return item, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (f *fakeRentals) ItemBranch(ctx context.Context, tx *sql.Tx, itemID int64) (string, error) {
+	b, ok := f.branches[itemID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return b, nil
+}
+
+// LockSlot counts Booked from the rentals holding the slot, as the repo does.
+func (f *fakeRentals) LockSlot(ctx context.Context, tx *sql.Tx, slotID int64) (*model.PickupSlot, error) {
+	slot, ok := f.slots[slotID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	cp := *slot
+	cp.Booked = 0
+	for _, r := range f.rentals {
+		if r.PickupSlotID != nil && *r.PickupSlotID == slotID && r.Status != model.RentalCanceled {
+			cp.Booked++
+		}
+	}
+	return &cp, nil
+}
+
+func (f *fakeRentals) SetPickupSlot(ctx context.Context, tx *sql.Tx, rentalID, slotID int64) error {
+	f.rentals[rentalID].PickupSlotID = &slotID
+	return nil
+}
+
+func (f *fakeRentals) ReserveItem(ctx context.Context, tx *sql.Tx, itemID int64, holdUntil *time.Time) error {
+	f.reserved = append(f.reserved, itemID)
+	return nil
+}
+
+func (f *fakeRentals) InsertRental(ctx context.Context, tx *sql.Tx, userID, bookID, itemID int64, price model.Money, dueAt time.Time) (int64, error) {
+	f.nextID++
+	f.add(model.Rental{
+		ID: f.nextID, UserID: userID, BookID: bookID, BookItemID: itemID,
+		Status: model.RentalBooked, RentalCost: price, PaymentDueAt: dueAt,
+	})
+	return f.nextID, nil
+}
+
+func (f *fakeRentals) SetLateFee(ctx context.Context, tx *sql.Tx, id int64, fee model.Money) error {
+	if f.lateFeeErr != nil {
+		return f.lateFeeErr
+	}
+	f.rentals[id].LateFee = fee
+	return nil
+}
+
+func (f *fakeRentals) GetLoanTerms(ctx context.Context, tx *sql.Tx, bookID int64) (int, model.Money, error) {
+	return 14, f.lateFeePerDay, nil
+}
+
+func (f *fakeRentals) LogAdminAction(ctx context.Context, tx *sql.Tx, rentalID, adminID int64, action, reason string, amount model.Money) error {
+	f.adminActions = append(f.adminActions, action)
+	return nil
+}
+
+func (f *fakeRentals) SetInvoice(ctx context.Context, tx *sql.Tx, id int64, invoiceID string) error {
+	f.rentals[id].XenditInvoiceID = &invoiceID
+	return nil
+}
+
+// ledgerLine is one posting made through fakeWallet.
+type ledgerLine struct {
+	userID   int64
+	rentalID int64
+	entry    model.LedgerType
+	amount   model.Money
+}
+
+// fakeWallet keeps balances and rental ledger lines in memory.
+type fakeWallet struct {
+	walletrepo.Repo
+
+	bal    map[int64]model.Money
+	ledger []ledgerLine
+}
+
+func newFakeWallet() *fakeWallet { return &fakeWallet{bal: map[int64]model.Money{}} }
+
+func (w *fakeWallet) GetUserBalanceForUpdate(ctx context.Context, tx *sql.Tx, userID int64) (model.Money, error) {
+	return w.bal[userID], nil
+}
+
+func (w *fakeWallet) UpdateUserBalance(ctx context.Context, tx *sql.Tx, userID int64, bal model.Money) error {
+	w.bal[userID] = bal
+	return nil
+}
+
+func (w *fakeWallet) InsertLedger(ctx context.Context, tx *sql.Tx, userID int64, refTable string, refID *int64, entry string, amount, bal model.Money) error {
+	if refTable != "rentals" || refID == nil {
+		return errors.New("fakeWallet: only rental postings are supported")
+	}
+	w.ledger = append(w.ledger, ledgerLine{userID, *refID, model.LedgerType(entry), amount})
+	return nil
+}
+
+func (w *fakeWallet) sum(rentalID int64, entries ...model.LedgerType) model.Money {
+	var total model.Money
+	for _, l := range w.ledger {
+		for _, e := range entries {
+			if l.rentalID == rentalID && l.entry == e {
+				total += l.amount
+			}
+		}
+	}
+	return total
+}
+
+func (w *fakeWallet) NetRentalCharge(ctx context.Context, tx *sql.Tx, rentalID int64) (model.Money, error) {
+	return -w.sum(rentalID, model.LedgerCharge, model.LedgerRefund), nil
+}
+
+func (w *fakeWallet) OutstandingRentalFees(ctx context.Context, tx *sql.Tx, rentalID int64) (model.Money, error) {
+	return -w.sum(rentalID, model.LedgerLate, model.LedgerReplace, model.LedgerWaiver), nil
+}
+
+func (w *fakeWallet) HasRentalEntry(ctx context.Context, tx *sql.Tx, rentalID int64, entry string) (bool, error) {
+	for _, l := range w.ledger {
+		if l.rentalID == rentalID && string(l.entry) == entry {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// fakeInvoices creates invoices, or fails with err. onCreate, when set,
+// runs first so a test can inspect state at the moment Xendit is called.
+type fakeInvoices struct {
+	xenditrepo.Repo
+
+	err      error
+	onCreate func(req xenditrepo.CreateInvoiceReq)
+	created  []xenditrepo.CreateInvoiceReq
+}
+
+func (x *fakeInvoices) CreateInvoice(req xenditrepo.CreateInvoiceReq) (*xenditrepo.CreateInvoiceResp, error) {
+	if x.onCreate != nil {
+		x.onCreate(req)
+	}
+	if x.err != nil {
+		return nil, x.err
+	}
+	x.created = append(x.created, req)
+	id := fmt.Sprintf("inv-%d", len(x.created))
+	return &xenditrepo.CreateInvoiceResp{InvoiceID: id, InvoiceURL: "http://pay/" + id}, nil
+}
+
+// nopNotifier drops notifications.
+type nopNotifier struct{}
+
+func (nopNotifier) Notify(ctx context.Context, userID int64, subject, body string) error { return nil }
+
+// sentNote is a delivered notification and how many commits preceded it.
+type sentNote struct {
+	userID  int64
+	subject string
+	commits int
+}
+
+// recordingNotifier keeps every notification sent through it.
+type recordingNotifier struct {
+	db   *sqlstub.DB
+	sent []sentNote
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, userID int64, subject, body string) error {
+	n.sent = append(n.sent, sentNote{userID, subject, n.db.Commits()})
+	return nil
+}
+
+func newTestService(rr *fakeRentals, wr *fakeWallet, cfg Config) (*service, *sqlstub.DB) {
+	db := sqlstub.New()
+	return &service{db: db.DB, rr: rr, wr: wr, notifier: nopNotifier{}, cfg: cfg}, db
+}
@@ -0,0 +1,230 @@
+package rental
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"bookrental/model"
+	xenditrepo "bookrental/repository/xendit"
+
+	"github.com/labstack/echo/v4"
+)
+
+// InvoiceBooking is a BOOKED rental waiting on its Xendit invoice.
+type InvoiceBooking struct {
+	RentalID    int64  `json:"rental_id"`
+	InvoiceID   string `json:"invoice_id"`
+	PaymentLink string `json:"payment_link"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+// BookWithInvoice holds a copy like BookWithDeposit but leaves the rental
+// BOOKED and asks Xendit for an invoice instead of touching the deposit.
+// The invoice lives as long as the hold; the webhook moves the rental to
+// PAID, or cancels it when the invoice expires.
+//
+// The hold is committed before Xendit is called, so no row locks are held
+// while waiting on the provider and no invoice exists for a rental that
+// was never stored. If the invoice cannot be created the hold is canceled.
+func (s *service) BookWithInvoice(ctx context.Context, userID, bookID int64, payerEmail string, holdMinutes int, slotID int64) (*InvoiceBooking, error) {
+	r, err := s.holdForInvoice(ctx, userID, bookID, holdMinutes, slotID)
+	if err != nil {
+		return nil, err
+	}
+
+	iv, err := s.xr.CreateInvoice(xenditrepo.CreateInvoiceReq{
+		ExternalID:  fmt.Sprintf("%s%d", model.RentalInvoicePrefix, r.ID),
+		Amount:      r.RentalCost,
+		Description: fmt.Sprintf("Book rental #%d", r.ID),
+		PayerEmail:  payerEmail,
+		ExpirySec:   int(time.Until(r.PaymentDueAt).Seconds()),
+	})
+	if err != nil {
+		if cerr := s.abandonHold(ctx, r.ID); cerr != nil {
+			return nil, fmt.Errorf("create invoice: %v; cancel rental %d: %w", err, r.ID, cerr)
+		}
+		return nil, echo.NewHTTPError(502, echo.Map{"message": fmt.Sprintf("create invoice: %v", err)})
+	}
+	if err = s.attachInvoice(ctx, r.ID, iv.InvoiceID); err != nil {
+		return nil, fmt.Errorf("set invoice %s on rental %d: %w", iv.InvoiceID, r.ID, err)
+	}
+
+	return &InvoiceBooking{
+		RentalID:    r.ID,
+		InvoiceID:   iv.InvoiceID,
+		PaymentLink: iv.InvoiceURL,
+		ExpiresAt:   iv.ExpiresAt,
+	}, nil
+}
+
+// holdForInvoice reserves a copy and stores the BOOKED rental in its own tx.
+func (s *service) holdForInvoice(ctx context.Context, userID, bookID int64, holdMinutes int, slotID int64) (r *model.Rental, err error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	if _, err = s.rr.LockUserForUpdate(ctx, tx, userID); err != nil {
+		return nil, echo.NewHTTPError(404, echo.Map{"message": "user not found"})
+	}
+	if err = s.checkEligibility(ctx, tx, userID, []int64{bookID}); err != nil {
+		return nil, err
+	}
+
+	price, err := s.rr.GetBookPrice(ctx, tx, bookID)
+	if err != nil {
+		return nil, echo.NewHTTPError(404, echo.Map{"message": "book not found"})
+	}
+	itemID, dueAt, err := s.holdCopy(ctx, tx, bookID, holdMinutes, slotID)
+	if err != nil {
+		return nil, err
+	}
+	rentalID, err := s.rr.InsertRental(ctx, tx, userID, bookID, itemID, price, dueAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert rental: %w", err)
+	}
+	if slotID > 0 {
+		if err = s.rr.SetPickupSlot(ctx, tx, rentalID, slotID); err != nil {
+			return nil, fmt.Errorf("set slot: %w", err)
+		}
+	}
+	return &model.Rental{ID: rentalID, UserID: userID, BookID: bookID, BookItemID: itemID,
+		Status: model.RentalBooked, RentalCost: price, PaymentDueAt: dueAt}, nil
+}
+
+// attachInvoice records the invoice id on a rental held by holdForInvoice.
+func (s *service) attachInvoice(ctx context.Context, rentalID int64, invoiceID string) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	return s.rr.SetInvoice(ctx, tx, rentalID, invoiceID)
+}
+
+// abandonHold cancels a rental that is still BOOKED and frees its copy, as
+// the sweeper would once its hold ran out.
+func (s *service) abandonHold(ctx context.Context, rentalID int64) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var handoff *notice
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else if err = tx.Commit(); err == nil {
+			s.send(ctx, []*notice{handoff})
+		}
+	}()
+
+	r, err := s.rr.GetForUpdate(ctx, tx, rentalID)
+	if err != nil {
+		return err
+	}
+	if r.Status != model.RentalBooked {
+		return nil
+	}
+	handoff, err = s.expireHold(ctx, tx, r)
+	return err
+}
+
+// MarkInvoicePaid settles a rental whose invoice was paid. The money passes
+// through the wallet (TOPUP_CONFIRMED in, RENTAL_CHARGE out) so refunds work
+// the same as for deposit-paid rentals. In any other state (the hold lapsed,
+// or the rental was settled some other way) the payment is kept as deposit
+// credit instead, once. Replays are no-ops.
+func (s *service) MarkInvoicePaid(ctx context.Context, rentalID int64, invoiceID string) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	r, err := s.invoiceRental(ctx, tx, rentalID, invoiceID)
+	if err != nil {
+		return err
+	}
+
+	switch r.Status {
+	case model.RentalBooked:
+		if _, err = s.postToWallet(ctx, tx, r, model.LedgerTopup, r.RentalCost); err != nil {
+			return err
+		}
+		if err = s.transition(ctx, tx, r, model.RentalPaid); err != nil {
+			return err
+		}
+		_, err = s.postToWallet(ctx, tx, r, model.LedgerCharge, -r.RentalCost)
+		return err
+	default:
+		credited, err := s.wr.HasRentalEntry(ctx, tx, r.ID, string(model.LedgerTopup))
+		if err != nil {
+			return fmt.Errorf("check credit: %w", err)
+		}
+		if credited {
+			return nil
+		}
+		_, err = s.postToWallet(ctx, tx, r, model.LedgerTopup, r.RentalCost)
+		return err
+	}
+}
+
+// ExpireInvoice cancels a rental whose invoice expired unpaid and releases
+// its copy. Rentals that are no longer BOOKED are left alone.
+func (s *service) ExpireInvoice(ctx context.Context, rentalID int64, invoiceID string) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	var handoff *notice
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else if err = tx.Commit(); err == nil {
+			s.send(ctx, []*notice{handoff})
+		}
+	}()
+
+	r, err := s.invoiceRental(ctx, tx, rentalID, invoiceID)
+	if err != nil {
+		return err
+	}
+	if r.Status != model.RentalBooked {
+		return nil
+	}
+	handoff, err = s.expireHold(ctx, tx, r)
+	return err
+}
+
+// invoiceRental locks rentalID and checks it really belongs to invoiceID.
+func (s *service) invoiceRental(ctx context.Context, tx *sql.Tx, rentalID int64, invoiceID string) (*model.Rental, error) {
+	r, err := s.rr.GetForUpdate(ctx, tx, rentalID)
+	if err != nil {
+		return nil, fmt.Errorf("load rental %d: %w", rentalID, err)
+	}
+	if r.XenditInvoiceID == nil || *r.XenditInvoiceID != invoiceID {
+		return nil, fmt.Errorf("invoice %s does not belong to rental %d", invoiceID, rentalID)
+	}
+	return r, nil
+}
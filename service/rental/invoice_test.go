@@ -0,0 +1,161 @@
+package rental
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"bookrental/model"
+	xenditrepo "bookrental/repository/xendit"
+)
+
+// invoiceRentalFixture is rental 1 of user 7, a 40.00 invoice rental in the
+// given state.
+func invoiceRentalFixture(status model.RentalStatus) (*fakeRentals, *fakeWallet) {
+	rr, wr := newFakeRentals(), newFakeWallet()
+	inv := "inv-1"
+	rr.add(model.Rental{ID: 1, UserID: 7, BookID: 1, BookItemID: 11, Status: status,
+		RentalCost: model.Units(40), PaymentDueAt: time.Now().Add(time.Hour), XenditInvoiceID: &inv})
+	rr.deposits[7] = model.Units(100)
+	return rr, wr
+}
+
+func TestMarkInvoicePaidBooked(t *testing.T) {
+	rr, wr := invoiceRentalFixture(model.RentalBooked)
+	s, _ := newTestService(rr, wr, Config{})
+
+	if err := s.MarkInvoicePaid(context.Background(), 1, "inv-1"); err != nil {
+		t.Fatalf("MarkInvoicePaid: %v", err)
+	}
+	if rr.rentals[1].Status != model.RentalPaid {
+		t.Errorf("status = %s; want PAID", rr.rentals[1].Status)
+	}
+	// In through the wallet and straight out again as the rental charge.
+	if wr.sum(1, model.LedgerTopup) != model.Units(40) || wr.sum(1, model.LedgerCharge) != -model.Units(40) || wr.bal[7] != 0 {
+		t.Errorf("ledger %v, balance %v; want +40 top-up, -40 charge, balance 0", wr.ledger, wr.bal[7])
+	}
+}
+
+func TestMarkInvoicePaidCreditsWhenNotBooked(t *testing.T) {
+	for _, status := range []model.RentalStatus{model.RentalCanceled, model.RentalPaid, model.RentalActive} {
+		rr, wr := invoiceRentalFixture(status)
+		s, _ := newTestService(rr, wr, Config{})
+
+		if err := s.MarkInvoicePaid(context.Background(), 1, "inv-1"); err != nil {
+			t.Fatalf("%s: MarkInvoicePaid: %v", status, err)
+		}
+		if rr.rentals[1].Status != status {
+			t.Errorf("%s: status moved to %s", status, rr.rentals[1].Status)
+		}
+		if wr.bal[7] != model.Units(40) || len(wr.ledger) != 1 || wr.ledger[0].entry != model.LedgerTopup {
+			t.Errorf("%s: ledger %v, balance %v; want the payment kept as 40.00 credit", status, wr.ledger, wr.bal[7])
+		}
+	}
+}
+
+func TestMarkInvoicePaidRepeatedCallback(t *testing.T) {
+	for _, status := range []model.RentalStatus{model.RentalBooked, model.RentalCanceled} {
+		rr, wr := invoiceRentalFixture(status)
+		s, _ := newTestService(rr, wr, Config{})
+
+		for i := 0; i < 3; i++ {
+			if err := s.MarkInvoicePaid(context.Background(), 1, "inv-1"); err != nil {
+				t.Fatalf("%s: callback %d: %v", status, i+1, err)
+			}
+		}
+		if got := wr.sum(1, model.LedgerTopup); got != model.Units(40) {
+			t.Errorf("%s: credited %v over three callbacks; want 40.00 once", status, got)
+		}
+	}
+}
+
+func TestMarkInvoicePaidWrongInvoice(t *testing.T) {
+	rr, wr := invoiceRentalFixture(model.RentalBooked)
+	s, _ := newTestService(rr, wr, Config{})
+	if err := s.MarkInvoicePaid(context.Background(), 1, "inv-other"); err == nil {
+		t.Error("want error for an invoice that is not the rental's")
+	}
+	if len(wr.ledger) != 0 {
+		t.Errorf("ledger = %v; want nothing posted", wr.ledger)
+	}
+}
+
+func TestPayRefusesInvoiceRental(t *testing.T) {
+	rr, wr := invoiceRentalFixture(model.RentalBooked)
+	s, _ := newTestService(rr, wr, Config{})
+
+	if err := s.Pay(context.Background(), 7, 1); httpCode(err) != 409 {
+		t.Fatalf("err = %v; want 409", err)
+	}
+	if rr.rentals[1].Status != model.RentalBooked || rr.deposits[7] != model.Units(100) {
+		t.Error("invoice rental was paid from the deposit")
+	}
+}
+
+func TestBookWithInvoiceCommitsHoldFirst(t *testing.T) {
+	rr, wr := checkoutFixture()
+	s, db := newTestService(rr, wr, Config{})
+	x := &fakeInvoices{}
+	x.onCreate = func(req xenditrepo.CreateInvoiceReq) {
+		if db.Commits() != 1 {
+			t.Errorf("invoice requested with %d commits; want the hold committed first", db.Commits())
+		}
+	}
+	s.xr = x
+
+	res, err := s.BookWithInvoice(context.Background(), 7, 1, "a@b.c", 30, 0)
+	if err != nil {
+		t.Fatalf("BookWithInvoice: %v", err)
+	}
+	r := rr.rentals[res.RentalID]
+	if r.Status != model.RentalBooked || r.XenditInvoiceID == nil || *r.XenditInvoiceID != res.InvoiceID {
+		t.Errorf("rental %+v; want BOOKED with invoice %s", r, res.InvoiceID)
+	}
+	if got := x.created[0].ExternalID; got != fmt.Sprintf("rental:%d", res.RentalID) {
+		t.Errorf("external_id = %q", got)
+	}
+	if rr.deposits[7] != model.Units(100) || len(wr.ledger) != 0 {
+		t.Error("invoice booking touched the deposit")
+	}
+}
+
+func TestBookWithInvoiceCancelsHoldWhenInvoiceFails(t *testing.T) {
+	rr, wr := checkoutFixture()
+	s, _ := newTestService(rr, wr, Config{})
+	s.xr = &fakeInvoices{err: errors.New("timeout")}
+
+	_, err := s.BookWithInvoice(context.Background(), 7, 1, "a@b.c", 30, 0)
+	if httpCode(err) != 502 {
+		t.Fatalf("err = %v; want 502", err)
+	}
+	if len(rr.rentals) != 1 {
+		t.Fatalf("%d rentals; want the one hold", len(rr.rentals))
+	}
+	for _, r := range rr.rentals {
+		if r.Status != model.RentalCanceled {
+			t.Errorf("rental is %s; want CANCELED", r.Status)
+		}
+	}
+	if len(rr.freed) != 1 || rr.freed[0] != 11 {
+		t.Errorf("freed copies %v; want [11]", rr.freed)
+	}
+}
+
+func TestExpireInvoice(t *testing.T) {
+	rr, wr := invoiceRentalFixture(model.RentalBooked)
+	s, _ := newTestService(rr, wr, Config{})
+
+	if err := s.ExpireInvoice(context.Background(), 1, "inv-1"); err != nil {
+		t.Fatalf("ExpireInvoice: %v", err)
+	}
+	if rr.rentals[1].Status != model.RentalCanceled || len(rr.freed) != 1 {
+		t.Errorf("status %s, freed %v; want CANCELED and the copy freed", rr.rentals[1].Status, rr.freed)
+	}
+	// Once paid, a late EXPIRED callback leaves the rental alone.
+	rr.rentals[1].Status = model.RentalPaid
+	if err := s.ExpireInvoice(context.Background(), 1, "inv-1"); err != nil || rr.rentals[1].Status != model.RentalPaid {
+		t.Errorf("expire after payment: err %v, status %s", err, rr.rentals[1].Status)
+	}
+}
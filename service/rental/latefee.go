@@ -0,0 +1,25 @@
+package rental
+
+import (
+	"math"
+	"time"
+
+	"bookrental/model"
+)
+
+// ReturnReceipt tells the renter what the return cost them on top of the rental.
+type ReturnReceipt struct {
+	OverdueDays int         `json:"overdue_days"`
+	LateFee     model.Money `json:"late_fee"`
+}
+
+// lateFee charges perDay for every started day between dueAt and returnedAt.
+// Returning on or before dueAt is free.
+func lateFee(dueAt, returnedAt time.Time, perDay model.Money) (days int, fee model.Money) {
+	late := returnedAt.Sub(dueAt)
+	if late <= 0 {
+		return 0, 0
+	}
+	days = int(math.Ceil(late.Hours() / 24))
+	return days, perDay.MulInt(days)
+}
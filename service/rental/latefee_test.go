@@ -0,0 +1,31 @@
+package rental
+
+import (
+	"testing"
+	"time"
+
+	"bookrental/model"
+)
+
+func TestLateFee(t *testing.T) {
+	due := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		returned time.Time
+		days     int
+		fee      model.Money
+	}{
+		{"early", due.Add(-48 * time.Hour), 0, 0},
+		{"on time", due, 0, 0},
+		{"one minute late", due.Add(time.Minute), 1, model.Units(2500)},
+		{"exactly one day", due.Add(24 * time.Hour), 1, model.Units(2500)},
+		{"one day and a bit", due.Add(25 * time.Hour), 2, model.Units(5000)},
+		{"a week", due.Add(7 * 24 * time.Hour), 7, model.Units(17500)},
+	}
+	for _, c := range cases {
+		days, fee := lateFee(due, c.returned, model.Units(2500))
+		if days != c.days || fee != c.fee {
+			t.Errorf("%s: got %d days / %v; want %d / %v", c.name, days, fee, c.days, c.fee)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package rental
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bookrental/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RescheduleReceipt is the pickup window a rental was moved to.
+type RescheduleReceipt struct {
+	SlotID     int64     `json:"slot_id"`
+	Branch     string    `json:"branch"`
+	HoldUntil  time.Time `json:"hold_until"`
+	PreviousID *int64    `json:"previous_slot_id,omitempty"`
+}
+
+// holdCopy picks and reserves a copy of bookID. With a slot the copy comes
+// from the slot's branch and is held until the slot ends; otherwise any copy
+// is held for holdMinutes.
+func (s *service) holdCopy(ctx context.Context, tx *sql.Tx, bookID int64, holdMinutes int, slotID int64) (itemID int64, until time.Time, err error) {
+	if slotID > 0 {
+		var slot *model.PickupSlot
+		if slot, err = s.claimSlot(ctx, tx, slotID); err != nil {
+			return 0, time.Time{}, err
+		}
+		itemID, err = s.rr.LockAvailableItemAt(ctx, tx, bookID, slot.Branch)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, time.Time{}, echo.NewHTTPError(409, echo.Map{
+				"message": "no available copy at " + slot.Branch,
+				"hint":    "see GET /v1/books/:id/pickup-slots for branches that have one",
+			})
+		}
+		until = slot.EndsAt
+	} else {
+		itemID, err = s.rr.LockOneAvailableItem(ctx, tx, bookID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, time.Time{}, echo.NewHTTPError(409, echo.Map{
+				"message": "no available copy",
+				"hint":    "join the waitlist with POST /v1/rentals/waitlist",
+			})
+		}
+		if holdMinutes <= 0 {
+			holdMinutes = defaultHoldMinutes
+		}
+		until = time.Now().Add(time.Duration(holdMinutes) * time.Minute)
+	}
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("lock item: %w", err)
+	}
+	if err = s.rr.ReserveItem(ctx, tx, itemID, &until); err != nil {
+		return 0, time.Time{}, fmt.Errorf("reserve item: %w", err)
+	}
+	return itemID, until, nil
+}
+
+// claimSlot locks a slot and checks it can take one more pickup.
+func (s *service) claimSlot(ctx context.Context, tx *sql.Tx, slotID int64) (*model.PickupSlot, error) {
+	slot, err := s.rr.LockSlot(ctx, tx, slotID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, echo.NewHTTPError(404, echo.Map{"message": "pickup slot not found"})
+		}
+		return nil, fmt.Errorf("lock slot: %w", err)
+	}
+	if !slot.EndsAt.After(time.Now()) {
+		return nil, echo.NewHTTPError(409, echo.Map{"message": "pickup slot has ended"})
+	}
+	if slot.Booked >= slot.Capacity {
+		return nil, echo.NewHTTPError(409, echo.Map{"message": "pickup slot is full"})
+	}
+	return slot, nil
+}
+
+// FreeSlots lists upcoming pickup slots that still have room and sit at a
+// branch with a copy of bookID on the shelf.
+func (s *service) FreeSlots(ctx context.Context, bookID int64) ([]model.PickupSlot, error) {
+	rows, err := s.rr.FreeSlots(ctx, bookID)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("list slots: %v", err)})
+	}
+	return rows, nil
+}
+
+// Reschedule moves a paid, not-yet-collected rental to another pickup slot at
+// the same branch and stretches the copy's hold to the new slot's end. A
+// BOOKED rental must be paid first: its payment window (and any invoice) is
+// tied to the original hold, and moving the slot must not stretch it.
+// Business rules:
+// - Only owner can reschedule (403)
+// - Rental must be PAID (409); BOOKED ones are asked to pay first
+// - Slot must exist (404), not be over or full (409) and be at the copy's branch (409)
+func (s *service) Reschedule(ctx context.Context, userID, rentalID, slotID int64) (rc *RescheduleReceipt, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	r, err := s.loadForUpdate(ctx, tx, rentalID)
+	if err != nil {
+		return nil, err
+	}
+	if r.UserID != userID {
+		return nil, echo.NewHTTPError(403, echo.Map{"message": "not the owner of this rental"})
+	}
+	switch r.Status {
+	case model.RentalPaid:
+	case model.RentalBooked:
+		return nil, echo.NewHTTPError(409, echo.Map{"message": "pay for the rental before moving its pickup"})
+	default:
+		return nil, echo.NewHTTPError(409, echo.Map{"message": fmt.Sprintf("rental is %s, nothing to pick up", r.Status)})
+	}
+	if r.PickupSlotID != nil && *r.PickupSlotID == slotID {
+		return nil, echo.NewHTTPError(409, echo.Map{"message": "rental is already in this slot"})
+	}
+
+	slot, err := s.claimSlot(ctx, tx, slotID)
+	if err != nil {
+		return nil, err
+	}
+	branch, err := s.rr.ItemBranch(ctx, tx, r.BookItemID)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("item branch: %v", err)})
+	}
+	if branch != slot.Branch {
+		return nil, echo.NewHTTPError(409, echo.Map{
+			"message": "your copy is held at " + branch,
+			"hint":    "pick a slot at the same branch, or cancel and book again",
+		})
+	}
+
+	if err = s.rr.SetPickupSlot(ctx, tx, r.ID, slot.ID); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("set slot: %v", err)})
+	}
+	if err = s.rr.ReserveItem(ctx, tx, r.BookItemID, &slot.EndsAt); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("reserve item: %v", err)})
+	}
+	return &RescheduleReceipt{
+		SlotID:     slot.ID,
+		Branch:     slot.Branch,
+		HoldUntil:  slot.EndsAt,
+		PreviousID: r.PickupSlotID,
+	}, nil
+}
+
+// CreateSlot opens a pickup window at a branch.
+func (s *service) CreateSlot(ctx context.Context, branch string, startsAt, endsAt time.Time, capacity int) (int64, error) {
+	branch = strings.TrimSpace(branch)
+	if branch == "" || capacity <= 0 || !endsAt.After(startsAt) {
+		return 0, echo.NewHTTPError(400, echo.Map{"message": "invalid slot"})
+	}
+	if !endsAt.After(time.Now()) {
+		return 0, echo.NewHTTPError(400, echo.Map{"message": "slot is already over"})
+	}
+	id, err := s.rr.CreateSlot(ctx, branch, startsAt, endsAt, capacity)
+	if err != nil {
+		return 0, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("create slot: %v", err)})
+	}
+	return id, nil
+}
@@ -0,0 +1,148 @@
+package rental
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"bookrental/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// pickupFixture has a PAID rental 1 of user 7 whose copy 11 is held at
+// "north" for slot 1. Slot 2 is another free north slot, slot 3 is at
+// "south" and slot 4 at north has room for one pickup, already taken.
+func pickupFixture() *fakeRentals {
+	rr := newFakeRentals()
+	later := time.Now().Add(2 * time.Hour)
+	rr.slots[1] = &model.PickupSlot{ID: 1, Branch: "north", EndsAt: later, Capacity: 5}
+	rr.slots[2] = &model.PickupSlot{ID: 2, Branch: "north", EndsAt: later.Add(time.Hour), Capacity: 5}
+	rr.slots[3] = &model.PickupSlot{ID: 3, Branch: "south", EndsAt: later, Capacity: 5}
+	rr.slots[4] = &model.PickupSlot{ID: 4, Branch: "north", EndsAt: later, Capacity: 1}
+	rr.branches[11] = "north"
+	one, four := int64(1), int64(4)
+	rr.add(model.Rental{ID: 1, UserID: 7, BookID: 1, BookItemID: 11, Status: model.RentalPaid, PickupSlotID: &one})
+	rr.add(model.Rental{ID: 2, UserID: 8, BookID: 1, BookItemID: 12, Status: model.RentalPaid, PickupSlotID: &four})
+	return rr
+}
+
+func TestRescheduleMovesPaidRental(t *testing.T) {
+	rr := pickupFixture()
+	s, _ := newTestService(rr, newFakeWallet(), Config{})
+
+	rc, err := s.Reschedule(context.Background(), 7, 1, 2)
+	if err != nil {
+		t.Fatalf("Reschedule: %v", err)
+	}
+	if rc.SlotID != 2 || rc.PreviousID == nil || *rc.PreviousID != 1 || !rc.HoldUntil.Equal(rr.slots[2].EndsAt) {
+		t.Errorf("receipt = %+v; want slot 1 → 2 held until its end", rc)
+	}
+	if got := rr.rentals[1].PickupSlotID; got == nil || *got != 2 {
+		t.Errorf("rental slot = %v; want 2", got)
+	}
+}
+
+func TestRescheduleRefusals(t *testing.T) {
+	cases := []struct {
+		name   string
+		status model.RentalStatus
+		slotID int64
+		code   int
+		msg    string
+	}{
+		{"booked rental", model.RentalBooked, 2, 409, "pay for the rental"},
+		{"full slot", model.RentalPaid, 4, 409, "pickup slot is full"},
+		{"other branch", model.RentalPaid, 3, 409, "held at north"},
+		{"unknown slot", model.RentalPaid, 9, 404, "not found"},
+		{"same slot", model.RentalPaid, 1, 409, "already in this slot"},
+	}
+	for _, c := range cases {
+		rr := pickupFixture()
+		rr.rentals[1].Status = c.status
+		s, db := newTestService(rr, newFakeWallet(), Config{})
+
+		_, err := s.Reschedule(context.Background(), 7, 1, c.slotID)
+		if httpCode(err) != c.code {
+			t.Errorf("%s: err = %v; want %d", c.name, err, c.code)
+			continue
+		}
+		if msg := err.(*echo.HTTPError).Message.(echo.Map)["message"].(string); !strings.Contains(msg, c.msg) {
+			t.Errorf("%s: message %q; want it to mention %q", c.name, msg, c.msg)
+		}
+		if *rr.rentals[1].PickupSlotID != 1 || db.Rollbacks() != 1 {
+			t.Errorf("%s: rental moved to slot %d; want it left in slot 1", c.name, *rr.rentals[1].PickupSlotID)
+		}
+	}
+}
+
+func TestCheckoutIntoSlot(t *testing.T) {
+	rr, wr := checkoutFixture()
+	rr.slots[1] = &model.PickupSlot{ID: 1, Branch: "north", EndsAt: time.Now().Add(time.Hour), Capacity: 2}
+	rr.branches[11], rr.branches[21], rr.branches[22] = "north", "south", "north"
+	s, _ := newTestService(rr, wr, Config{})
+
+	res, err := s.Checkout(context.Background(), 7, []int64{1, 2}, 0, 1)
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	for _, it := range res.Items {
+		r := rr.rentals[it.RentalID]
+		if r.PickupSlotID == nil || *r.PickupSlotID != 1 || rr.branches[r.BookItemID] != "north" {
+			t.Errorf("rental %d: slot %v, copy at %s; want slot 1 at north", r.ID, r.PickupSlotID, rr.branches[r.BookItemID])
+		}
+		if !r.PaymentDueAt.Equal(rr.slots[1].EndsAt) {
+			t.Errorf("rental %d held until %v; want the slot's end", r.ID, r.PaymentDueAt)
+		}
+	}
+}
+
+func TestCheckoutIntoSlotNeedsRoomAndCopies(t *testing.T) {
+	rr, wr := checkoutFixture()
+	rr.slots[1] = &model.PickupSlot{ID: 1, Branch: "north", EndsAt: time.Now().Add(time.Hour), Capacity: 1}
+	rr.branches[11], rr.branches[21], rr.branches[22] = "north", "south", "south"
+	s, _ := newTestService(rr, wr, Config{})
+
+	_, err := s.Checkout(context.Background(), 7, []int64{1, 2}, 0, 1)
+	if httpCode(err) != 409 || err.(*echo.HTTPError).Message.(echo.Map)["message"] != "pickup slot is full" {
+		t.Fatalf("err = %v; want 409 pickup slot is full", err)
+	}
+
+	rr.slots[1].Capacity = 2
+	_, err = s.Checkout(context.Background(), 7, []int64{1, 2}, 0, 1)
+	if httpCode(err) != 409 {
+		t.Fatalf("err = %v; want 409", err)
+	}
+	failures := err.(*echo.HTTPError).Message.(echo.Map)["failures"].([]CheckoutFailure)
+	if len(failures) != 1 || failures[0] != (CheckoutFailure{2, "no available copy at north"}) {
+		t.Errorf("failures = %v; want book 2 with no copy at north", failures)
+	}
+	if len(rr.rentals) != 0 {
+		t.Errorf("%d rentals; want none", len(rr.rentals))
+	}
+}
+
+func TestExpireHoldsCancelsMissedPickups(t *testing.T) {
+	rr, wr := pickupFixture(), newFakeWallet()
+	rr.slots[1].EndsAt = time.Now().Add(-time.Minute)
+	wr.ledger = append(wr.ledger, ledgerLine{7, 1, model.LedgerCharge, -model.Units(40)})
+	s, _ := newTestService(rr, wr, Config{CancelRefund: RefundPartial, CancelRefundPercent: 50})
+
+	n, err := s.ExpireHolds(context.Background())
+	if err != nil {
+		t.Fatalf("ExpireHolds: %v", err)
+	}
+	if n != 1 || rr.rentals[1].Status != model.RentalCanceled {
+		t.Fatalf("n = %d, rental 1 is %s; want the missed pickup canceled", n, rr.rentals[1].Status)
+	}
+	if rr.rentals[2].Status != model.RentalPaid {
+		t.Errorf("rental 2 is %s; its slot is still open, want PAID", rr.rentals[2].Status)
+	}
+	if wr.bal[7] != model.Units(20) {
+		t.Errorf("refund = %v; want 20.00 under the 50%% policy", wr.bal[7])
+	}
+	if len(rr.freed) != 1 || rr.freed[0] != 11 {
+		t.Errorf("freed copies %v; want [11]", rr.freed)
+	}
+}
@@ -1,166 +1,359 @@
 package rental
 
 import (
+	"bookrental/model"
 	rentalrepo "bookrental/repository/rental"
 	walletrepo "bookrental/repository/wallet"
+	xenditrepo "bookrental/repository/xendit"
+	"bookrental/service/notify"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
+// defaultHoldMinutes is how long a copy stays BOOKED waiting for payment
+// when the client does not ask for a specific hold.
+const defaultHoldMinutes = 30
+
 type Service interface {
-	// Borrow using user deposit (deducts deposit, reserves an item, inserts rental).
-	BookWithDeposit(ctx context.Context, userID, bookID int64, holdMinutes int) error
-	// Return an ACTIVE rental, free the copy.
-	Return(ctx context.Context, userID, rentalID int64) error
+	// Borrow using user deposit: holds a copy (BOOKED) and pays for it from the deposit (PAID).
+	// Every booking path runs Config.Rules first and fails with 422 listing the broken rules.
+	// slotID > 0 holds the copy at the slot's branch until the slot ends instead of holdMinutes.
+	BookWithDeposit(ctx context.Context, userID, bookID int64, holdMinutes int, slotID int64) (int64, error)
+	// Hold a copy (BOOKED) and return a Xendit invoice to pay for it.
+	BookWithInvoice(ctx context.Context, userID, bookID int64, payerEmail string, holdMinutes int, slotID int64) (*InvoiceBooking, error)
+	// Invoice callbacks routed from the payment webhook.
+	MarkInvoicePaid(ctx context.Context, rentalID int64, invoiceID string) error
+	ExpireInvoice(ctx context.Context, rentalID int64, invoiceID string) error
+	// Book several titles at once: all rentals are created and paid together or none are.
+	// slotID > 0 puts every rental in that pickup slot, as for BookWithDeposit.
+	Checkout(ctx context.Context, userID int64, bookIDs []int64, holdMinutes int, slotID int64) (*CheckoutResult, error)
+	// Pay a BOOKED rental from the user's deposit.
+	Pay(ctx context.Context, userID, rentalID int64) error
+	// Staff hands the copy over: PAID → ACTIVE.
+	Pickup(ctx context.Context, rentalID int64) error
+	// Cancel a BOOKED or PAID rental and refund it per the configured policy.
+	Cancel(ctx context.Context, userID, rentalID int64) (*CancelReceipt, error)
+	// Return an ACTIVE rental, free the copy and charge any late fee.
+	Return(ctx context.Context, userID, rentalID int64) (*ReturnReceipt, error)
+	// Staff reports an ACTIVE rental's copy LOST or DAMAGED and charges the renter.
+	ReportCondition(ctx context.Context, rentalID int64, condition model.BookItemStatus, charge *model.Money) (*ConditionReceipt, error)
 	// List my rental history.
 	MyHistory(ctx context.Context, userID int64) ([]HistoryRow, error)
+	// One rental with its ledger lines and timeline; owner or admin only.
+	Detail(ctx context.Context, userID, rentalID int64, admin bool) (*RentalDetail, error)
+	// Push the due date of an ACTIVE rental out by days, paying pro-rata from the deposit.
+	Extend(ctx context.Context, userID, rentalID int64, days int) (*ExtendReceipt, error)
+	// Cancel BOOKED rentals whose payment window lapsed and PAID ones whose
+	// pickup slot ended uncollected; returns how many were expired.
+	ExpireHolds(ctx context.Context) (int, error)
+
+	// Pickup slots: free ones for a book, moving a pickup, and opening new ones (admin).
+	FreeSlots(ctx context.Context, bookID int64) ([]model.PickupSlot, error)
+	Reschedule(ctx context.Context, userID, rentalID, slotID int64) (*RescheduleReceipt, error)
+	CreateSlot(ctx context.Context, branch string, startsAt, endsAt time.Time, capacity int) (int64, error)
+
+	// Queue for a book with no free copy; returns my place in line.
+	JoinWaitlist(ctx context.Context, userID, bookID int64) (*WaitlistRow, error)
+	LeaveWaitlist(ctx context.Context, userID, bookID int64) error
+	MyWaitlist(ctx context.Context, userID int64) ([]WaitlistRow, error)
+	// Hand free copies of a book to its queue, e.g. after new copies were added.
+	OfferCopies(ctx context.Context, bookID int64) (int, error)
+
+	// Admin console: any user's rentals, and overrides logged with the admin's ID.
+	AdminList(ctx context.Context, f RentalFilter) ([]model.Rental, error)
+	ForceReturn(ctx context.Context, adminID, rentalID int64, reason string) (*ReturnReceipt, error)
+	ForceCancel(ctx context.Context, adminID, rentalID int64, reason string) (*CancelReceipt, error)
+	WaiveFees(ctx context.Context, adminID, rentalID int64, reason string) (*WaiveReceipt, error)
+}
+
+// Config holds the rental policy knobs that come from the environment.
+type Config struct {
+	MaxRenewals   int           // renewals allowed per rental
+	MaxExtendDays int           // longest single extension
+	WaitlistHold  time.Duration // how long a copy handed to the next in line waits for payment
+
+	CancelRefund        RefundPolicy // refund on user cancellation before pickup
+	CancelRefundPercent int          // share refunded under RefundPartial
+
+	Rules []Rule // eligibility checks run before any booking; all must pass
 }
 
 type HistoryRow = rentalrepo.HistoryRow
 
 type service struct {
-	db *sql.DB
-	rr rentalrepo.Repo
-	wr walletrepo.Repo
+	db       *sql.DB
+	rr       rentalrepo.Repo
+	wr       walletrepo.Repo
+	xr       xenditrepo.Repo
+	notifier notify.Notifier
+	cfg      Config
 }
 
-func New(db *sql.DB, rr rentalrepo.Repo, wr walletrepo.Repo) Service {
-	return &service{db: db, rr: rr, wr: wr}
+func New(db *sql.DB, rr rentalrepo.Repo, wr walletrepo.Repo, xr xenditrepo.Repo, n notify.Notifier, cfg Config) Service {
+	return &service{db: db, rr: rr, wr: wr, xr: xr, notifier: n, cfg: cfg}
 }
 
 // BookWithDeposit:
 // 1) Lock user → check deposit
 // 2) Get book price
-// 3) Lock one available item
-// 4) Deduct deposit
-// 5) Reserve item
-// 6) Insert rental
-func (s *service) BookWithDeposit(ctx context.Context, userID, bookID int64, holdMinutes int) (err error) {
-	// var dbgCount int64
-	// _ = s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM books`).Scan(&dbgCount)
-	// slog.Info("dbg books count", "count", dbgCount)
-	// //debugging
-
+// 3) Lock one available item (at the slot's branch when a slot is given)
+// 4) Reserve item until the slot ends, or for holdMinutes
+// 5) Insert BOOKED rental
+// 6) Pay from deposit → PAID
+func (s *service) BookWithDeposit(ctx context.Context, userID, bookID int64, holdMinutes int, slotID int64) (rentalID int64, err error) {
 	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer func() {
 		if err != nil {
 			_ = tx.Rollback()
 		} else {
-			_ = tx.Commit()
+			err = tx.Commit()
 		}
 	}()
 
-	// Lock user for deposit check
-	var deposit float64
-	err = tx.QueryRowContext(ctx,
-		`SELECT deposit_balance FROM users WHERE id=$1 FOR UPDATE`, userID).
-		Scan(&deposit)
+	deposit, err := s.rr.LockUserForUpdate(ctx, tx, userID)
 	if err != nil {
-		return echo.NewHTTPError(404, echo.Map{"message": "user not found"})
+		return 0, echo.NewHTTPError(404, echo.Map{"message": "user not found"})
 	}
-
-	// Lock book for availability check
-	var price float64
-	var stock int64
-	err = tx.QueryRowContext(ctx,
-		`SELECT price, stock_availability
-		 FROM books
-		 WHERE id=$1
-		 FOR UPDATE`, bookID).
-		Scan(&price, &stock)
-	if err != nil {
-		return echo.NewHTTPError(404, echo.Map{"message": "book not found"})
+	if err = s.checkEligibility(ctx, tx, userID, []int64{bookID}); err != nil {
+		return 0, err
 	}
 
-	if stock <= 0 {
-		return echo.NewHTTPError(409, echo.Map{"message": "no available copy"})
+	price, err := s.rr.GetBookPrice(ctx, tx, bookID)
+	if err != nil {
+		return 0, echo.NewHTTPError(404, echo.Map{"message": "book not found"})
 	}
 	if deposit < price {
-		return echo.NewHTTPError(402, echo.Map{
+		return 0, echo.NewHTTPError(402, echo.Map{
 			"message": "insufficient deposit",
 			"needed":  price - deposit,
 		})
 	}
 
-	// Deduct deposit and decrease stock
-	if _, err = tx.ExecContext(ctx,
-		`UPDATE users
-		 SET deposit_balance = deposit_balance - $1
-		 WHERE id = $2`,
-		price, userID); err != nil {
-		return fmt.Errorf("deduct deposit: %w", err)
+	itemID, dueAt, err := s.holdCopy(ctx, tx, bookID, holdMinutes, slotID)
+	if err != nil {
+		return 0, err
+	}
+	if rentalID, err = s.rr.InsertRental(ctx, tx, userID, bookID, itemID, price, dueAt); err != nil {
+		return 0, fmt.Errorf("insert rental: %w", err)
+	}
+	if slotID > 0 {
+		if err = s.rr.SetPickupSlot(ctx, tx, rentalID, slotID); err != nil {
+			return 0, fmt.Errorf("set slot: %w", err)
+		}
+	}
+
+	r := &model.Rental{ID: rentalID, UserID: userID, BookID: bookID, BookItemID: itemID,
+		Status: model.RentalBooked, RentalCost: price, PaymentDueAt: dueAt}
+	if err = s.payFromDeposit(ctx, tx, r, deposit); err != nil {
+		return 0, err
+	}
+	return rentalID, nil
+}
+
+// Pay settles a BOOKED rental from the owner's deposit.
+// Business rules:
+// - Only owner can pay (403)
+// - Rental must be BOOKED and inside its payment window (409)
+// - Rentals booked with an invoice are paid through it, not here (409)
+// - Deposit must cover the cost (402)
+func (s *service) Pay(ctx context.Context, userID, rentalID int64) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	r, err := s.loadForUpdate(ctx, tx, rentalID)
+	if err != nil {
+		return err
+	}
+	if r.UserID != userID {
+		return echo.NewHTTPError(403, echo.Map{"message": "not the owner of this rental"})
+	}
+	if r.XenditInvoiceID != nil {
+		return echo.NewHTTPError(409, echo.Map{"message": "rental is paid by invoice", "invoice_id": *r.XenditInvoiceID})
+	}
+	if r.Status == model.RentalBooked && time.Now().After(r.PaymentDueAt) {
+		return echo.NewHTTPError(409, echo.Map{"message": "payment window has expired"})
+	}
+
+	deposit, err := s.rr.LockUserForUpdate(ctx, tx, userID)
+	if err != nil {
+		return echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("lock user: %v", err)})
+	}
+	return s.payFromDeposit(ctx, tx, r, deposit)
+}
+
+// payFromDeposit moves r BOOKED → PAID, debits the deposit and writes the
+// RENTAL_CHARGE ledger line. The user row must already be locked in tx.
+func (s *service) payFromDeposit(ctx context.Context, tx *sql.Tx, r *model.Rental, deposit model.Money) error {
+	if err := s.transition(ctx, tx, r, model.RentalPaid); err != nil {
+		return err
+	}
+	if deposit < r.RentalCost {
+		return echo.NewHTTPError(402, echo.Map{
+			"message": "insufficient deposit",
+			"needed":  r.RentalCost - deposit,
+		})
 	}
+	if err := s.rr.DeductDeposit(ctx, tx, r.UserID, r.RentalCost); err != nil {
+		return echo.NewHTTPError(402, echo.Map{"message": err.Error()})
+	}
+	if err := s.wr.InsertLedger(ctx, tx, r.UserID, "rentals", &r.ID, string(model.LedgerCharge), -r.RentalCost, deposit-r.RentalCost); err != nil {
+		return fmt.Errorf("insert ledger charge: %w", err)
+	}
+	return nil
+}
 
-	if _, err = tx.ExecContext(ctx,
-		`UPDATE books
-		 SET stock_availability = stock_availability - 1
-		 WHERE id = $1`, bookID); err != nil {
-		return fmt.Errorf("decrease stock: %w", err)
+// refundCharged credits back percent of whatever is still charged for r and
+// writes a RENTAL_REFUND line with the real balance_after. Returns the amount
+// refunded; no-op when nothing was paid.
+func (s *service) refundCharged(ctx context.Context, tx *sql.Tx, r *model.Rental, percent int) (model.Money, error) {
+	charged, err := s.wr.NetRentalCharge(ctx, tx, r.ID)
+	if err != nil {
+		return 0, fmt.Errorf("net rental charge: %w", err)
+	}
+	amount := refundShare(charged, percent)
+	if amount <= 0 {
+		return 0, nil
+	}
+	if _, err := s.postToWallet(ctx, tx, r, model.LedgerRefund, amount); err != nil {
+		return 0, err
 	}
+	return amount, nil
+}
 
-	// Insert rental record
-	var rentalID int64
-	if err = tx.QueryRowContext(ctx,
-		`INSERT INTO rentals (user_id, book_id, status, price)
-     VALUES ($1, $2, 'ACTIVE', $3)
-     RETURNING id`,
-		userID, bookID, price).Scan(&rentalID); err != nil {
-		return fmt.Errorf("insert rental: %w", err)
+// postToWallet applies a signed amount to the renter's balance, records it
+// against the rental and returns the new balance. Debits may take the balance
+// below zero (a debt): fees are owed whether or not the deposit covers them.
+func (s *service) postToWallet(ctx context.Context, tx *sql.Tx, r *model.Rental, entry model.LedgerType, amount model.Money) (model.Money, error) {
+	bal, err := s.wr.GetUserBalanceForUpdate(ctx, tx, r.UserID)
+	if err != nil {
+		return 0, fmt.Errorf("lock balance: %w", err)
+	}
+	newBal := bal + amount
+	if err := s.wr.UpdateUserBalance(ctx, tx, r.UserID, newBal); err != nil {
+		return 0, fmt.Errorf("update balance: %w", err)
 	}
-	//ledger credit
-	if err := s.wr.InsertLedger(ctx, tx, userID, "rentals", &rentalID, "RENTAL_REFUND", price /* newBal? recompute */, 0); err != nil {
-		return fmt.Errorf("insert ledger refund: %w", err)
+	if err := s.wr.InsertLedger(ctx, tx, r.UserID, "rentals", &r.ID, string(entry), amount, newBal); err != nil {
+		return 0, fmt.Errorf("insert ledger %s: %w", entry, err)
+	}
+	return newBal, nil
+}
+
+// Pickup hands a PAID copy to its renter: rental → ACTIVE, copy → RENTED.
+func (s *service) Pickup(ctx context.Context, rentalID int64) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
 	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
 
+	r, err := s.loadForUpdate(ctx, tx, rentalID)
+	if err != nil {
+		return err
+	}
+	if err = s.transition(ctx, tx, r, model.RentalActive); err != nil {
+		return err
+	}
+	if err = s.rr.MarkItemRented(ctx, tx, r.BookItemID); err != nil {
+		return echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("mark rented: %v", err)})
+	}
+	if _, err = s.rr.StartLoan(ctx, tx, r.ID); err != nil {
+		return echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("start loan: %v", err)})
+	}
 	return nil
 }
 
-// Return marks an ACTIVE rental returned and frees the copy.
+// Return marks an ACTIVE rental returned, frees the copy and debits a late
+// fee from the deposit when the copy comes back after due_at.
 // Business rules:
 // - Only owner can return (403)
 // - Rental must be ACTIVE (409)
 // - Rental must exist (404)
-func (s *service) Return(ctx context.Context, userID, rentalID int64) (err error) {
+func (s *service) Return(ctx context.Context, userID, rentalID int64) (rc *ReturnReceipt, err error) {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+		return nil, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
 	}
+	var handoff *notice
 	defer func() {
 		if err != nil {
 			_ = tx.Rollback()
-		} else {
-			_ = tx.Commit()
+		} else if err = tx.Commit(); err == nil {
+			s.send(ctx, []*notice{handoff})
 		}
 	}()
 
-	owner, status, copyID, err := s.rr.GetRentalOwnerAndStatus(ctx, tx, rentalID)
+	r, err := s.loadForUpdate(ctx, tx, rentalID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return echo.NewHTTPError(404, echo.Map{"message": "rental not found"})
-		}
-		return echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("load rental: %v", err)})
+		return nil, err
 	}
-	if owner != userID {
-		return echo.NewHTTPError(403, echo.Map{"message": "not the owner of this rental"})
+	if r.UserID != userID {
+		return nil, echo.NewHTTPError(403, echo.Map{"message": "not the owner of this rental"})
+	}
+	rc, handoff, err = s.returnRental(ctx, tx, r)
+	return rc, err
+}
+
+// returnRental moves a locked ACTIVE rental to RETURNED, hands the copy on
+// and charges any late fee.
+func (s *service) returnRental(ctx context.Context, tx *sql.Tx, r *model.Rental) (*ReturnReceipt, *notice, error) {
+	if err := s.transition(ctx, tx, r, model.RentalReturned); err != nil {
+		return nil, nil, err
+	}
+	handoff, err := s.releaseCopy(ctx, tx, r.BookID, r.BookItemID)
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("release copy: %v", err)})
 	}
-	if status != "ACTIVE" {
-		return echo.NewHTTPError(409, echo.Map{"message": "rental is not ACTIVE"})
+	rc, err := s.chargeLateFee(ctx, tx, r, time.Now())
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("late fee: %v", err)})
 	}
+	return rc, handoff, nil
+}
 
-	if err = s.rr.MarkReturned(ctx, tx, rentalID); err != nil {
-		return echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("mark returned: %v", err)})
+// chargeLateFee works out the fee for r returned at returnedAt, stores it on
+// the rental and debits it with a LATE_FEE ledger line.
+func (s *service) chargeLateFee(ctx context.Context, tx *sql.Tx, r *model.Rental, returnedAt time.Time) (*ReturnReceipt, error) {
+	if r.DueAt == nil {
+		return &ReturnReceipt{}, nil
 	}
-	if err = s.rr.FreeCopy(ctx, tx, copyID); err != nil {
-		return echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("free copy: %v", err)})
+	_, perDay, err := s.rr.GetLoanTerms(ctx, tx, r.BookID)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	days, fee := lateFee(*r.DueAt, returnedAt, perDay)
+	if fee <= 0 {
+		return &ReturnReceipt{OverdueDays: days}, nil
+	}
+	if err := s.rr.SetLateFee(ctx, tx, r.ID, fee); err != nil {
+		return nil, err
+	}
+	if _, err := s.postToWallet(ctx, tx, r, model.LedgerLate, -fee); err != nil {
+		return nil, err
+	}
+	return &ReturnReceipt{OverdueDays: days, LateFee: fee}, nil
 }
 
 // MyHistory returns rentals for a user.
@@ -171,3 +364,14 @@ func (s *service) MyHistory(ctx context.Context, userID int64) ([]HistoryRow, er
 	}
 	return rows, nil
 }
+
+func (s *service) loadForUpdate(ctx context.Context, tx *sql.Tx, rentalID int64) (*model.Rental, error) {
+	r, err := s.rr.GetForUpdate(ctx, tx, rentalID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, echo.NewHTTPError(404, echo.Map{"message": "rental not found"})
+		}
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("load rental: %v", err)})
+	}
+	return r, nil
+}
@@ -0,0 +1,53 @@
+package rental
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"bookrental/model"
+	rentalrepo "bookrental/repository/rental"
+
+	"github.com/labstack/echo/v4"
+)
+
+// transitions lists every legal rental status move:
+//
+//	BOOKED → PAID → ACTIVE → RETURNED
+//	BOOKED/PAID → CANCELED
+//	ACTIVE → LOST
+//
+// Anything else is rejected with 409 so handlers never re-check status themselves.
+var transitions = map[model.RentalStatus][]model.RentalStatus{
+	model.RentalBooked: {model.RentalPaid, model.RentalCanceled},
+	model.RentalPaid:   {model.RentalActive, model.RentalCanceled},
+	model.RentalActive: {model.RentalReturned, model.RentalLost},
+}
+
+func canTransition(from, to model.RentalStatus) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transition validates and persists r.Status → to inside tx.
+// r must have been loaded with GetForUpdate in the same tx.
+func (s *service) transition(ctx context.Context, tx *sql.Tx, r *model.Rental, to model.RentalStatus) error {
+	if !canTransition(r.Status, to) {
+		return echo.NewHTTPError(409, echo.Map{
+			"message": fmt.Sprintf("rental is %s, cannot move to %s", r.Status, to),
+		})
+	}
+	if err := s.rr.Transition(ctx, tx, r.ID, r.Status, to); err != nil {
+		if errors.Is(err, rentalrepo.ErrStatusChanged) {
+			return echo.NewHTTPError(409, echo.Map{"message": "rental status changed, retry"})
+		}
+		return echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("transition rental: %v", err)})
+	}
+	r.Status = to
+	return nil
+}
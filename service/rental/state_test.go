@@ -0,0 +1,35 @@
+package rental
+
+import (
+	"testing"
+
+	"bookrental/model"
+)
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from, to model.RentalStatus
+		want     bool
+	}{
+		{model.RentalBooked, model.RentalPaid, true},
+		{model.RentalBooked, model.RentalCanceled, true},
+		{model.RentalPaid, model.RentalActive, true},
+		{model.RentalPaid, model.RentalCanceled, true},
+		{model.RentalActive, model.RentalReturned, true},
+		{model.RentalActive, model.RentalLost, true},
+
+		{model.RentalBooked, model.RentalActive, false},
+		{model.RentalBooked, model.RentalReturned, false},
+		{model.RentalPaid, model.RentalReturned, false},
+		{model.RentalActive, model.RentalCanceled, false},
+		{model.RentalReturned, model.RentalActive, false},
+		{model.RentalCanceled, model.RentalBooked, false},
+		{model.RentalPaid, model.RentalLost, false},
+		{model.RentalLost, model.RentalReturned, false},
+	}
+	for _, c := range cases {
+		if got := canTransition(c.from, c.to); got != c.want {
+			t.Errorf("canTransition(%s, %s) = %v; want %v", c.from, c.to, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package rental
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"bookrental/model"
+)
+
+// sweepBatch caps how many expired holds one sweep locks in a single tx.
+const sweepBatch = 100
+
+// ExpireHolds cancels BOOKED rentals past payment_due_at, frees their copies
+// and refunds anything that was already charged. PAID rentals whose pickup
+// slot ended without a pickup are canceled too, refunded per the cancel
+// policy like any other cancellation. Rows are claimed with SKIP LOCKED, so
+// running it on every instance is safe.
+//
+// Each rental is handled under its own savepoint: one that fails is rolled
+// back on its own and reported in the returned error, while the rest of the
+// batch still commits. n counts the rentals that were expired.
+func (s *service) ExpireHolds(ctx context.Context) (n int, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		notes  []*notice
+		failed []error
+	)
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else if err = tx.Commit(); err == nil {
+			s.send(ctx, notes)
+			// Reported only after the good rows committed, so the worker logs them.
+			err = errors.Join(failed...)
+		}
+	}()
+
+	expired, err := s.rr.LockExpiredHolds(ctx, tx, sweepBatch)
+	if err != nil {
+		return 0, fmt.Errorf("lock expired holds: %w", err)
+	}
+	for i := range expired {
+		r := &expired[i]
+		note, rowErr, err := inSavepoint(ctx, tx, func() (*notice, error) { return s.expireHold(ctx, tx, r) })
+		if err != nil {
+			return 0, err
+		}
+		if rowErr != nil {
+			failed = append(failed, fmt.Errorf("expire rental %d: %w", r.ID, rowErr))
+			continue
+		}
+		notes = append(notes, note)
+	}
+
+	missed, err := s.rr.LockMissedPickups(ctx, tx, sweepBatch)
+	if err != nil {
+		return 0, fmt.Errorf("lock missed pickups: %w", err)
+	}
+	percent := s.cfg.CancelRefund.percent(s.cfg.CancelRefundPercent)
+	for i := range missed {
+		r := &missed[i]
+		note, rowErr, err := inSavepoint(ctx, tx, func() (*notice, error) {
+			_, n, err := s.cancelRental(ctx, tx, r, percent)
+			return n, err
+		})
+		if err != nil {
+			return 0, err
+		}
+		if rowErr != nil {
+			failed = append(failed, fmt.Errorf("expire pickup %d: %w", r.ID, rowErr))
+			continue
+		}
+		notes = append(notes, note)
+	}
+
+	return len(notes), nil
+}
+
+// inSavepoint runs fn so that a failure undoes only fn's own writes. rowErr
+// is fn's error; err means the savepoint itself broke and tx is unusable.
+func inSavepoint(ctx context.Context, tx *sql.Tx, fn func() (*notice, error)) (n *notice, rowErr, err error) {
+	if _, err = tx.ExecContext(ctx, "SAVEPOINT sweep_row"); err != nil {
+		return nil, nil, err
+	}
+	if n, rowErr = fn(); rowErr != nil {
+		if _, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT sweep_row"); err != nil {
+			return nil, rowErr, fmt.Errorf("rollback to savepoint: %w", err)
+		}
+		return nil, rowErr, nil
+	}
+	if _, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT sweep_row"); err != nil {
+		return nil, nil, err
+	}
+	return n, nil, nil
+}
+
+// expireHold cancels r, refunds it and passes the copy to the next in line.
+func (s *service) expireHold(ctx context.Context, tx *sql.Tx, r *model.Rental) (*notice, error) {
+	if err := s.transition(ctx, tx, r, model.RentalCanceled); err != nil {
+		return nil, err
+	}
+	if _, err := s.refundCharged(ctx, tx, r, 100); err != nil {
+		return nil, err
+	}
+	return s.releaseCopy(ctx, tx, r.BookID, r.BookItemID)
+}
@@ -0,0 +1,49 @@
+package rental
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"bookrental/model"
+)
+
+func TestExpireHoldsIsolatesFailures(t *testing.T) {
+	rr, wr := newFakeRentals(), newFakeWallet()
+	bad := rr.add(model.Rental{ID: 1, UserID: 7, BookID: 1, BookItemID: 11, Status: model.RentalBooked})
+	good := rr.add(model.Rental{ID: 2, UserID: 8, BookID: 1, BookItemID: 12, Status: model.RentalBooked})
+	missed := rr.add(model.Rental{ID: 3, UserID: 9, BookID: 2, BookItemID: 21, Status: model.RentalPaid})
+	rr.expired = []model.Rental{*bad, *good}
+	rr.missed = []model.Rental{*missed}
+	rr.transitionErr[1] = errors.New("boom")
+	wr.ledger = append(wr.ledger, ledgerLine{9, 3, model.LedgerCharge, -model.Units(100)})
+
+	s, db := newTestService(rr, wr, Config{})
+	n, err := s.ExpireHolds(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "expire rental 1") {
+		t.Fatalf("err = %v; want the failure of rental 1 reported", err)
+	}
+	if n != 2 {
+		t.Errorf("n = %d; want 2", n)
+	}
+	if db.Commits() != 1 || db.Rollbacks() != 0 {
+		t.Errorf("commits %d, rollbacks %d; want the batch committed", db.Commits(), db.Rollbacks())
+	}
+	if rr.rentals[2].Status != model.RentalCanceled || rr.rentals[3].Status != model.RentalCanceled {
+		t.Errorf("statuses %s, %s; want both CANCELED", rr.rentals[2].Status, rr.rentals[3].Status)
+	}
+	if got := wr.bal[9]; got != model.Units(100) {
+		t.Errorf("missed pickup refund = %v; want 100.00", got)
+	}
+
+	var rolledBack int
+	for _, q := range db.Execs() {
+		if q == "ROLLBACK TO SAVEPOINT sweep_row" {
+			rolledBack++
+		}
+	}
+	if rolledBack != 1 {
+		t.Errorf("rolled back to savepoint %d times; want 1", rolledBack)
+	}
+}
@@ -0,0 +1,242 @@
+package rental
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	rentalrepo "bookrental/repository/rental"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/echo/v4"
+)
+
+type WaitlistRow = rentalrepo.WaitlistRow
+
+// notice is a message to send once the tx that produced it has committed.
+type notice struct {
+	userID        int64
+	subject, body string
+}
+
+// JoinWaitlist queues userID for the next free copy of bookID. The book is
+// locked while availability is checked and the entry inserted, so a copy
+// freed at the same moment is handed to the new entry rather than missed.
+// Business rules:
+// - Book must exist (404)
+// - Only when no copy is available (409)
+// - One open entry per user and book (409)
+func (s *service) JoinWaitlist(ctx context.Context, userID, bookID int64) (*WaitlistRow, error) {
+	entryID, err := s.joinWaitlist(ctx, userID, bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.MyWaitlist(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		if rows[i].EntryID == entryID {
+			return &rows[i], nil
+		}
+	}
+	return &WaitlistRow{EntryID: entryID, BookID: bookID}, nil
+}
+
+func (s *service) joinWaitlist(ctx context.Context, userID, bookID int64) (entryID int64, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	if err = s.rr.LockBook(ctx, tx, bookID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, echo.NewHTTPError(404, echo.Map{"message": "book not found"})
+		}
+		return 0, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("lock book: %v", err)})
+	}
+	avail, err := s.rr.CountAvailable(ctx, tx, bookID)
+	if err != nil {
+		return 0, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("count available: %v", err)})
+	}
+	if avail > 0 {
+		return 0, echo.NewHTTPError(409, echo.Map{"message": "copies are available, book directly"})
+	}
+
+	entryID, err = s.rr.JoinWaitlist(ctx, tx, bookID, userID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23505": // unique_violation
+				return 0, echo.NewHTTPError(409, echo.Map{"message": "already on the waitlist"})
+			case "23503": // foreign_key_violation
+				return 0, echo.NewHTTPError(404, echo.Map{"message": "book not found"})
+			}
+		}
+		return 0, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("join waitlist: %v", err)})
+	}
+	return entryID, nil
+}
+
+// LeaveWaitlist drops the user's open entry for bookID (404 when there is none).
+func (s *service) LeaveWaitlist(ctx context.Context, userID, bookID int64) error {
+	left, err := s.rr.LeaveWaitlist(ctx, bookID, userID)
+	if err != nil {
+		return echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("leave waitlist: %v", err)})
+	}
+	if !left {
+		return echo.NewHTTPError(404, echo.Map{"message": "not on the waitlist"})
+	}
+	return nil
+}
+
+// MyWaitlist lists the user's open waitlist entries and their place in line.
+func (s *service) MyWaitlist(ctx context.Context, userID int64) ([]WaitlistRow, error) {
+	rows, err := s.rr.MyWaitlist(ctx, userID)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("list waitlist: %v", err)})
+	}
+	return rows, nil
+}
+
+// releaseCopy frees itemID and hands it straight on to the head of the
+// queue for bookID, if any. The returned notice (nil when nobody was
+// waiting) must only be sent after tx commits.
+func (s *service) releaseCopy(ctx context.Context, tx *sql.Tx, bookID, itemID int64) (*notice, error) {
+	if err := s.rr.ShareLockBook(ctx, tx, bookID); err != nil {
+		return nil, fmt.Errorf("lock book: %w", err)
+	}
+	if err := s.rr.FreeCopy(ctx, tx, itemID); err != nil {
+		return nil, fmt.Errorf("free copy: %w", err)
+	}
+	return s.handOff(ctx, tx, bookID, itemID)
+}
+
+// OfferCopies hands available copies of bookID to the users queued for it,
+// oldest entry first, until either runs out. New copies are shelved outside
+// the rental flow, so whoever adds them calls this afterwards. n counts the
+// copies handed over.
+func (s *service) OfferCopies(ctx context.Context, bookID int64) (n int, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	var notes []*notice
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else if err = tx.Commit(); err == nil {
+			s.send(ctx, notes)
+		}
+	}()
+
+	if err = s.rr.ShareLockBook(ctx, tx, bookID); err != nil {
+		return 0, fmt.Errorf("lock book: %w", err)
+	}
+	for {
+		itemID, err := s.rr.LockOneAvailableItem(ctx, tx, bookID)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("lock available item: %w", err)
+		}
+		note, err := s.handOff(ctx, tx, bookID, itemID)
+		if err != nil {
+			return 0, err
+		}
+		if note == nil {
+			break
+		}
+		notes = append(notes, note)
+	}
+	return len(notes), nil
+}
+
+// handOff holds the free copy itemID for the first user queued for bookID
+// who passes the borrowing rules, as a BOOKED rental they can pay for until
+// the waitlist hold runs out. Users who fail the rules are skipped. It
+// returns a nil notice and leaves the copy alone when nobody qualifies.
+func (s *service) handOff(ctx context.Context, tx *sql.Tx, bookID, itemID int64) (*notice, error) {
+	for {
+		entryID, userID, err := s.rr.LockNextWaiting(ctx, tx, bookID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("next waiting: %w", err)
+		}
+		ok, err := s.eligibleWaiter(ctx, tx, userID, bookID)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return s.holdForWaiter(ctx, tx, entryID, userID, bookID, itemID)
+		}
+		if err := s.rr.SkipWaiting(ctx, tx, entryID); err != nil {
+			return nil, fmt.Errorf("skip waitlist entry: %w", err)
+		}
+	}
+}
+
+// eligibleWaiter runs the borrowing rules for a queued user as their own
+// booking would. A broken rule gives false; anything else is an error.
+func (s *service) eligibleWaiter(ctx context.Context, tx *sql.Tx, userID, bookID int64) (bool, error) {
+	if _, err := s.rr.LockUserForUpdate(ctx, tx, userID); err != nil {
+		return false, fmt.Errorf("lock user: %w", err)
+	}
+	err := s.checkEligibility(ctx, tx, userID, []int64{bookID})
+	var he *echo.HTTPError
+	if errors.As(err, &he) && he.Code == 422 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// holdForWaiter books itemID for the waitlist entry and marks it fulfilled.
+func (s *service) holdForWaiter(ctx context.Context, tx *sql.Tx, entryID, userID, bookID, itemID int64) (*notice, error) {
+	price, err := s.rr.GetBookPrice(ctx, tx, bookID)
+	if err != nil {
+		return nil, fmt.Errorf("book price: %w", err)
+	}
+	dueAt := time.Now().Add(s.cfg.WaitlistHold)
+	if err := s.rr.ReserveItem(ctx, tx, itemID, &dueAt); err != nil {
+		return nil, fmt.Errorf("reserve item: %w", err)
+	}
+	rentalID, err := s.rr.InsertRental(ctx, tx, userID, bookID, itemID, price, dueAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert rental: %w", err)
+	}
+	if err := s.rr.FulfillWaiting(ctx, tx, entryID, rentalID); err != nil {
+		return nil, fmt.Errorf("fulfill waitlist: %w", err)
+	}
+
+	return &notice{
+		userID:  userID,
+		subject: "Your book is on hold",
+		body: fmt.Sprintf("A copy is held for you as rental #%d. Pay before %s to keep it.",
+			rentalID, dueAt.Format(time.RFC3339)),
+	}, nil
+}
+
+// send delivers notices; failures are logged by the notifier and never undo
+// the committed work.
+func (s *service) send(ctx context.Context, notes []*notice) {
+	for _, n := range notes {
+		if n == nil {
+			continue
+		}
+		_ = s.notifier.Notify(ctx, n.userID, n.subject, n.body)
+	}
+}
@@ -0,0 +1,221 @@
+package rental
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"bookrental/model"
+)
+
+// waitlistFixture has rental 1 of user 7 holding copy 11 of book 1 in the
+// given status, with users 8 and then 9 queued for the book.
+func waitlistFixture(status model.RentalStatus) *fakeRentals {
+	rr := newFakeRentals()
+	rr.prices[1] = model.Units(40)
+	rr.add(model.Rental{ID: 1, UserID: 7, BookID: 1, BookItemID: 11, Status: status, PaymentDueAt: time.Now().Add(-time.Minute)})
+	rr.deposits[8], rr.deposits[9] = 0, 0
+	rr.wait(1, 8)
+	rr.wait(1, 9)
+	return rr
+}
+
+func waitlistService(rr *fakeRentals) (*service, *recordingNotifier) {
+	s, db := newTestService(rr, newFakeWallet(), Config{WaitlistHold: time.Hour})
+	n := &recordingNotifier{db: db}
+	s.notifier = n
+	return s, n
+}
+
+func TestFreedCopyGoesToNextInLine(t *testing.T) {
+	cases := []struct {
+		name   string
+		status model.RentalStatus
+		free   func(s *service, rr *fakeRentals) error
+	}{
+		{"return", model.RentalActive, func(s *service, _ *fakeRentals) error {
+			_, err := s.Return(context.Background(), 7, 1)
+			return err
+		}},
+		{"cancel", model.RentalPaid, func(s *service, _ *fakeRentals) error {
+			_, err := s.Cancel(context.Background(), 7, 1)
+			return err
+		}},
+		{"expired hold", model.RentalBooked, func(s *service, rr *fakeRentals) error {
+			rr.expired = []model.Rental{*rr.rentals[1]}
+			_, err := s.ExpireHolds(context.Background())
+			return err
+		}},
+	}
+	for _, c := range cases {
+		rr := waitlistFixture(c.status)
+		s, n := waitlistService(rr)
+
+		if err := c.free(s, rr); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(rr.freed) != 1 || len(rr.reserved) != 1 || rr.reserved[0] != 11 {
+			t.Errorf("%s: freed %v, reserved %v; want copy 11 freed and held again", c.name, rr.freed, rr.reserved)
+		}
+		head := rr.waitlist[0]
+		r := rr.rentals[head.rentalID]
+		if head.status != "FULFILLED" || r == nil {
+			t.Fatalf("%s: head of line is %s with rental %d; want FULFILLED with a rental", c.name, head.status, head.rentalID)
+		}
+		if r.UserID != 8 || r.BookItemID != 11 || r.Status != model.RentalBooked || r.RentalCost != model.Units(40) {
+			t.Errorf("%s: handed over %+v; want a BOOKED rental of copy 11 for user 8 at 40.00", c.name, r)
+		}
+		if d := time.Until(r.PaymentDueAt); d <= 59*time.Minute || d > time.Hour {
+			t.Errorf("%s: hold runs %v; want the waitlist hold of 1h", c.name, d)
+		}
+		if rr.waitlist[1].status != "WAITING" {
+			t.Errorf("%s: user 9 is %s; want still WAITING", c.name, rr.waitlist[1].status)
+		}
+		if len(n.sent) != 1 || n.sent[0].userID != 8 || n.sent[0].commits != 1 {
+			t.Errorf("%s: sent %+v; want one notice to user 8 after the commit", c.name, n.sent)
+		}
+	}
+}
+
+func TestHandoffSkipsIneligibleWaiters(t *testing.T) {
+	rr := waitlistFixture(model.RentalActive)
+	rr.stats[8] = &Borrower{CreatedAt: time.Now().AddDate(-1, 0, 0), Overdue: 1}
+	s, n := waitlistService(rr)
+	s.cfg.Rules = []Rule{NoOverdue()}
+
+	if _, err := s.Return(context.Background(), 7, 1); err != nil {
+		t.Fatal(err)
+	}
+	if rr.waitlist[0].status != "SKIPPED" || rr.waitlist[1].status != "FULFILLED" {
+		t.Fatalf("entries %s, %s; want user 8 skipped and user 9 served", rr.waitlist[0].status, rr.waitlist[1].status)
+	}
+	if r := rr.rentals[rr.waitlist[1].rentalID]; r.UserID != 9 || r.BookItemID != 11 {
+		t.Errorf("handed over %+v; want copy 11 for user 9", r)
+	}
+	if len(n.sent) != 1 || n.sent[0].userID != 9 {
+		t.Errorf("sent %+v; want one notice to user 9", n.sent)
+	}
+}
+
+func TestHandoffWithNobodyEligibleLeavesCopyFree(t *testing.T) {
+	rr := waitlistFixture(model.RentalActive)
+	for _, user := range []int64{8, 9} {
+		rr.stats[user] = &Borrower{CreatedAt: time.Now().AddDate(-1, 0, 0), Overdue: 1}
+	}
+	s, n := waitlistService(rr)
+	s.cfg.Rules = []Rule{NoOverdue()}
+
+	if _, err := s.Return(context.Background(), 7, 1); err != nil {
+		t.Fatal(err)
+	}
+	if rr.waitlist[0].status != "SKIPPED" || rr.waitlist[1].status != "SKIPPED" {
+		t.Errorf("entries %s, %s; want both skipped", rr.waitlist[0].status, rr.waitlist[1].status)
+	}
+	if len(rr.freed) != 1 || len(rr.reserved) != 0 || len(rr.rentals) != 1 || len(n.sent) != 0 {
+		t.Errorf("freed %v, reserved %v, %d rentals, sent %v; want the copy left free", rr.freed, rr.reserved, len(rr.rentals), n.sent)
+	}
+}
+
+func TestFreedCopyWithEmptyQueueStaysFree(t *testing.T) {
+	rr := waitlistFixture(model.RentalActive)
+	rr.waitlist = nil
+	s, n := waitlistService(rr)
+
+	if _, err := s.Return(context.Background(), 7, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(rr.freed) != 1 || len(rr.reserved) != 0 || len(rr.rentals) != 1 || len(n.sent) != 0 {
+		t.Errorf("freed %v, reserved %v, %d rentals, sent %v; want the copy left free", rr.freed, rr.reserved, len(rr.rentals), n.sent)
+	}
+}
+
+func TestRolledBackHandoffSendsNoNotice(t *testing.T) {
+	rr := waitlistFixture(model.RentalActive)
+	due := time.Now().Add(-48 * time.Hour)
+	rr.rentals[1].DueAt = &due
+	rr.lateFeePerDay = model.Units(1)
+	rr.lateFeeErr = errors.New("boom")
+	s, n := waitlistService(rr)
+
+	if _, err := s.Return(context.Background(), 7, 1); httpCode(err) != 500 {
+		t.Fatalf("err = %v; want 500", err)
+	}
+	if len(n.sent) != 0 || n.db.Rollbacks() != 1 {
+		t.Errorf("sent %+v, rollbacks %d; want nothing sent for the rolled-back handoff", n.sent, n.db.Rollbacks())
+	}
+}
+
+func TestWaitlistPositionAndLeave(t *testing.T) {
+	rr := waitlistFixture(model.RentalActive)
+	rr.prices[2] = model.Units(40)
+	rr.wait(2, 9)
+	s, _ := waitlistService(rr)
+	ctx := context.Background()
+
+	rows, err := s.MyWaitlist(ctx, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].BookID != 1 || rows[0].Position != 2 || rows[1].BookID != 2 || rows[1].Position != 1 {
+		t.Fatalf("rows %+v; want 2nd for book 1 and 1st for book 2", rows)
+	}
+
+	if err := s.LeaveWaitlist(ctx, 8, 1); err != nil {
+		t.Fatal(err)
+	}
+	if rows, _ = s.MyWaitlist(ctx, 9); rows[0].Position != 1 {
+		t.Errorf("position %d after user 8 left; want 1", rows[0].Position)
+	}
+	if err := s.LeaveWaitlist(ctx, 8, 1); httpCode(err) != 404 {
+		t.Errorf("leaving twice: %v; want 404", err)
+	}
+}
+
+func TestJoinWaitlist(t *testing.T) {
+	rr := waitlistFixture(model.RentalActive)
+	s, _ := waitlistService(rr)
+	ctx := context.Background()
+
+	row, err := s.JoinWaitlist(ctx, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.BookID != 1 || row.Position != 3 {
+		t.Errorf("row %+v; want 3rd in line for book 1", row)
+	}
+	if _, err := s.JoinWaitlist(ctx, 10, 1); httpCode(err) != 409 {
+		t.Errorf("joining twice: %v; want 409", err)
+	}
+	if _, err := s.JoinWaitlist(ctx, 10, 5); httpCode(err) != 404 {
+		t.Errorf("unknown book: %v; want 404", err)
+	}
+
+	rr.items[12] = 1
+	if _, err := s.JoinWaitlist(ctx, 11, 1); httpCode(err) != 409 {
+		t.Errorf("with a free copy: %v; want 409", err)
+	}
+}
+
+func TestOfferCopiesServesQueueInOrder(t *testing.T) {
+	rr := waitlistFixture(model.RentalActive)
+	rr.items[12], rr.items[13], rr.items[14] = 1, 1, 1
+	s, n := waitlistService(rr)
+
+	handed, err := s.OfferCopies(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handed != 2 || len(rr.reserved) != 2 || len(n.sent) != 2 {
+		t.Fatalf("handed %d, reserved %v, sent %+v; want one copy each for users 8 and 9", handed, rr.reserved, n.sent)
+	}
+	for i, user := range []int64{8, 9} {
+		e := rr.waitlist[i]
+		if e.status != "FULFILLED" || rr.rentals[e.rentalID].UserID != user || n.sent[i].userID != user || n.sent[i].commits != 1 {
+			t.Errorf("entry %d: %+v, notice %+v; want user %d served and told after the commit", i, e, n.sent[i], user)
+		}
+	}
+	if handed, err = s.OfferCopies(context.Background(), 1); handed != 0 || err != nil {
+		t.Errorf("empty queue: %d, %v; want nothing handed over", handed, err)
+	}
+}
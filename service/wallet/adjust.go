@@ -0,0 +1,167 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"bookrental/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdjustReq is a manual credit (positive) or debit (negative) by an admin.
+type AdjustReq struct {
+	UserID int64
+	Amount model.Money
+	Reason string
+}
+
+// needsApproval reports whether an adjustment of amount waits for a second
+// admin. threshold <= 0 turns approval off.
+func needsApproval(amount, threshold model.Money) bool {
+	if amount < 0 {
+		amount = -amount
+	}
+	return threshold > 0 && amount > threshold
+}
+
+// Adjust records a manual adjustment. Small ones are applied at once with an
+// ADJUSTMENT ledger line; those above the approval threshold wait in
+// PENDING_APPROVAL for another admin. Debits may take the balance below
+// zero, as fees do.
+// Business rules:
+// - Amount must not be zero and a reason is required (400)
+// - User must exist (404)
+func (s *service) Adjust(ctx context.Context, adminID int64, req AdjustReq) (adj *model.WalletAdjustment, err error) {
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Amount == 0 {
+		return nil, echo.NewHTTPError(400, echo.Map{"message": "amount must not be zero"})
+	}
+	if req.Reason == "" {
+		return nil, echo.NewHTTPError(400, echo.Map{"message": "reason is required"})
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	bal, err := s.r.GetUserBalanceForUpdate(ctx, tx, req.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, echo.NewHTTPError(404, echo.Map{"message": "user not found"})
+	}
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("lock balance: %v", err)})
+	}
+
+	adj = &model.WalletAdjustment{
+		UserID:      req.UserID,
+		Amount:      req.Amount,
+		Reason:      req.Reason,
+		Status:      model.AdjustmentApplied,
+		RequestedBy: adminID,
+	}
+	if needsApproval(req.Amount, s.cfg.AdjustApprovalOver) {
+		adj.Status = model.AdjustmentPending
+	}
+	if _, err = s.r.InsertAdjustment(ctx, tx, adj); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("insert adjustment: %v", err)})
+	}
+	if adj.Status == model.AdjustmentApplied {
+		if err = s.post(ctx, tx, adj.UserID, "wallet_adjustments", adj.ID, model.LedgerAdjust, adj.Amount, bal); err != nil {
+			return nil, echo.NewHTTPError(500, echo.Map{"message": err.Error()})
+		}
+	}
+	return adj, nil
+}
+
+// ApproveAdjustment applies an adjustment that was waiting for approval.
+// Business rules:
+// - Adjustment must exist (404) and be PENDING_APPROVAL (409)
+// - The approver must not be the admin who asked for it (403)
+func (s *service) ApproveAdjustment(ctx context.Context, adminID, adjustmentID int64) (adj *model.WalletAdjustment, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	if adj, err = s.lockPendingAdjustment(ctx, tx, adjustmentID); err != nil {
+		return nil, err
+	}
+	if adj.RequestedBy == adminID {
+		return nil, echo.NewHTTPError(403, echo.Map{"message": "a second admin must approve this adjustment"})
+	}
+	bal, err := s.r.GetUserBalanceForUpdate(ctx, tx, adj.UserID)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("lock balance: %v", err)})
+	}
+	if err = s.post(ctx, tx, adj.UserID, "wallet_adjustments", adj.ID, model.LedgerAdjust, adj.Amount, bal); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": err.Error()})
+	}
+	if err = s.r.DecideAdjustment(ctx, tx, adj, model.AdjustmentApplied, adminID); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("approve adjustment: %v", err)})
+	}
+	return adj, nil
+}
+
+// RejectAdjustment drops an adjustment that was waiting for approval. The
+// requesting admin may withdraw their own.
+// Business rules:
+// - Adjustment must exist (404) and be PENDING_APPROVAL (409)
+func (s *service) RejectAdjustment(ctx context.Context, adminID, adjustmentID int64) (adj *model.WalletAdjustment, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	if adj, err = s.lockPendingAdjustment(ctx, tx, adjustmentID); err != nil {
+		return nil, err
+	}
+	if err = s.r.DecideAdjustment(ctx, tx, adj, model.AdjustmentRejected, adminID); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("reject adjustment: %v", err)})
+	}
+	return adj, nil
+}
+
+func (s *service) lockPendingAdjustment(ctx context.Context, tx *sql.Tx, id int64) (*model.WalletAdjustment, error) {
+	adj, err := s.r.LockAdjustment(ctx, tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, echo.NewHTTPError(404, echo.Map{"message": "adjustment not found"})
+	}
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("lock adjustment: %v", err)})
+	}
+	if adj.Status != model.AdjustmentPending {
+		return nil, echo.NewHTTPError(409, echo.Map{"message": fmt.Sprintf("adjustment is already %s", adj.Status)})
+	}
+	return adj, nil
+}
+
+// Adjustments lists adjustments, newest first, optionally by status.
+func (s *service) Adjustments(ctx context.Context, status model.AdjustmentStatus) ([]model.WalletAdjustment, error) {
+	return s.r.ListAdjustments(ctx, status)
+}
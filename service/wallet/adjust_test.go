@@ -0,0 +1,192 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"bookrental/model"
+	"bookrental/util/sqlstub"
+)
+
+func TestNeedsApproval(t *testing.T) {
+	cases := []struct {
+		amount, threshold model.Money
+		want              bool
+	}{
+		{model.Units(50), 0, false}, // approval off
+		{model.Units(50), model.Units(100), false},
+		{model.Units(100), model.Units(100), false}, // at the threshold is fine
+		{model.Units(100) + 1, model.Units(100), true},
+		{-model.Units(150), model.Units(100), true}, // debits count by size
+		{-model.Units(50), model.Units(100), false},
+	}
+	for _, c := range cases {
+		if got := needsApproval(c.amount, c.threshold); got != c.want {
+			t.Errorf("needsApproval(%s, %s) = %v; want %v", c.amount, c.threshold, got, c.want)
+		}
+	}
+}
+
+// ledgerPost is one InsertLedger call.
+type ledgerPost struct {
+	userID   int64
+	refTable string
+	refID    int64
+	entry    model.LedgerType
+	amount   model.Money
+}
+
+// adjustRepo keeps balances, adjustments and ledger lines in memory;
+// anything else panics.
+type adjustRepo struct {
+	Repo
+	bal         map[int64]model.Money
+	adjustments map[int64]*model.WalletAdjustment
+	ledger      []ledgerPost
+}
+
+func newAdjustRepo() *adjustRepo {
+	return &adjustRepo{
+		bal:         map[int64]model.Money{7: model.Units(100)},
+		adjustments: map[int64]*model.WalletAdjustment{},
+	}
+}
+
+func (m *adjustRepo) GetUserBalanceForUpdate(_ context.Context, _ *sql.Tx, userID int64) (model.Money, error) {
+	bal, ok := m.bal[userID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return bal, nil
+}
+func (m *adjustRepo) UpdateUserBalance(_ context.Context, _ *sql.Tx, userID int64, bal model.Money) error {
+	m.bal[userID] = bal
+	return nil
+}
+func (m *adjustRepo) InsertLedger(_ context.Context, _ *sql.Tx, userID int64, refTable string, refID *int64, entry string, amount, _ model.Money) error {
+	m.ledger = append(m.ledger, ledgerPost{userID, refTable, *refID, model.LedgerType(entry), amount})
+	return nil
+}
+
+func (m *adjustRepo) InsertAdjustment(_ context.Context, _ *sql.Tx, a *model.WalletAdjustment) (int64, error) {
+	a.ID = int64(len(m.adjustments) + 1)
+	cp := *a
+	m.adjustments[a.ID] = &cp
+	return a.ID, nil
+}
+func (m *adjustRepo) LockAdjustment(_ context.Context, _ *sql.Tx, id int64) (*model.WalletAdjustment, error) {
+	a, ok := m.adjustments[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	cp := *a
+	return &cp, nil
+}
+func (m *adjustRepo) DecideAdjustment(_ context.Context, _ *sql.Tx, a *model.WalletAdjustment, status model.AdjustmentStatus, adminID int64) error {
+	a.Status, a.DecidedBy = status, &adminID
+	cp := *a
+	m.adjustments[a.ID] = &cp
+	return nil
+}
+
+func adjustService(threshold model.Money) (*service, *adjustRepo, *sqlstub.DB) {
+	m, db := newAdjustRepo(), sqlstub.New()
+	return &service{db: db.DB, r: m, cfg: Config{AdjustApprovalOver: threshold}}, m, db
+}
+
+func TestAdjustPostsLedgerLine(t *testing.T) {
+	s, m, db := adjustService(model.Units(100))
+
+	adj, err := s.Adjust(context.Background(), 1, AdjustReq{UserID: 7, Amount: -model.Units(30), Reason: " damaged cover "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adj.Status != model.AdjustmentApplied || adj.Reason != "damaged cover" || adj.RequestedBy != 1 {
+		t.Errorf("adjustment %+v; want APPLIED with the trimmed reason", adj)
+	}
+	want := ledgerPost{7, "wallet_adjustments", adj.ID, model.LedgerAdjust, -model.Units(30)}
+	if len(m.ledger) != 1 || m.ledger[0] != want {
+		t.Errorf("ledger %+v; want %+v", m.ledger, want)
+	}
+	if m.bal[7] != model.Units(70) || db.Commits() != 1 {
+		t.Errorf("balance %s, commits %d; want 70.00 committed", m.bal[7], db.Commits())
+	}
+
+	for _, req := range []AdjustReq{{UserID: 7, Reason: "x"}, {UserID: 7, Amount: 1, Reason: "  "}} {
+		if _, err := s.Adjust(context.Background(), 1, req); httpCode(err) != 400 {
+			t.Errorf("%+v: got %v; want 400", req, err)
+		}
+	}
+	if _, err := s.Adjust(context.Background(), 1, AdjustReq{UserID: 99, Amount: 1, Reason: "x"}); httpCode(err) != 404 {
+		t.Errorf("unknown user: got %v; want 404", err)
+	}
+}
+
+func TestAdjustOverThresholdWaitsForApproval(t *testing.T) {
+	s, m, _ := adjustService(model.Units(100))
+
+	adj, err := s.Adjust(context.Background(), 1, AdjustReq{UserID: 7, Amount: model.Units(150), Reason: "goodwill"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adj.Status != model.AdjustmentPending || m.adjustments[adj.ID].Status != model.AdjustmentPending {
+		t.Errorf("status %s; want PENDING_APPROVAL", adj.Status)
+	}
+	if len(m.ledger) != 0 || m.bal[7] != model.Units(100) {
+		t.Errorf("ledger %+v, balance %s; want nothing posted yet", m.ledger, m.bal[7])
+	}
+
+	if _, err := s.ApproveAdjustment(context.Background(), 1, adj.ID); httpCode(err) != 403 {
+		t.Fatalf("self-approval: got %v; want 403", err)
+	}
+	if m.adjustments[adj.ID].Status != model.AdjustmentPending || len(m.ledger) != 0 {
+		t.Errorf("self-approval changed status to %s with ledger %+v", m.adjustments[adj.ID].Status, m.ledger)
+	}
+
+	approved, err := s.ApproveAdjustment(context.Background(), 2, adj.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.Status != model.AdjustmentApplied || *approved.DecidedBy != 2 {
+		t.Errorf("adjustment %+v; want APPLIED by admin 2", approved)
+	}
+	want := ledgerPost{7, "wallet_adjustments", adj.ID, model.LedgerAdjust, model.Units(150)}
+	if len(m.ledger) != 1 || m.ledger[0] != want || m.bal[7] != model.Units(250) {
+		t.Errorf("ledger %+v, balance %s; want %+v and 250.00", m.ledger, m.bal[7], want)
+	}
+}
+
+func TestDecidedAdjustmentConflicts(t *testing.T) {
+	ctx := context.Background()
+	s, m, _ := adjustService(model.Units(100))
+	var ids []int64
+	for i := 0; i < 2; i++ {
+		adj, err := s.Adjust(ctx, 1, AdjustReq{UserID: 7, Amount: model.Units(500), Reason: "refund"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, adj.ID)
+	}
+	if _, err := s.ApproveAdjustment(ctx, 2, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RejectAdjustment(ctx, 1, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range ids {
+		if _, err := s.ApproveAdjustment(ctx, 2, id); httpCode(err) != 409 {
+			t.Errorf("approve %s adjustment: got %v; want 409", m.adjustments[id].Status, err)
+		}
+		if _, err := s.RejectAdjustment(ctx, 2, id); httpCode(err) != 409 {
+			t.Errorf("reject %s adjustment: got %v; want 409", m.adjustments[id].Status, err)
+		}
+	}
+	if len(m.ledger) != 1 || m.bal[7] != model.Units(600) {
+		t.Errorf("ledger %+v, balance %s; want only the approved adjustment posted", m.ledger, m.bal[7])
+	}
+	if _, err := s.ApproveAdjustment(ctx, 2, 99); httpCode(err) != 404 {
+		t.Errorf("unknown adjustment: got %v; want 404", err)
+	}
+}
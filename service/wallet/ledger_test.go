@@ -0,0 +1,144 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"bookrental/model"
+	wrepo "bookrental/repository/wallet"
+)
+
+// ledgerRepo serves rows newest first the way ListLedger pages them and
+// records what Ledger asked for; anything else panics.
+type ledgerRepo struct {
+	Repo
+	rows     []LedgerRow // ids descending
+	filters  []wrepo.LedgerFilter
+	from, to *time.Time
+	balErr   error
+}
+
+func (m *ledgerRepo) ListLedger(_ context.Context, f wrepo.LedgerFilter) ([]LedgerRow, error) {
+	m.filters = append(m.filters, f)
+	var out []LedgerRow
+	for _, r := range m.rows {
+		if f.Before > 0 && r.ID >= f.Before {
+			continue
+		}
+		if len(out) == f.Limit {
+			break
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func (m *ledgerRepo) PeriodBalances(_ context.Context, _ int64, from, to *time.Time) (model.Money, model.Money, error) {
+	m.from, m.to = from, to
+	return 1000, 2500, m.balErr
+}
+
+func ledgerRows(n int) []LedgerRow {
+	rows := make([]LedgerRow, n)
+	for i := range rows {
+		rows[i] = LedgerRow{ID: int64(n - i), EntryType: "TOPUP_CONFIRMED", Amount: 100}
+	}
+	return rows
+}
+
+func ids(rows []LedgerRow) []int64 {
+	out := make([]int64, len(rows))
+	for i, r := range rows {
+		out[i] = r.ID
+	}
+	return out
+}
+
+func TestLedgerCursorWalksPages(t *testing.T) {
+	m := &ledgerRepo{rows: ledgerRows(5)}
+	s := &service{r: m}
+
+	var (
+		got    [][]int64
+		cursor int64
+	)
+	for i := 0; i < 5; i++ {
+		page, err := s.Ledger(context.Background(), 1, LedgerQuery{Cursor: cursor, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, ids(page.Data))
+		if page.NextCursor == nil {
+			break
+		}
+		if *page.NextCursor != page.Data[len(page.Data)-1].ID {
+			t.Errorf("page %d: next_cursor %d; want the last row's id", i, *page.NextCursor)
+		}
+		cursor = *page.NextCursor
+	}
+	want := [][]int64{{5, 4}, {3, 2}, {1}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("pages %v; want %v", got, want)
+	}
+	if m.filters[0].Limit != 3 {
+		t.Errorf("asked for %d rows; want limit+1 to detect a next page", m.filters[0].Limit)
+	}
+}
+
+func TestLedgerFullLastPageHasNoCursor(t *testing.T) {
+	s := &service{r: &ledgerRepo{rows: ledgerRows(4)}}
+	page, err := s.Ledger(context.Background(), 1, LedgerQuery{Cursor: 3, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Data) != 2 || page.NextCursor != nil {
+		t.Errorf("got %v, cursor %v; want [2 1] and no cursor", ids(page.Data), page.NextCursor)
+	}
+}
+
+func TestLedgerLimits(t *testing.T) {
+	cases := map[int]int{0: defaultLedgerPage + 1, -3: defaultLedgerPage + 1, 10: 11, 5000: maxLedgerPage + 1}
+	for limit, want := range cases {
+		m := &ledgerRepo{}
+		s := &service{r: m}
+		page, err := s.Ledger(context.Background(), 1, LedgerQuery{Limit: limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.filters[0].Limit != want {
+			t.Errorf("limit %d: asked for %d rows; want %d", limit, m.filters[0].Limit, want)
+		}
+		if page.Data == nil || len(page.Data) != 0 || page.NextCursor != nil {
+			t.Errorf("limit %d: empty ledger gave %v, cursor %v; want [] and no cursor", limit, page.Data, page.NextCursor)
+		}
+	}
+}
+
+func TestLedgerPeriodBalances(t *testing.T) {
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	m := &ledgerRepo{rows: ledgerRows(3)}
+	s := &service{r: m}
+
+	page, err := s.Ledger(context.Background(), 1, LedgerQuery{EntryType: "RENTAL_CHARGE", From: &from, To: &to})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.OpeningBalance != 1000 || page.ClosingBalance != 2500 {
+		t.Errorf("balances %s..%s; want 10.00..25.00", page.OpeningBalance, page.ClosingBalance)
+	}
+	if m.from != &from || m.to != &to {
+		t.Errorf("balances asked for %v..%v; want the query's period", m.from, m.to)
+	}
+	if f := m.filters[0]; f.EntryType != "RENTAL_CHARGE" || f.From != &from || f.To != &to {
+		t.Errorf("filter %+v; want the query's entry type and period", f)
+	}
+
+	m.balErr = errors.New("boom")
+	if _, err := s.Ledger(context.Background(), 1, LedgerQuery{}); !errors.Is(err, m.balErr) {
+		t.Errorf("got %v; want the balances error", err)
+	}
+}
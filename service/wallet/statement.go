@@ -0,0 +1,142 @@
+package wallet
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"bookrental/model"
+	"bookrental/util/pdf"
+)
+
+// Statement is one calendar month (UTC) of a user's wallet ledger.
+type Statement struct {
+	UserID    int64
+	Month     time.Time // first instant of the month
+	Opening   model.Money
+	Closing   model.Money
+	Lines     []LedgerRow // oldest first
+	Subtotals []Subtotal  // by entry type, alphabetical
+}
+
+// Subtotal sums the statement lines of one entry type.
+type Subtotal struct {
+	EntryType string
+	Count     int
+	Total     model.Money
+}
+
+// Statement builds the statement for the month containing month.
+func (s *service) Statement(ctx context.Context, userID int64, month time.Time) (*Statement, error) {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	lines, err := s.r.ListLedgerPeriod(ctx, userID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("list ledger: %w", err)
+	}
+	opening, closing, err := s.r.PeriodBalances(ctx, userID, &from, &to)
+	if err != nil {
+		return nil, fmt.Errorf("period balances: %w", err)
+	}
+	return &Statement{
+		UserID:    userID,
+		Month:     from,
+		Opening:   opening,
+		Closing:   closing,
+		Lines:     lines,
+		Subtotals: subtotals(lines),
+	}, nil
+}
+
+func subtotals(lines []LedgerRow) []Subtotal {
+	byType := map[string]*Subtotal{}
+	for _, l := range lines {
+		st, ok := byType[l.EntryType]
+		if !ok {
+			st = &Subtotal{EntryType: l.EntryType}
+			byType[l.EntryType] = st
+		}
+		st.Count++
+		st.Total += l.Amount
+	}
+	out := make([]Subtotal, 0, len(byType))
+	for _, st := range byType {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].EntryType < out[j].EntryType })
+	return out
+}
+
+// Filename is the suggested download name, e.g. "statement-2025-03.csv".
+func (st *Statement) Filename(ext string) string {
+	return fmt.Sprintf("statement-%s.%s", st.Month.Format("2006-01"), ext)
+}
+
+func (st *Statement) lastDay() time.Time { return st.Month.AddDate(0, 1, -1) }
+
+// WriteCSV writes the statement as one table. The first column says what
+// each row is: opening, line, subtotal or closing.
+func (st *Statement) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	rows := [][]string{
+		{"section", "date", "ledger_id", "entry_type", "ref_table", "ref_id", "count", "amount", "balance_after"},
+		{"opening", st.Month.Format(time.DateOnly), "", "", "", "", "", "", st.Opening.String()},
+	}
+	for _, l := range st.Lines {
+		refID := ""
+		if l.RefID != nil {
+			refID = strconv.FormatInt(*l.RefID, 10)
+		}
+		rows = append(rows, []string{
+			"line", l.CreatedAt.UTC().Format(time.RFC3339), strconv.FormatInt(l.ID, 10),
+			l.EntryType, l.RefTable, refID, "", l.Amount.String(), l.BalanceAfter.String(),
+		})
+	}
+	for _, s := range st.Subtotals {
+		rows = append(rows, []string{"subtotal", "", "", s.EntryType, "", "", strconv.Itoa(s.Count), s.Total.String(), ""})
+	}
+	rows = append(rows, []string{"closing", st.lastDay().Format(time.DateOnly), "", "", "", "", "", "", st.Closing.String()})
+
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// PDF renders the statement as a text PDF.
+func (st *Statement) PDF() []byte {
+	d := pdf.New()
+	d.Bold(fmt.Sprintf("Wallet statement %s", st.Month.Format("January 2006")))
+	d.Text(fmt.Sprintf("Account #%d", st.UserID))
+	d.Text(fmt.Sprintf("Period %s to %s (UTC)", st.Month.Format(time.DateOnly), st.lastDay().Format(time.DateOnly)))
+	d.Blank()
+	d.Text(fmt.Sprintf("%-40s %14s", "Opening balance", st.Opening))
+	d.Blank()
+
+	const row = "%-16s %-18s %-16s %14s %14s"
+	d.Bold(fmt.Sprintf(row, "Date", "Type", "Reference", "Amount", "Balance"))
+	if len(st.Lines) == 0 {
+		d.Text("No activity this month.")
+	}
+	for _, l := range st.Lines {
+		ref := l.RefTable
+		if l.RefID != nil {
+			ref = fmt.Sprintf("%s #%d", l.RefTable, *l.RefID)
+		}
+		d.Text(fmt.Sprintf(row, l.CreatedAt.UTC().Format("2006-01-02 15:04"), l.EntryType, ref, l.Amount, l.BalanceAfter))
+	}
+	d.Blank()
+
+	d.Bold("Subtotals")
+	for _, s := range st.Subtotals {
+		d.Text(fmt.Sprintf("%-32s %7d %14s", s.EntryType, s.Count, s.Total))
+	}
+	d.Blank()
+	d.Bold(fmt.Sprintf("%-40s %14s", "Closing balance", st.Closing))
+	return d.Bytes()
+}
@@ -0,0 +1,82 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+)
+
+func testStatement() *Statement {
+	at := time.Date(2025, 3, 4, 10, 0, 0, 0, time.UTC)
+	rental, topup := int64(7), int64(3)
+	return &Statement{
+		UserID:  42,
+		Month:   time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		Opening: 10000,
+		Closing: 12500,
+		Lines: []LedgerRow{
+			{ID: 1, EntryType: "TOPUP_CONFIRMED", RefTable: "wallet_topups", RefID: &topup, Amount: 5000, BalanceAfter: 15000, CreatedAt: at},
+			{ID: 2, EntryType: "RENTAL_CHARGE", RefTable: "rentals", RefID: &rental, Amount: -2000, BalanceAfter: 13000, CreatedAt: at.Add(time.Hour)},
+			{ID: 3, EntryType: "RENTAL_CHARGE", RefTable: "rentals", RefID: &rental, Amount: -500, BalanceAfter: 12500, CreatedAt: at.Add(2 * time.Hour)},
+		},
+	}
+}
+
+func TestSubtotalsByType(t *testing.T) {
+	got := subtotals(testStatement().Lines)
+	if len(got) != 2 {
+		t.Fatalf("got %d subtotals; want 2", len(got))
+	}
+	if got[0].EntryType != "RENTAL_CHARGE" || got[0].Count != 2 || got[0].Total != -2500 {
+		t.Errorf("charges: got %+v", got[0])
+	}
+	if got[1].EntryType != "TOPUP_CONFIRMED" || got[1].Count != 1 || got[1].Total != 5000 {
+		t.Errorf("topups: got %+v", got[1])
+	}
+}
+
+func TestStatementCSV(t *testing.T) {
+	st := testStatement()
+	st.Subtotals = subtotals(st.Lines)
+
+	var buf bytes.Buffer
+	if err := st.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid csv: %v", err)
+	}
+	// header, opening, 3 lines, 2 subtotals, closing
+	if len(rows) != 8 {
+		t.Fatalf("got %d rows; want 8", len(rows))
+	}
+	if rows[1][0] != "opening" || rows[1][8] != "100.00" {
+		t.Errorf("opening row: %v", rows[1])
+	}
+	if rows[3][3] != "RENTAL_CHARGE" || rows[3][5] != "7" || rows[3][7] != "-20.00" {
+		t.Errorf("line row: %v", rows[3])
+	}
+	if rows[5][0] != "subtotal" || rows[5][7] != "-25.00" {
+		t.Errorf("subtotal row: %v", rows[5])
+	}
+	if last := rows[7]; last[0] != "closing" || last[1] != "2025-03-31" || last[8] != "125.00" {
+		t.Errorf("closing row: %v", last)
+	}
+}
+
+func TestStatementPDF(t *testing.T) {
+	st := testStatement()
+	st.Subtotals = subtotals(st.Lines)
+
+	b := st.PDF()
+	if !bytes.HasPrefix(b, []byte("%PDF-1.4")) || !bytes.HasSuffix(b, []byte("%%EOF\n")) {
+		t.Fatal("not a PDF")
+	}
+	for _, want := range []string{"Wallet statement March 2025", "rentals #7", "Closing balance"} {
+		if !bytes.Contains(b, []byte(want)) {
+			t.Errorf("PDF missing %q", want)
+		}
+	}
+}
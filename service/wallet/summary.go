@@ -0,0 +1,44 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+
+	"bookrental/model"
+)
+
+// Pending is money that is expected but not yet on the balance, or
+// committed but not yet taken from it.
+type Pending struct {
+	Count  int         `json:"count"`
+	Amount model.Money `json:"amount"`
+}
+
+// Summary is the user's wallet at a glance.
+type Summary struct {
+	Balance       model.Money            `json:"balance"`
+	PendingTopups Pending                `json:"pending_topups"`
+	Held          Pending                `json:"held_for_bookings"`
+	Lifetime      map[string]model.Money `json:"lifetime_totals"`
+}
+
+// Summary reads the balance together with top-ups awaiting payment, the
+// cost of BOOKED rentals not yet charged, and the signed lifetime sum of
+// each ledger type.
+func (s *service) Summary(ctx context.Context, userID int64) (*Summary, error) {
+	bal, err := s.r.GetBalance(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("balance: %w", err)
+	}
+	sum := &Summary{Balance: bal}
+	if sum.PendingTopups.Count, sum.PendingTopups.Amount, err = s.r.PendingTopups(ctx, userID); err != nil {
+		return nil, fmt.Errorf("pending topups: %w", err)
+	}
+	if sum.Held.Count, sum.Held.Amount, err = s.r.HeldForBookings(ctx, userID); err != nil {
+		return nil, fmt.Errorf("held for bookings: %w", err)
+	}
+	if sum.Lifetime, err = s.r.LedgerTotals(ctx, userID); err != nil {
+		return nil, fmt.Errorf("ledger totals: %w", err)
+	}
+	return sum, nil
+}
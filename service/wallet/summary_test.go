@@ -0,0 +1,56 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"bookrental/model"
+)
+
+// summaryRepo stubs the reads Summary makes; anything else panics.
+type summaryRepo struct {
+	Repo
+	balErr error
+}
+
+func (m *summaryRepo) GetBalance(context.Context, int64) (model.Money, error) {
+	return 15000, m.balErr
+}
+func (m *summaryRepo) PendingTopups(context.Context, int64) (int, model.Money, error) {
+	return 2, 7500, nil
+}
+func (m *summaryRepo) HeldForBookings(context.Context, int64) (int, model.Money, error) {
+	return 1, 2000, nil
+}
+func (m *summaryRepo) LedgerTotals(context.Context, int64) (map[string]model.Money, error) {
+	return map[string]model.Money{"TOPUP_CONFIRMED": 20000, "RENTAL_CHARGE": -5000}, nil
+}
+
+func TestSummary(t *testing.T) {
+	s := &service{r: &summaryRepo{}}
+	got, err := s.Summary(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Balance != 15000 {
+		t.Errorf("balance: got %s", got.Balance)
+	}
+	if got.PendingTopups != (Pending{Count: 2, Amount: 7500}) {
+		t.Errorf("pending topups: got %+v", got.PendingTopups)
+	}
+	if got.Held != (Pending{Count: 1, Amount: 2000}) {
+		t.Errorf("held: got %+v", got.Held)
+	}
+	if got.Lifetime["RENTAL_CHARGE"] != -5000 {
+		t.Errorf("lifetime totals: got %v", got.Lifetime)
+	}
+}
+
+func TestSummaryUnknownUser(t *testing.T) {
+	s := &service{r: &summaryRepo{balErr: sql.ErrNoRows}}
+	if _, err := s.Summary(context.Background(), 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("got %v; want sql.ErrNoRows", err)
+	}
+}
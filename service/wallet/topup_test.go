@@ -0,0 +1,40 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"bookrental/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+type topupRepo struct {
+	Repo
+	topups map[int64]*model.WalletTopup
+}
+
+func (m *topupRepo) GetTopup(_ context.Context, id int64) (*model.WalletTopup, error) {
+	if t, ok := m.topups[id]; ok {
+		return t, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func TestTopupOnlyVisibleToOwner(t *testing.T) {
+	s := &service{r: &topupRepo{topups: map[int64]*model.WalletTopup{
+		5: {ID: 5, UserID: 1, Status: model.TopupExpired},
+	}}}
+
+	got, err := s.Topup(context.Background(), 1, 5)
+	if err != nil || got.Status != model.TopupExpired {
+		t.Fatalf("owner: got %+v, %v", got, err)
+	}
+	for _, c := range []struct{ user, id int64 }{{2, 5}, {1, 6}} {
+		_, err := s.Topup(context.Background(), c.user, c.id)
+		if he, ok := err.(*echo.HTTPError); !ok || he.Code != 404 {
+			t.Errorf("user %d topup %d: got %v; want 404", c.user, c.id, err)
+		}
+	}
+}
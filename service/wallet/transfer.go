@@ -0,0 +1,139 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bookrental/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TransferReq gifts balance to another member, found by username.
+type TransferReq struct {
+	ToUsername string
+	Amount     model.Money
+	Note       string
+}
+
+// Recipient is what a sender may see of another member before paying them.
+type Recipient struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// FindRecipient looks a member up by exact username.
+func (s *service) FindRecipient(ctx context.Context, username string) (*Recipient, error) {
+	username = strings.TrimSpace(username)
+	id, err := s.r.UserIDByUsername(ctx, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, echo.NewHTTPError(404, echo.Map{"message": "no member with that username"})
+	}
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("find user: %v", err)})
+	}
+	return &Recipient{ID: id, Username: username}, nil
+}
+
+// Transfer moves balance from one member to another in one transaction:
+// a TRANSFER_OUT line for the sender and a TRANSFER_IN line for the
+// recipient, both referencing the wallet_transfers row.
+// Business rules:
+// - Amount must be positive and the recipient someone else (400)
+// - Recipient must exist (404)
+// - Sender's balance must cover the amount (402)
+// - Sender stays within the rolling 24h transfer limit (422)
+func (s *service) Transfer(ctx context.Context, fromID int64, req TransferReq) (t *model.WalletTransfer, err error) {
+	if req.Amount <= 0 {
+		return nil, echo.NewHTTPError(400, echo.Map{"message": "amount must be positive"})
+	}
+	to, err := s.FindRecipient(ctx, req.ToUsername)
+	if err != nil {
+		return nil, err
+	}
+	if to.ID == fromID {
+		return nil, echo.NewHTTPError(400, echo.Map{"message": "cannot transfer to yourself"})
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	// Always lock the lower id first so two opposite transfers between the
+	// same pair cannot deadlock.
+	bal := map[int64]model.Money{}
+	for _, id := range lockOrder(fromID, to.ID) {
+		if bal[id], err = s.r.GetUserBalanceForUpdate(ctx, tx, id); err != nil {
+			return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("lock balance: %v", err)})
+		}
+	}
+
+	if bal[fromID] < req.Amount {
+		return nil, echo.NewHTTPError(402, echo.Map{"message": "insufficient balance", "balance": bal[fromID]})
+	}
+	sent, err := s.r.TransferredSince(ctx, tx, fromID, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("transfer total: %v", err)})
+	}
+	if err = checkTransferLimit(s.cfg.TransferDailyLimit, sent, req.Amount); err != nil {
+		return nil, err
+	}
+
+	t = &model.WalletTransfer{
+		FromUserID: fromID,
+		ToUserID:   to.ID,
+		Amount:     req.Amount,
+		Note:       strings.TrimSpace(req.Note),
+	}
+	if _, err = s.r.InsertTransfer(ctx, tx, t); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("insert transfer: %v", err)})
+	}
+	if err = s.post(ctx, tx, fromID, "wallet_transfers", t.ID, model.LedgerTransferOut, -t.Amount, bal[fromID]); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": err.Error()})
+	}
+	if err = s.post(ctx, tx, to.ID, "wallet_transfers", t.ID, model.LedgerTransferIn, t.Amount, bal[to.ID]); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": err.Error()})
+	}
+	return t, nil
+}
+
+// Transfers lists transfers the user sent or received, newest first.
+func (s *service) Transfers(ctx context.Context, userID int64) ([]model.WalletTransfer, error) {
+	return s.r.ListTransfers(ctx, userID)
+}
+
+func lockOrder(a, b int64) []int64 {
+	if a < b {
+		return []int64{a, b}
+	}
+	return []int64{b, a}
+}
+
+// checkTransferLimit rejects amount when it would take the sender past
+// limit within the window that already holds sent. limit <= 0 is unlimited.
+func checkTransferLimit(limit, sent, amount model.Money) error {
+	if limit <= 0 || sent+amount <= limit {
+		return nil
+	}
+	remaining := limit - sent
+	if remaining < 0 {
+		remaining = 0
+	}
+	return echo.NewHTTPError(422, echo.Map{
+		"message":   "daily transfer limit reached",
+		"limit":     limit,
+		"remaining": remaining,
+	})
+}
@@ -0,0 +1,151 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"bookrental/model"
+	"bookrental/util/sqlstub"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestLockOrder(t *testing.T) {
+	if got := lockOrder(9, 4); got[0] != 4 || got[1] != 9 {
+		t.Errorf("lockOrder(9, 4) = %v; want [4 9]", got)
+	}
+	if got := lockOrder(4, 9); got[0] != 4 || got[1] != 9 {
+		t.Errorf("lockOrder(4, 9) = %v; want [4 9]", got)
+	}
+}
+
+func TestCheckTransferLimit(t *testing.T) {
+	limit := model.Units(100)
+	if err := checkTransferLimit(limit, model.Units(60), model.Units(40)); err != nil {
+		t.Errorf("exactly at the limit: got %v", err)
+	}
+	if err := checkTransferLimit(0, model.Units(1000), model.Units(1000)); err != nil {
+		t.Errorf("no limit configured: got %v", err)
+	}
+
+	err := checkTransferLimit(limit, model.Units(60), model.Units(41))
+	he, ok := err.(*echo.HTTPError)
+	if !ok || he.Code != 422 {
+		t.Fatalf("over the limit: got %v; want 422", err)
+	}
+	if rem := he.Message.(echo.Map)["remaining"]; rem != model.Units(40) {
+		t.Errorf("remaining = %v; want 40.00", rem)
+	}
+}
+
+// transferRepo knows members by username, keeps their balances and records
+// the order balances were locked in; anything else panics.
+type transferRepo struct {
+	Repo
+	users     map[string]int64
+	bal       map[int64]model.Money
+	locked    []int64
+	sent      model.Money
+	transfers []model.WalletTransfer
+	ledger    []ledgerPost
+}
+
+func newTransferRepo() *transferRepo {
+	return &transferRepo{
+		users: map[string]int64{"ana": 9, "bo": 4},
+		bal:   map[int64]model.Money{9: model.Units(100), 4: model.Units(10)},
+	}
+}
+
+func (m *transferRepo) UserIDByUsername(_ context.Context, username string) (int64, error) {
+	id, ok := m.users[username]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return id, nil
+}
+func (m *transferRepo) GetUserBalanceForUpdate(_ context.Context, _ *sql.Tx, userID int64) (model.Money, error) {
+	m.locked = append(m.locked, userID)
+	return m.bal[userID], nil
+}
+func (m *transferRepo) UpdateUserBalance(_ context.Context, _ *sql.Tx, userID int64, bal model.Money) error {
+	m.bal[userID] = bal
+	return nil
+}
+func (m *transferRepo) InsertLedger(_ context.Context, _ *sql.Tx, userID int64, refTable string, refID *int64, entry string, amount, _ model.Money) error {
+	m.ledger = append(m.ledger, ledgerPost{userID, refTable, *refID, model.LedgerType(entry), amount})
+	return nil
+}
+func (m *transferRepo) TransferredSince(context.Context, *sql.Tx, int64, time.Time) (model.Money, error) {
+	return m.sent, nil
+}
+func (m *transferRepo) InsertTransfer(_ context.Context, _ *sql.Tx, t *model.WalletTransfer) (int64, error) {
+	t.ID = int64(len(m.transfers) + 1)
+	m.transfers = append(m.transfers, *t)
+	return t.ID, nil
+}
+
+func transferService(limit model.Money) (*service, *transferRepo, *sqlstub.DB) {
+	m, db := newTransferRepo(), sqlstub.New()
+	return &service{db: db.DB, r: m, cfg: Config{TransferDailyLimit: limit}}, m, db
+}
+
+func TestTransferPostsPairedLines(t *testing.T) {
+	for _, c := range []struct {
+		from int64
+		to   string
+	}{{9, "bo"}, {4, "ana"}} {
+		s, m, db := transferService(0)
+		m.bal[4] = model.Units(100)
+
+		tr, err := s.Transfer(context.Background(), c.from, TransferReq{ToUsername: " " + c.to + " ", Amount: model.Units(30), Note: " thanks "})
+		if err != nil {
+			t.Fatal(err)
+		}
+		to := m.users[c.to]
+		if tr.FromUserID != c.from || tr.ToUserID != to || tr.Note != "thanks" {
+			t.Errorf("transfer %+v; want %d → %d with the trimmed note", tr, c.from, to)
+		}
+		want := []ledgerPost{
+			{c.from, "wallet_transfers", tr.ID, model.LedgerTransferOut, -model.Units(30)},
+			{to, "wallet_transfers", tr.ID, model.LedgerTransferIn, model.Units(30)},
+		}
+		if len(m.ledger) != 2 || m.ledger[0] != want[0] || m.ledger[1] != want[1] {
+			t.Errorf("ledger %+v; want %+v", m.ledger, want)
+		}
+		if m.bal[c.from] != model.Units(70) || m.bal[to] != model.Units(130) || db.Commits() != 1 {
+			t.Errorf("balances %v, commits %d; want 70.00 / 130.00 committed", m.bal, db.Commits())
+		}
+		if len(m.locked) != 2 || m.locked[0] != 4 || m.locked[1] != 9 {
+			t.Errorf("%d → %d locked %v; want the lower id first, [4 9]", c.from, to, m.locked)
+		}
+	}
+}
+
+func TestTransferRefusals(t *testing.T) {
+	cases := []struct {
+		name  string
+		from  int64
+		req   TransferReq
+		limit model.Money
+		code  int
+	}{
+		{"zero amount", 9, TransferReq{ToUsername: "bo"}, 0, 400},
+		{"to self", 9, TransferReq{ToUsername: "ana", Amount: 1}, 0, 400},
+		{"unknown recipient", 9, TransferReq{ToUsername: "cy", Amount: 1}, 0, 404},
+		{"insufficient balance", 4, TransferReq{ToUsername: "ana", Amount: model.Units(11)}, 0, 402},
+		{"over the daily limit", 9, TransferReq{ToUsername: "bo", Amount: model.Units(50)}, model.Units(40), 422},
+	}
+	for _, c := range cases {
+		s, m, _ := transferService(c.limit)
+
+		if _, err := s.Transfer(context.Background(), c.from, c.req); httpCode(err) != c.code {
+			t.Errorf("%s: got %v; want %d", c.name, err, c.code)
+		}
+		if len(m.transfers) != 0 || len(m.ledger) != 0 || m.bal[9] != model.Units(100) || m.bal[4] != model.Units(10) {
+			t.Errorf("%s: transfers %v, ledger %v, balances %v; want nothing moved", c.name, m.transfers, m.ledger, m.bal)
+		}
+	}
+}
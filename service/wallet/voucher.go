@@ -0,0 +1,238 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"bookrental/model"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/echo/v4"
+)
+
+// VoucherReq is a new promo code or top-up bonus campaign.
+type VoucherReq struct {
+	Code         string
+	Kind         model.VoucherKind
+	Amount       model.Money
+	Percent      int
+	MinTopup     model.Money
+	StartsAt     *time.Time
+	ExpiresAt    *time.Time
+	MaxUses      int
+	PerUserLimit int
+}
+
+// Redemption is what a redeemed code credited.
+type Redemption struct {
+	Code    string      `json:"code"`
+	Amount  model.Money `json:"amount"`
+	Balance model.Money `json:"balance"`
+}
+
+// CreateVoucher adds a code. Codes are stored upper-case and matched
+// case-insensitively.
+// Business rules:
+// - Amount must be positive, percent 0-100 and only on top-up bonuses (400)
+// - Per-user limit at least 1, max uses not negative (400)
+// - Expiry must be in the future and after the start (400)
+// - Code must be unused (409)
+func (s *service) CreateVoucher(ctx context.Context, adminID int64, req VoucherReq) (*model.Voucher, error) {
+	v := &model.Voucher{
+		Code:         normalizeCode(req.Code),
+		Kind:         req.Kind,
+		Amount:       req.Amount,
+		Percent:      req.Percent,
+		MinTopup:     req.MinTopup,
+		StartsAt:     time.Now(),
+		ExpiresAt:    req.ExpiresAt,
+		MaxUses:      req.MaxUses,
+		PerUserLimit: req.PerUserLimit,
+		CreatedBy:    adminID,
+	}
+	if req.StartsAt != nil {
+		v.StartsAt = *req.StartsAt
+	}
+	if v.PerUserLimit == 0 {
+		v.PerUserLimit = 1
+	}
+	if msg := validateVoucher(v, time.Now()); msg != "" {
+		return nil, echo.NewHTTPError(400, echo.Map{"message": msg})
+	}
+
+	if _, err := s.r.CreateVoucher(ctx, v); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+			return nil, echo.NewHTTPError(409, echo.Map{"message": "voucher code already exists"})
+		}
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("create voucher: %v", err)})
+	}
+	return v, nil
+}
+
+func validateVoucher(v *model.Voucher, now time.Time) string {
+	switch {
+	case v.Code == "":
+		return "code is required"
+	case v.Kind != model.VoucherCredit && v.Kind != model.VoucherTopupBonus:
+		return "kind must be CREDIT or TOPUP_BONUS"
+	case v.Amount <= 0:
+		return "amount must be positive"
+	case v.Percent < 0 || v.Percent > 100:
+		return "percent must be between 0 and 100"
+	case v.Percent > 0 && v.Kind != model.VoucherTopupBonus:
+		return "percent only applies to top-up bonuses"
+	case v.MinTopup < 0:
+		return "min_topup must not be negative"
+	case v.MaxUses < 0 || v.PerUserLimit < 1:
+		return "max_uses must be >= 0 and per_user_limit >= 1"
+	case v.ExpiresAt != nil && (!v.ExpiresAt.After(now) || !v.ExpiresAt.After(v.StartsAt)):
+		return "expires_at must be in the future and after starts_at"
+	}
+	return ""
+}
+
+func normalizeCode(code string) string { return strings.ToUpper(strings.TrimSpace(code)) }
+
+// Vouchers lists the most recent vouchers (admin).
+func (s *service) Vouchers(ctx context.Context) ([]model.Voucher, error) {
+	return s.r.ListVouchers(ctx)
+}
+
+// Redeem credits a CREDIT voucher to the user's balance with a
+// VOUCHER_CREDIT ledger line.
+// Business rules:
+// - Code must exist (404)
+// - Voucher must be a CREDIT code, active, started and not expired (409)
+// - Overall and per-user use caps must not be reached (409)
+func (s *service) Redeem(ctx context.Context, userID int64, code string) (rd *Redemption, err error) {
+	code = normalizeCode(code)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	v, err := s.r.LockVoucherByCode(ctx, tx, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, echo.NewHTTPError(404, echo.Map{"message": "unknown voucher code"})
+	}
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("lock voucher: %v", err)})
+	}
+	used, err := s.r.UserRedemptions(ctx, tx, v.ID, userID)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("count redemptions: %v", err)})
+	}
+	if msg := redeemable(v, used, time.Now()); msg != "" {
+		return nil, echo.NewHTTPError(409, echo.Map{"message": msg})
+	}
+
+	bal, err := s.r.GetUserBalanceForUpdate(ctx, tx, userID)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("lock balance: %v", err)})
+	}
+	claimed, err := s.r.ClaimVoucherUse(ctx, tx, v.ID)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("claim voucher: %v", err)})
+	}
+	if !claimed {
+		return nil, echo.NewHTTPError(409, echo.Map{"message": "voucher has been fully redeemed"})
+	}
+	rid, err := s.r.InsertRedemption(ctx, tx, v.ID, userID, v.Amount, nil)
+	if err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("insert redemption: %v", err)})
+	}
+	if err = s.post(ctx, tx, userID, "voucher_redemptions", rid, model.LedgerVoucher, v.Amount, bal); err != nil {
+		return nil, echo.NewHTTPError(500, echo.Map{"message": err.Error()})
+	}
+	return &Redemption{Code: v.Code, Amount: v.Amount, Balance: bal + v.Amount}, nil
+}
+
+// redeemable explains why the user cannot redeem v right now, or returns "".
+func redeemable(v *model.Voucher, usedByUser int, now time.Time) string {
+	switch {
+	case v.Kind != model.VoucherCredit:
+		return "this code applies automatically to qualifying top-ups"
+	case !v.Active:
+		return "voucher is no longer active"
+	case now.Before(v.StartsAt):
+		return "voucher is not valid yet"
+	case v.ExpiresAt != nil && !now.Before(*v.ExpiresAt):
+		return "voucher has expired"
+	case v.MaxUses > 0 && v.Uses >= v.MaxUses:
+		return "voucher has been fully redeemed"
+	case usedByUser >= v.PerUserLimit:
+		return "you have already redeemed this voucher"
+	}
+	return ""
+}
+
+// applyTopupBonuses credits every running bonus campaign the top-up
+// qualifies for. bal is the balance after the top-up itself; the user row
+// is locked in tx, which also serializes the per-user limit. Campaigns are
+// not locked: a use is taken with ClaimVoucherUse, and one that ran out in
+// the meantime is skipped.
+func (s *service) applyTopupBonuses(ctx context.Context, tx *sql.Tx, topupID, userID int64, topup, bal model.Money) error {
+	campaigns, err := s.r.ListTopupCampaigns(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("list campaigns: %w", err)
+	}
+	now := time.Now()
+	for i := range campaigns {
+		v := &campaigns[i]
+		if !bonusRunning(v, topup, now) {
+			continue
+		}
+		used, err := s.r.UserRedemptions(ctx, tx, v.ID, userID)
+		if err != nil {
+			return fmt.Errorf("count redemptions: %w", err)
+		}
+		if used >= v.PerUserLimit {
+			continue
+		}
+		claimed, err := s.r.ClaimVoucherUse(ctx, tx, v.ID)
+		if err != nil {
+			return fmt.Errorf("claim voucher %d: %w", v.ID, err)
+		}
+		if !claimed {
+			continue
+		}
+		bonus := v.TopupBonus(topup)
+		rid, err := s.r.InsertRedemption(ctx, tx, v.ID, userID, bonus, &topupID)
+		if err != nil {
+			return fmt.Errorf("insert redemption: %w", err)
+		}
+		if err := s.post(ctx, tx, userID, "voucher_redemptions", rid, model.LedgerTopupBonus, bonus, bal); err != nil {
+			return err
+		}
+		bal += bonus
+	}
+	return nil
+}
+
+// bonusRunning reports whether campaign v pays anything on a top-up of
+// amount right now. The overall cap is checked again when the use is claimed.
+func bonusRunning(v *model.Voucher, amount model.Money, now time.Time) bool {
+	switch {
+	case v.Kind != model.VoucherTopupBonus || !v.Active:
+		return false
+	case now.Before(v.StartsAt):
+		return false
+	case v.ExpiresAt != nil && !now.Before(*v.ExpiresAt):
+		return false
+	case v.MaxUses > 0 && v.Uses >= v.MaxUses:
+		return false
+	}
+	return v.TopupBonus(amount) > 0
+}
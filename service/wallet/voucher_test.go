@@ -0,0 +1,180 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"bookrental/model"
+	"bookrental/util/sqlstub"
+)
+
+func TestRedeemable(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	base := func() *model.Voucher {
+		return &model.Voucher{Kind: model.VoucherCredit, Active: true, StartsAt: past, PerUserLimit: 1, MaxUses: 10}
+	}
+
+	cases := []struct {
+		name  string
+		edit  func(v *model.Voucher)
+		used  int
+		allow bool
+	}{
+		{"ok", func(*model.Voucher) {}, 0, true},
+		{"bonus codes are not redeemable", func(v *model.Voucher) { v.Kind = model.VoucherTopupBonus }, 0, false},
+		{"inactive", func(v *model.Voucher) { v.Active = false }, 0, false},
+		{"not started", func(v *model.Voucher) { v.StartsAt = future }, 0, false},
+		{"expired", func(v *model.Voucher) { v.ExpiresAt = &now }, 0, false},
+		{"global cap reached", func(v *model.Voucher) { v.Uses = 10 }, 0, false},
+		{"no global cap", func(v *model.Voucher) { v.MaxUses, v.Uses = 0, 500 }, 0, true},
+		{"per-user cap reached", func(*model.Voucher) {}, 1, false},
+		{"per-user cap of two", func(v *model.Voucher) { v.PerUserLimit = 2 }, 1, true},
+	}
+	for _, c := range cases {
+		v := base()
+		c.edit(v)
+		if msg := redeemable(v, c.used, now); (msg == "") != c.allow {
+			t.Errorf("%s: got %q; allow=%v", c.name, msg, c.allow)
+		}
+	}
+}
+
+func TestTopupBonus(t *testing.T) {
+	flat := &model.Voucher{Kind: model.VoucherTopupBonus, Amount: model.Units(10), MinTopup: model.Units(100)}
+	if got := flat.TopupBonus(model.Units(99)); got != 0 {
+		t.Errorf("below minimum: got %s", got)
+	}
+	if got := flat.TopupBonus(model.Units(100)); got != model.Units(10) {
+		t.Errorf("flat bonus: got %s", got)
+	}
+
+	pct := &model.Voucher{Kind: model.VoucherTopupBonus, Amount: model.Units(25), Percent: 10}
+	if got := pct.TopupBonus(model.Units(120)); got != model.Units(12) {
+		t.Errorf("10%% of 120: got %s", got)
+	}
+	if got := pct.TopupBonus(model.Units(1000)); got != model.Units(25) {
+		t.Errorf("capped bonus: got %s", got)
+	}
+
+	credit := &model.Voucher{Kind: model.VoucherCredit, Amount: model.Units(10)}
+	if got := credit.TopupBonus(model.Units(100)); got != 0 {
+		t.Errorf("credit codes pay no bonus: got %s", got)
+	}
+}
+
+func TestBonusRunning(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	base := func() *model.Voucher {
+		return &model.Voucher{Kind: model.VoucherTopupBonus, Active: true, StartsAt: past,
+			Amount: model.Units(10), MinTopup: model.Units(100), MaxUses: 10, PerUserLimit: 1}
+	}
+
+	cases := []struct {
+		name  string
+		edit  func(v *model.Voucher)
+		topup model.Money
+		want  bool
+	}{
+		{"ok", func(*model.Voucher) {}, model.Units(100), true},
+		{"below minimum", func(*model.Voucher) {}, model.Units(99), false},
+		{"credit code", func(v *model.Voucher) { v.Kind = model.VoucherCredit }, model.Units(100), false},
+		{"inactive", func(v *model.Voucher) { v.Active = false }, model.Units(100), false},
+		{"not started", func(v *model.Voucher) { v.StartsAt = future }, model.Units(100), false},
+		{"expired", func(v *model.Voucher) { v.ExpiresAt = &now }, model.Units(100), false},
+		{"used up", func(v *model.Voucher) { v.Uses = 10 }, model.Units(100), false},
+		{"no overall cap", func(v *model.Voucher) { v.MaxUses, v.Uses = 0, 500 }, model.Units(100), true},
+	}
+	for _, c := range cases {
+		v := base()
+		c.edit(v)
+		if got := bonusRunning(v, c.topup, now); got != c.want {
+			t.Errorf("%s: got %v; want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// bonusRepo stubs what ConfirmTopup touches; anything else panics.
+type bonusRepo struct {
+	Repo
+	bal       model.Money
+	campaigns []model.Voucher
+	used      map[int64]int // voucher id → this user's redemptions
+	claimable map[int64]bool
+	claimed   []int64
+	ledger    []model.Money
+}
+
+func (m *bonusRepo) MarkTopupPaidAndCredit(_ context.Context, _ *sql.Tx, _, _ int64, amount model.Money) (model.Money, error) {
+	m.bal += amount
+	m.ledger = append(m.ledger, amount)
+	return m.bal, nil
+}
+func (m *bonusRepo) ListTopupCampaigns(context.Context, *sql.Tx) ([]model.Voucher, error) {
+	return m.campaigns, nil
+}
+func (m *bonusRepo) UserRedemptions(_ context.Context, _ *sql.Tx, voucherID, _ int64) (int, error) {
+	return m.used[voucherID], nil
+}
+func (m *bonusRepo) ClaimVoucherUse(_ context.Context, _ *sql.Tx, voucherID int64) (bool, error) {
+	if !m.claimable[voucherID] {
+		return false, nil
+	}
+	m.claimed = append(m.claimed, voucherID)
+	return true, nil
+}
+func (m *bonusRepo) InsertRedemption(_ context.Context, _ *sql.Tx, voucherID, _ int64, _ model.Money, _ *int64) (int64, error) {
+	return voucherID * 100, nil
+}
+func (m *bonusRepo) UpdateUserBalance(_ context.Context, _ *sql.Tx, _ int64, bal model.Money) error {
+	m.bal = bal
+	return nil
+}
+func (m *bonusRepo) InsertLedger(_ context.Context, _ *sql.Tx, _ int64, _ string, _ *int64, _ string, amount, bal model.Money) error {
+	if bal != m.bal {
+		panic("balance_after does not match the balance")
+	}
+	m.ledger = append(m.ledger, amount)
+	return nil
+}
+
+func TestConfirmTopupAppliesRunningBonuses(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	campaign := func(id int64, edit func(v *model.Voucher)) model.Voucher {
+		v := model.Voucher{ID: id, Kind: model.VoucherTopupBonus, Active: true, StartsAt: start,
+			Amount: model.Units(10), PerUserLimit: 1}
+		edit(&v)
+		return v
+	}
+	m := &bonusRepo{
+		bal: model.Units(5),
+		campaigns: []model.Voucher{
+			campaign(1, func(*model.Voucher) {}),                                              // flat 10
+			campaign(2, func(v *model.Voucher) { v.Percent, v.Amount = 10, model.Units(50) }), // 10% of 200
+			campaign(3, func(v *model.Voucher) { v.MinTopup = model.Units(500) }),             // top-up too small
+			campaign(4, func(*model.Voucher) {}),                                              // user already had it
+			campaign(5, func(*model.Voucher) {}),                                              // ran out since listing
+			campaign(6, func(v *model.Voucher) { v.StartsAt = time.Now().Add(time.Hour) }),    // not started
+		},
+		used:      map[int64]int{4: 1},
+		claimable: map[int64]bool{1: true, 2: true, 3: true, 4: true, 6: true},
+	}
+	db := sqlstub.New()
+	s := &service{db: db.DB, r: m}
+
+	if err := s.ConfirmTopup(context.Background(), 9, 7, model.Units(200)); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.claimed) != 2 || m.claimed[0] != 1 || m.claimed[1] != 2 {
+		t.Errorf("claimed %v; want campaigns [1 2]", m.claimed)
+	}
+	if want := model.Units(5 + 200 + 10 + 20); m.bal != want {
+		t.Errorf("balance %s; want %s", m.bal, want)
+	}
+	if len(m.ledger) != 3 || db.Commits() != 1 {
+		t.Errorf("ledger %v, %d commits; want the top-up and two bonuses committed together", m.ledger, db.Commits())
+	}
+}
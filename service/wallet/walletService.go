@@ -1,6 +1,7 @@
 package wallet
 
 import (
+	"bookrental/model"
 	wrepo "bookrental/repository/wallet"
 	xenditrepo "bookrental/repository/xendit"
 	"context"
@@ -9,33 +10,151 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/labstack/echo/v4"
 )
 
 type LedgerRow = wrepo.LedgerRow
+type JournalReport = wrepo.JournalReport
 
 type Service interface {
-	CreateTopup(ctx context.Context, userID int64, amount float64, payerEmail string) (*TopupCreated, error)
-	Ledger(ctx context.Context, userID int64) ([]LedgerRow, error)
+	CreateTopup(ctx context.Context, userID int64, amount model.Money, payerEmail string) (*TopupCreated, error)
+	Topups(ctx context.Context, userID int64) ([]model.WalletTopup, error)
+	Topup(ctx context.Context, userID, topupID int64) (*model.WalletTopup, error)
+	// Background job: expire top-ups whose invoice has lapsed.
+	ExpireTopups(ctx context.Context) (int, error)
+	// Credit a paid top-up and any bonus campaign it qualifies for; called by the payment service.
+	ConfirmTopup(ctx context.Context, topupID, userID int64, amount model.Money) error
+	Ledger(ctx context.Context, userID int64, q LedgerQuery) (*LedgerPage, error)
+	// Current balance, money in flight and lifetime totals.
+	Summary(ctx context.Context, userID int64) (*Summary, error)
+	// Monthly statement for the month containing month (UTC).
+	Statement(ctx context.Context, userID int64, month time.Time) (*Statement, error)
+	// Cash out part of the balance to a bank account.
+	Withdraw(ctx context.Context, userID int64, req WithdrawReq) (*model.WalletWithdrawal, error)
+	Withdrawals(ctx context.Context, userID int64) ([]model.WalletWithdrawal, error)
+	// Resend payouts whose request got no clear answer; returns how many went through.
+	RetryWithdrawals(ctx context.Context) (int, error)
+	// Disbursement callbacks, routed here by the payment service.
+	SettleWithdrawal(ctx context.Context, withdrawalID int64, disbursementID string) error
+	ReverseWithdrawal(ctx context.Context, withdrawalID int64, disbursementID, reason string) error
+	// Gift balance to another member.
+	FindRecipient(ctx context.Context, username string) (*Recipient, error)
+	Transfer(ctx context.Context, fromID int64, req TransferReq) (*model.WalletTransfer, error)
+	Transfers(ctx context.Context, userID int64) ([]model.WalletTransfer, error)
+	// Promo codes: admins create them, members redeem CREDIT codes.
+	CreateVoucher(ctx context.Context, adminID int64, req VoucherReq) (*model.Voucher, error)
+	Vouchers(ctx context.Context) ([]model.Voucher, error)
+	Redeem(ctx context.Context, userID int64, code string) (*Redemption, error)
+	// Manual balance adjustments (admin).
+	Adjust(ctx context.Context, adminID int64, req AdjustReq) (*model.WalletAdjustment, error)
+	ApproveAdjustment(ctx context.Context, adminID, adjustmentID int64) (*model.WalletAdjustment, error)
+	RejectAdjustment(ctx context.Context, adminID, adjustmentID int64) (*model.WalletAdjustment, error)
+	Adjustments(ctx context.Context, status model.AdjustmentStatus) ([]model.WalletAdjustment, error)
+	// Recompute balances from the journal and report discrepancies (admin).
+	VerifyJournal(ctx context.Context) (*JournalReport, error)
 }
 
 type TopupCreated struct {
+	TopupID                           int64
 	InvoiceID, PaymentLink, ExpiresAt string
 }
 
+// LedgerQuery filters and pages the ledger. From is inclusive, To
+// exclusive; Cursor is the next_cursor of the previous page.
+type LedgerQuery struct {
+	EntryType string
+	RefTable  string
+	From, To  *time.Time
+	Cursor    int64
+	Limit     int
+}
+
+// LedgerPage is one page of ledger rows, newest first. The balances cover
+// the whole From..To period regardless of the other filters.
+type LedgerPage struct {
+	Data           []LedgerRow `json:"data"`
+	NextCursor     *int64      `json:"next_cursor"`
+	OpeningBalance model.Money `json:"opening_balance"`
+	ClosingBalance model.Money `json:"closing_balance"`
+}
+
+const (
+	defaultLedgerPage = 50
+	maxLedgerPage     = 200
+)
+
 type Repo interface {
-	InsertTopup(ctx context.Context, tx *sql.Tx, userID int64, amount float64, invID, link, expires string) (int64, error)
-	ListLedger(ctx context.Context, userID int64) ([]LedgerRow, error)
+	InsertTopup(ctx context.Context, tx *sql.Tx, userID int64, amount model.Money, invID, link, expires string) (int64, error)
+	ExpireTopups(ctx context.Context, grace time.Duration) (int, error)
+	ListTopups(ctx context.Context, userID int64) ([]model.WalletTopup, error)
+	GetTopup(ctx context.Context, id int64) (*model.WalletTopup, error)
+	ListLedger(ctx context.Context, f wrepo.LedgerFilter) ([]LedgerRow, error)
+	ListLedgerPeriod(ctx context.Context, userID int64, from, to time.Time) ([]LedgerRow, error)
+	PeriodBalances(ctx context.Context, userID int64, from, to *time.Time) (opening, closing model.Money, err error)
+	GetBalance(ctx context.Context, userID int64) (model.Money, error)
+	PendingTopups(ctx context.Context, userID int64) (count int, total model.Money, err error)
+	HeldForBookings(ctx context.Context, userID int64) (count int, total model.Money, err error)
+	LedgerTotals(ctx context.Context, userID int64) (map[string]model.Money, error)
+
+	GetUserBalanceForUpdate(ctx context.Context, tx *sql.Tx, userID int64) (model.Money, error)
+	UpdateUserBalance(ctx context.Context, tx *sql.Tx, userID int64, newBalance model.Money) error
+	InsertLedger(ctx context.Context, tx *sql.Tx, userID int64, refTable string, refID *int64, entryType string, amount model.Money, balanceAfter model.Money) error
+
+	InsertWithdrawal(ctx context.Context, tx *sql.Tx, w *model.WalletWithdrawal) (int64, error)
+	SetWithdrawalDisbursement(ctx context.Context, id int64, disbursementID string) error
+	LockWithdrawal(ctx context.Context, tx *sql.Tx, id int64) (*model.WalletWithdrawal, error)
+	FinishWithdrawal(ctx context.Context, tx *sql.Tx, id int64, status model.WithdrawalStatus, disbursementID, failureReason string) error
+	CompleteReversedWithdrawal(ctx context.Context, tx *sql.Tx, id int64, disbursementID, note string) error
+	ListUnsentWithdrawals(ctx context.Context, olderThan time.Duration, limit int) ([]model.WalletWithdrawal, error)
+	ListWithdrawals(ctx context.Context, userID int64) ([]model.WalletWithdrawal, error)
+
+	InsertAdjustment(ctx context.Context, tx *sql.Tx, a *model.WalletAdjustment) (int64, error)
+	LockAdjustment(ctx context.Context, tx *sql.Tx, id int64) (*model.WalletAdjustment, error)
+	DecideAdjustment(ctx context.Context, tx *sql.Tx, a *model.WalletAdjustment, status model.AdjustmentStatus, adminID int64) error
+	ListAdjustments(ctx context.Context, status model.AdjustmentStatus) ([]model.WalletAdjustment, error)
+
+	UserIDByUsername(ctx context.Context, username string) (int64, error)
+	InsertTransfer(ctx context.Context, tx *sql.Tx, t *model.WalletTransfer) (int64, error)
+	TransferredSince(ctx context.Context, tx *sql.Tx, userID int64, since time.Time) (model.Money, error)
+	ListTransfers(ctx context.Context, userID int64) ([]model.WalletTransfer, error)
+
+	CreateVoucher(ctx context.Context, v *model.Voucher) (int64, error)
+	ListVouchers(ctx context.Context) ([]model.Voucher, error)
+	LockVoucherByCode(ctx context.Context, tx *sql.Tx, code string) (*model.Voucher, error)
+	UserRedemptions(ctx context.Context, tx *sql.Tx, voucherID, userID int64) (int, error)
+	InsertRedemption(ctx context.Context, tx *sql.Tx, voucherID, userID int64, amount model.Money, topupID *int64) (int64, error)
+	ClaimVoucherUse(ctx context.Context, tx *sql.Tx, voucherID int64) (bool, error)
+	ListTopupCampaigns(ctx context.Context, tx *sql.Tx) ([]model.Voucher, error)
+	MarkTopupPaidAndCredit(ctx context.Context, tx *sql.Tx, topupID, userID int64, amount model.Money) (model.Money, error)
+
+	VerifyJournal(ctx context.Context) (*JournalReport, error)
+}
+
+// Config tunes the wallet service.
+type Config struct {
+	// Adjustments larger than this (either sign) need a second admin.
+	// Zero applies every adjustment at once.
+	AdjustApprovalOver model.Money
+	// Most a member may transfer to others in any 24 hours. Zero is no limit.
+	TransferDailyLimit model.Money
+	// How long past its expires_at a PENDING top-up is left before the
+	// sweeper expires it.
+	TopupExpiryGrace time.Duration
 }
 
 type service struct {
-	db *sql.DB
-	r  Repo
-	x  xenditrepo.Repo
+	db  *sql.DB
+	r   Repo
+	x   xenditrepo.Repo
+	cfg Config
 }
 
-func New(db *sql.DB, r Repo, x xenditrepo.Repo) Service { return &service{db: db, r: r, x: x} }
+func New(db *sql.DB, r Repo, x xenditrepo.Repo, cfg Config) Service {
+	return &service{db: db, r: r, x: x, cfg: cfg}
+}
 
-func (s *service) CreateTopup(ctx context.Context, userID int64, amount float64, payerEmail string) (*TopupCreated, error) {
+func (s *service) CreateTopup(ctx context.Context, userID int64, amount model.Money, payerEmail string) (*TopupCreated, error) {
 	if strings.TrimSpace(payerEmail) == "" {
 		return nil, fmt.Errorf("validation: payer_email required")
 	}
@@ -63,15 +182,107 @@ func (s *service) CreateTopup(ctx context.Context, userID int64, amount float64,
 		}
 	}()
 
-	if _, err = s.r.InsertTopup(ctx, tx, userID, amount, iv.InvoiceID, iv.InvoiceURL, iv.ExpiresAt); err != nil {
+	topupID, err := s.r.InsertTopup(ctx, tx, userID, amount, iv.InvoiceID, iv.InvoiceURL, iv.ExpiresAt)
+	if err != nil {
 		return nil, err
 	}
 	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
-	return &TopupCreated{InvoiceID: iv.InvoiceID, PaymentLink: iv.InvoiceURL, ExpiresAt: iv.ExpiresAt}, nil
+	return &TopupCreated{TopupID: topupID, InvoiceID: iv.InvoiceID, PaymentLink: iv.InvoiceURL, ExpiresAt: iv.ExpiresAt}, nil
+}
+
+func (s *service) Topups(ctx context.Context, userID int64) ([]model.WalletTopup, error) {
+	return s.r.ListTopups(ctx, userID)
+}
+
+// Topup returns one of the user's top-ups so the client can poll its status.
+// Someone else's top-up is reported as not found.
+func (s *service) Topup(ctx context.Context, userID, topupID int64) (*model.WalletTopup, error) {
+	t, err := s.r.GetTopup(ctx, topupID)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && t.UserID != userID {
+		return nil, echo.NewHTTPError(404, echo.Map{"message": "topup not found"})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *service) ExpireTopups(ctx context.Context) (int, error) {
+	return s.r.ExpireTopups(ctx, s.cfg.TopupExpiryGrace)
+}
+
+// ConfirmTopup marks a paid top-up PAID, credits it and pays out the bonus
+// campaigns it qualifies for, all in one tx.
+func (s *service) ConfirmTopup(ctx context.Context, topupID, userID int64, amount model.Money) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	bal, err := s.r.MarkTopupPaidAndCredit(ctx, tx, topupID, userID, amount)
+	if err != nil {
+		return err
+	}
+	return s.applyTopupBonuses(ctx, tx, topupID, userID, amount, bal)
 }
 
-func (s *service) Ledger(ctx context.Context, userID int64) ([]LedgerRow, error) {
-	return s.r.ListLedger(ctx, userID)
+func (s *service) Ledger(ctx context.Context, userID int64, q LedgerQuery) (*LedgerPage, error) {
+	if q.Limit <= 0 {
+		q.Limit = defaultLedgerPage
+	}
+	if q.Limit > maxLedgerPage {
+		q.Limit = maxLedgerPage
+	}
+	// One extra row tells us whether there is a next page.
+	rows, err := s.r.ListLedger(ctx, wrepo.LedgerFilter{
+		UserID:    userID,
+		EntryType: q.EntryType,
+		RefTable:  q.RefTable,
+		From:      q.From,
+		To:        q.To,
+		Before:    q.Cursor,
+		Limit:     q.Limit + 1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list ledger: %w", err)
+	}
+	page := &LedgerPage{Data: rows}
+	if len(rows) > q.Limit {
+		page.Data = rows[:q.Limit]
+		next := page.Data[q.Limit-1].ID
+		page.NextCursor = &next
+	}
+	if page.Data == nil {
+		page.Data = []LedgerRow{}
+	}
+	if page.OpeningBalance, page.ClosingBalance, err = s.r.PeriodBalances(ctx, userID, q.From, q.To); err != nil {
+		return nil, fmt.Errorf("period balances: %w", err)
+	}
+	return page, nil
+}
+
+func (s *service) VerifyJournal(ctx context.Context) (*JournalReport, error) {
+	return s.r.VerifyJournal(ctx)
+}
+
+// post moves the user's locked balance bal by amount and writes the ledger
+// line against refTable/refID.
+func (s *service) post(ctx context.Context, tx *sql.Tx, userID int64, refTable string, refID int64, entry model.LedgerType, amount, bal model.Money) error {
+	newBal := bal + amount
+	if err := s.r.UpdateUserBalance(ctx, tx, userID, newBal); err != nil {
+		return fmt.Errorf("update balance: %w", err)
+	}
+	if err := s.r.InsertLedger(ctx, tx, userID, refTable, &refID, string(entry), amount, newBal); err != nil {
+		return fmt.Errorf("insert ledger %s: %w", entry, err)
+	}
+	return nil
 }
@@ -0,0 +1,243 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"bookrental/model"
+	xenditrepo "bookrental/repository/xendit"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// withdrawalRetryAge leaves the first attempt time to finish before a
+	// retry sends the same payout again.
+	withdrawalRetryAge = time.Minute
+	// withdrawalRetryBatch caps how many payouts one retry pass resends.
+	withdrawalRetryBatch = 50
+)
+
+// WithdrawReq is a cash-out to a bank account.
+type WithdrawReq struct {
+	Amount        model.Money
+	BankCode      string
+	AccountHolder string
+	AccountNumber string
+}
+
+// Withdraw pays part of the deposit balance out to a bank account.
+// The balance is debited into a PENDING withdrawal before the provider is
+// called, so the same money cannot be spent or withdrawn twice while the
+// payout is in flight. A payout the provider definitely refuses is reversed
+// at once. When the call fails any other way the payout may still have been
+// made, so the withdrawal stays PENDING: RetryWithdrawals resends it under
+// the same idempotency key and the disbursement callback settles it.
+// Business rules:
+// - Amount must be positive (400)
+// - Balance must cover the amount (402)
+// - Provider must not reject the payout (502, balance restored)
+func (s *service) Withdraw(ctx context.Context, userID int64, req WithdrawReq) (*model.WalletWithdrawal, error) {
+	if req.Amount <= 0 {
+		return nil, echo.NewHTTPError(400, echo.Map{"message": "amount must be positive"})
+	}
+	w := &model.WalletWithdrawal{
+		UserID:        userID,
+		Amount:        req.Amount,
+		Status:        model.WithdrawalPending,
+		BankCode:      req.BankCode,
+		AccountHolder: req.AccountHolder,
+		AccountNumber: req.AccountNumber,
+	}
+	if err := s.debitWithdrawal(ctx, w); err != nil {
+		return nil, err
+	}
+
+	if err := s.sendWithdrawal(ctx, w); err != nil {
+		if !xenditrepo.IsRejected(err) {
+			// Unclear outcome: the withdrawal stays PENDING for a retry.
+			return w, nil
+		}
+		if rerr := s.ReverseWithdrawal(ctx, w.ID, "", "provider rejected: "+err.Error()); rerr != nil {
+			return nil, echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("reverse withdrawal %d: %v", w.ID, rerr)})
+		}
+		return nil, echo.NewHTTPError(502, echo.Map{"message": "payout rejected by provider; your balance was not charged"})
+	}
+	return w, nil
+}
+
+// sendWithdrawal asks the provider to pay w out and records the
+// disbursement id. The external_id doubles as the idempotency key, so
+// sending the same withdrawal again cannot pay twice.
+func (s *service) sendWithdrawal(ctx context.Context, w *model.WalletWithdrawal) error {
+	resp, err := s.x.CreateDisbursement(xenditrepo.CreateDisbursementReq{
+		ExternalID:        fmt.Sprintf("%s%d", model.WithdrawalPrefix, w.ID),
+		Amount:            w.Amount,
+		BankCode:          w.BankCode,
+		AccountHolderName: w.AccountHolder,
+		AccountNumber:     w.AccountNumber,
+		Description:       "Library deposit withdrawal",
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.r.SetWithdrawalDisbursement(ctx, w.ID, resp.DisbursementID); err != nil {
+		return fmt.Errorf("save disbursement: %w", err)
+	}
+	w.DisbursementID = &resp.DisbursementID
+	return nil
+}
+
+// RetryWithdrawals resends PENDING withdrawals that have no disbursement id
+// yet. Rejections are reversed; other failures are left for the next pass.
+func (s *service) RetryWithdrawals(ctx context.Context) (int, error) {
+	ws, err := s.r.ListUnsentWithdrawals(ctx, withdrawalRetryAge, withdrawalRetryBatch)
+	if err != nil {
+		return 0, fmt.Errorf("list unsent withdrawals: %w", err)
+	}
+	var (
+		sent   int
+		failed []error
+	)
+	for i := range ws {
+		w := &ws[i]
+		err := s.sendWithdrawal(ctx, w)
+		switch {
+		case err == nil:
+			sent++
+		case xenditrepo.IsRejected(err):
+			if rerr := s.ReverseWithdrawal(ctx, w.ID, "", "provider rejected: "+err.Error()); rerr != nil {
+				failed = append(failed, fmt.Errorf("reverse withdrawal %d: %w", w.ID, rerr))
+			}
+		default:
+			failed = append(failed, fmt.Errorf("resend withdrawal %d: %w", w.ID, err))
+		}
+	}
+	return sent, errors.Join(failed...)
+}
+
+// debitWithdrawal inserts the PENDING withdrawal and takes its amount off
+// the balance with a WITHDRAWAL ledger line.
+func (s *service) debitWithdrawal(ctx context.Context, w *model.WalletWithdrawal) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return echo.NewHTTPError(500, echo.Map{"message": "begin tx failed"})
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	bal, err := s.r.GetUserBalanceForUpdate(ctx, tx, w.UserID)
+	if err != nil {
+		return echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("lock balance: %v", err)})
+	}
+	if bal < w.Amount {
+		return echo.NewHTTPError(402, echo.Map{"message": "insufficient balance", "balance": bal})
+	}
+	if _, err = s.r.InsertWithdrawal(ctx, tx, w); err != nil {
+		return echo.NewHTTPError(500, echo.Map{"message": fmt.Sprintf("insert withdrawal: %v", err)})
+	}
+	if err = s.post(ctx, tx, w.UserID, "wallet_withdrawals", w.ID, model.LedgerWithdraw, -w.Amount, bal); err != nil {
+		return echo.NewHTTPError(500, echo.Map{"message": err.Error()})
+	}
+	return nil
+}
+
+// Withdrawals lists the user's withdrawals, newest first.
+func (s *service) Withdrawals(ctx context.Context, userID int64) ([]model.WalletWithdrawal, error) {
+	return s.r.ListWithdrawals(ctx, userID)
+}
+
+// SettleWithdrawal marks a payout as delivered. Repeated callbacks are
+// no-ops. A success reported for a withdrawal that was already reversed
+// means the money left after all: the reversal credited it back, so it is
+// debited again, even into a debt, and the withdrawal ends COMPLETED.
+func (s *service) SettleWithdrawal(ctx context.Context, withdrawalID int64, disbursementID string) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	w, err := s.lockWithdrawal(ctx, tx, withdrawalID, disbursementID)
+	if err != nil || w == nil {
+		return err
+	}
+	switch w.Status {
+	case model.WithdrawalCompleted:
+		return nil
+	case model.WithdrawalFailed:
+		bal, err := s.r.GetUserBalanceForUpdate(ctx, tx, w.UserID)
+		if err != nil {
+			return fmt.Errorf("lock balance: %w", err)
+		}
+		if err = s.post(ctx, tx, w.UserID, "wallet_withdrawals", w.ID, model.LedgerWithdraw, -w.Amount, bal); err != nil {
+			return err
+		}
+		return s.r.CompleteReversedWithdrawal(ctx, tx, w.ID, disbursementID, "completed by provider after it was reversed; debited again")
+	}
+	return s.r.FinishWithdrawal(ctx, tx, w.ID, model.WithdrawalCompleted, disbursementID, "")
+}
+
+// ReverseWithdrawal marks a payout as failed and credits the amount back
+// with a WITHDRAWAL_REVERSAL line. Withdrawals that are already final are
+// left alone.
+func (s *service) ReverseWithdrawal(ctx context.Context, withdrawalID int64, disbursementID, reason string) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	w, err := s.lockWithdrawal(ctx, tx, withdrawalID, disbursementID)
+	if err != nil || w == nil || w.Status != model.WithdrawalPending {
+		return err
+	}
+	if reason == "" {
+		reason = "payout failed"
+	}
+	bal, err := s.r.GetUserBalanceForUpdate(ctx, tx, w.UserID)
+	if err != nil {
+		return fmt.Errorf("lock balance: %w", err)
+	}
+	if err = s.post(ctx, tx, w.UserID, "wallet_withdrawals", w.ID, model.LedgerWithdrawRevert, w.Amount, bal); err != nil {
+		return err
+	}
+	return s.r.FinishWithdrawal(ctx, tx, w.ID, model.WithdrawalFailed, disbursementID, reason)
+}
+
+// lockWithdrawal loads a withdrawal for a callback. Unknown ids return nil
+// so the provider stops retrying; a disbursement id that does not match the
+// one on record is rejected.
+func (s *service) lockWithdrawal(ctx context.Context, tx *sql.Tx, id int64, disbursementID string) (*model.WalletWithdrawal, error) {
+	w, err := s.r.LockWithdrawal(ctx, tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock withdrawal: %w", err)
+	}
+	if disbursementID != "" && w.DisbursementID != nil && *w.DisbursementID != disbursementID {
+		return nil, fmt.Errorf("withdrawal %d belongs to disbursement %s, not %s", w.ID, *w.DisbursementID, disbursementID)
+	}
+	return w, nil
+}
@@ -0,0 +1,276 @@
+package wallet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"bookrental/model"
+	xenditrepo "bookrental/repository/xendit"
+	"bookrental/util/sqlstub"
+
+	"github.com/labstack/echo/v4"
+)
+
+// withdrawRepo keeps one user's balance, ledger and withdrawals in memory;
+// anything else panics.
+type withdrawRepo struct {
+	Repo
+	bal         model.Money
+	ledger      []model.LedgerType
+	withdrawals map[int64]*model.WalletWithdrawal
+}
+
+func newWithdrawRepo(bal model.Money) *withdrawRepo {
+	return &withdrawRepo{bal: bal, withdrawals: map[int64]*model.WalletWithdrawal{}}
+}
+
+func (m *withdrawRepo) GetUserBalanceForUpdate(context.Context, *sql.Tx, int64) (model.Money, error) {
+	return m.bal, nil
+}
+func (m *withdrawRepo) UpdateUserBalance(_ context.Context, _ *sql.Tx, _ int64, bal model.Money) error {
+	m.bal = bal
+	return nil
+}
+func (m *withdrawRepo) InsertLedger(_ context.Context, _ *sql.Tx, _ int64, _ string, _ *int64, entry string, _, _ model.Money) error {
+	m.ledger = append(m.ledger, model.LedgerType(entry))
+	return nil
+}
+
+func (m *withdrawRepo) InsertWithdrawal(_ context.Context, _ *sql.Tx, w *model.WalletWithdrawal) (int64, error) {
+	w.ID, w.CreatedAt = int64(len(m.withdrawals)+1), time.Now()
+	cp := *w
+	m.withdrawals[w.ID] = &cp
+	return w.ID, nil
+}
+func (m *withdrawRepo) SetWithdrawalDisbursement(_ context.Context, id int64, disbursementID string) error {
+	if m.withdrawals[id].DisbursementID == nil {
+		m.withdrawals[id].DisbursementID = &disbursementID
+	}
+	return nil
+}
+func (m *withdrawRepo) LockWithdrawal(_ context.Context, _ *sql.Tx, id int64) (*model.WalletWithdrawal, error) {
+	w, ok := m.withdrawals[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	cp := *w
+	return &cp, nil
+}
+func (m *withdrawRepo) FinishWithdrawal(_ context.Context, _ *sql.Tx, id int64, status model.WithdrawalStatus, _, reason string) error {
+	w := m.withdrawals[id]
+	if w.Status != model.WithdrawalPending {
+		return fmt.Errorf("withdrawal %d is not pending", id)
+	}
+	w.Status, w.FailureReason = status, &reason
+	return nil
+}
+func (m *withdrawRepo) CompleteReversedWithdrawal(_ context.Context, _ *sql.Tx, id int64, _, note string) error {
+	w := m.withdrawals[id]
+	if w.Status != model.WithdrawalFailed {
+		return fmt.Errorf("withdrawal %d is not failed", id)
+	}
+	w.Status, w.FailureReason = model.WithdrawalCompleted, &note
+	return nil
+}
+func (m *withdrawRepo) ListUnsentWithdrawals(context.Context, time.Duration, int) ([]model.WalletWithdrawal, error) {
+	var out []model.WalletWithdrawal
+	for id := int64(1); id <= int64(len(m.withdrawals)); id++ {
+		if w := m.withdrawals[id]; w.Status == model.WithdrawalPending && w.DisbursementID == nil {
+			out = append(out, *w)
+		}
+	}
+	return out, nil
+}
+
+func (m *withdrawRepo) count(entry model.LedgerType) int {
+	n := 0
+	for _, e := range m.ledger {
+		if e == entry {
+			n++
+		}
+	}
+	return n
+}
+
+// payouts answers CreateDisbursement with errs in turn, then succeeds.
+type payouts struct {
+	xenditrepo.Repo
+	errs  []error
+	calls []xenditrepo.CreateDisbursementReq
+}
+
+func (p *payouts) CreateDisbursement(req xenditrepo.CreateDisbursementReq) (*xenditrepo.CreateDisbursementResp, error) {
+	p.calls = append(p.calls, req)
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return nil, err
+	}
+	return &xenditrepo.CreateDisbursementResp{DisbursementID: "disb-" + req.ExternalID, Status: "PENDING"}, nil
+}
+
+func withdrawService(bal model.Money, errs ...error) (*service, *withdrawRepo, *payouts) {
+	m, p := newWithdrawRepo(bal), &payouts{errs: errs}
+	return &service{db: sqlstub.New().DB, r: m, x: p}, m, p
+}
+
+var withdrawal = WithdrawReq{Amount: model.Units(40), BankCode: "BCA", AccountHolder: "A", AccountNumber: "1"}
+
+func TestWithdrawDebitsBalance(t *testing.T) {
+	s, m, p := withdrawService(model.Units(100))
+
+	w, err := s.Withdraw(context.Background(), 7, withdrawal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.bal != model.Units(60) || m.count(model.LedgerWithdraw) != 1 {
+		t.Errorf("balance %s, ledger %v; want 60.00 after one WITHDRAWAL", m.bal, m.ledger)
+	}
+	if w.Status != model.WithdrawalPending || w.DisbursementID == nil || *w.DisbursementID != "disb-withdrawal:1" {
+		t.Errorf("withdrawal %+v; want PENDING with its disbursement id", w)
+	}
+	if p.calls[0].ExternalID != model.WithdrawalPrefix+"1" {
+		t.Errorf("external_id %q; want %q", p.calls[0].ExternalID, model.WithdrawalPrefix+"1")
+	}
+
+	if _, err := s.Withdraw(context.Background(), 7, WithdrawReq{Amount: model.Units(61)}); httpCode(err) != 402 {
+		t.Errorf("overdraw: got %v; want 402", err)
+	}
+}
+
+func TestWithdrawReversesRejection(t *testing.T) {
+	s, m, _ := withdrawService(model.Units(100), &xenditrepo.APIError{StatusCode: 400, Status: "400 Bad Request"})
+
+	_, err := s.Withdraw(context.Background(), 7, withdrawal)
+	if httpCode(err) != 502 {
+		t.Fatalf("got %v; want 502", err)
+	}
+	if m.bal != model.Units(100) || m.count(model.LedgerWithdrawRevert) != 1 {
+		t.Errorf("balance %s, ledger %v; want the debit reversed", m.bal, m.ledger)
+	}
+	if m.withdrawals[1].Status != model.WithdrawalFailed {
+		t.Errorf("status %s; want FAILED", m.withdrawals[1].Status)
+	}
+}
+
+func TestWithdrawKeepsUnclearPayoutPending(t *testing.T) {
+	for _, perr := range []error{
+		errors.New("context deadline exceeded"),
+		&xenditrepo.APIError{StatusCode: 503, Status: "503 Service Unavailable"},
+		&xenditrepo.APIError{StatusCode: 429, Status: "429 Too Many Requests"},
+	} {
+		s, m, p := withdrawService(model.Units(100), perr, perr)
+
+		w, err := s.Withdraw(context.Background(), 7, withdrawal)
+		if err != nil || w.Status != model.WithdrawalPending || w.DisbursementID != nil {
+			t.Fatalf("%v: got %+v, %v; want a PENDING withdrawal awaiting retry", perr, w, err)
+		}
+		if m.bal != model.Units(60) || m.count(model.LedgerWithdrawRevert) != 0 {
+			t.Errorf("%v: balance %s, ledger %v; want the debit kept", perr, m.bal, m.ledger)
+		}
+
+		// The first retry fails the same way, the second goes through.
+		if n, err := s.RetryWithdrawals(context.Background()); n != 0 || err == nil {
+			t.Errorf("%v: retry = %d, %v; want nothing sent and the error reported", perr, n, err)
+		}
+		if n, err := s.RetryWithdrawals(context.Background()); n != 1 || err != nil {
+			t.Errorf("%v: retry = %d, %v; want one sent", perr, n, err)
+		}
+		for _, c := range p.calls {
+			if c.ExternalID != p.calls[0].ExternalID {
+				t.Errorf("%v: resent as %q; want the same idempotency key %q", perr, c.ExternalID, p.calls[0].ExternalID)
+			}
+		}
+		if d := m.withdrawals[1].DisbursementID; d == nil {
+			t.Errorf("%v: no disbursement id recorded after the retry", perr)
+		}
+	}
+}
+
+func TestRetryWithdrawalsReversesRejection(t *testing.T) {
+	s, m, _ := withdrawService(model.Units(100), errors.New("EOF"), &xenditrepo.APIError{StatusCode: 422, Status: "422"})
+	if _, err := s.Withdraw(context.Background(), 7, withdrawal); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.RetryWithdrawals(context.Background()); n != 0 || err != nil {
+		t.Errorf("retry = %d, %v; want the rejection reversed quietly", n, err)
+	}
+	if m.bal != model.Units(100) || m.withdrawals[1].Status != model.WithdrawalFailed {
+		t.Errorf("balance %s, status %s; want 100.00 and FAILED", m.bal, m.withdrawals[1].Status)
+	}
+}
+
+func TestWithdrawalCallbacksAreIdempotent(t *testing.T) {
+	ctx := context.Background()
+	s, m, _ := withdrawService(model.Units(100))
+	w, err := s.Withdraw(ctx, 7, withdrawal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.SettleWithdrawal(ctx, w.ID, *w.DisbursementID); err != nil {
+			t.Fatalf("settle #%d: %v", i+1, err)
+		}
+	}
+	if err := s.ReverseWithdrawal(ctx, w.ID, *w.DisbursementID, "late FAILED"); err != nil {
+		t.Fatalf("reverse after completion: %v", err)
+	}
+	if m.withdrawals[1].Status != model.WithdrawalCompleted || m.bal != model.Units(60) || len(m.ledger) != 1 {
+		t.Errorf("status %s, balance %s, ledger %v; want one COMPLETED debit", m.withdrawals[1].Status, m.bal, m.ledger)
+	}
+
+	s, m, _ = withdrawService(model.Units(100))
+	if w, err = s.Withdraw(ctx, 7, withdrawal); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.ReverseWithdrawal(ctx, w.ID, *w.DisbursementID, "INSUFFICIENT_BALANCE"); err != nil {
+			t.Fatalf("reverse #%d: %v", i+1, err)
+		}
+	}
+	if m.bal != model.Units(100) || m.count(model.LedgerWithdrawRevert) != 1 {
+		t.Errorf("balance %s, ledger %v; want one reversal", m.bal, m.ledger)
+	}
+
+	if err := s.SettleWithdrawal(ctx, w.ID, "someone-else"); err == nil {
+		t.Error("callback for another disbursement was accepted")
+	}
+	if err := s.SettleWithdrawal(ctx, 99, "disb-x"); err != nil {
+		t.Errorf("unknown withdrawal: %v; want it acknowledged", err)
+	}
+}
+
+func TestSettleWithdrawalAfterReversal(t *testing.T) {
+	ctx := context.Background()
+	s, m, _ := withdrawService(model.Units(100))
+	w, err := s.Withdraw(ctx, 7, withdrawal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReverseWithdrawal(ctx, w.ID, *w.DisbursementID, "timeout"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.SettleWithdrawal(ctx, w.ID, *w.DisbursementID); err != nil {
+			t.Fatalf("settle #%d: %v", i+1, err)
+		}
+	}
+	if m.withdrawals[1].Status != model.WithdrawalCompleted {
+		t.Errorf("status %s; want COMPLETED", m.withdrawals[1].Status)
+	}
+	if m.bal != model.Units(60) || m.count(model.LedgerWithdraw) != 2 {
+		t.Errorf("balance %s, ledger %v; want the reversal taken back once", m.bal, m.ledger)
+	}
+}
+
+func httpCode(err error) int {
+	if he, ok := err.(*echo.HTTPError); ok {
+		return he.Code
+	}
+	return 0
+}
@@ -184,10 +184,294 @@ CREATE TABLE IF NOT EXISTS wallet_ledger (
 );
 CREATE INDEX IF NOT EXISTS idx_ledger_user ON wallet_ledger(user_id);
 
-CREATE OR REPLACE VIEW v_books_with_availability AS
+
+-- LOAN PERIOD, DUE DATES & LATE FEES
+ALTER TABLE books ADD COLUMN IF NOT EXISTS rental_days INT NOT NULL DEFAULT 7 CHECK (rental_days > 0);
+ALTER TABLE books ADD COLUMN IF NOT EXISTS late_fee_per_day NUMERIC(18,2) NOT NULL DEFAULT 0 CHECK (late_fee_per_day >= 0);
+
+ALTER TABLE rentals ADD COLUMN IF NOT EXISTS due_at TIMESTAMPTZ;
+ALTER TABLE rentals ADD COLUMN IF NOT EXISTS late_fee NUMERIC(18,2) NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_rentals_overdue
+  ON rentals(due_at) WHERE status = 'ACTIVE';
+
+ALTER TYPE ledger_type ADD VALUE IF NOT EXISTS 'LATE_FEE';
+
+-- RENEWALS & WAITLIST
+ALTER TABLE rentals ADD COLUMN IF NOT EXISTS renewal_count INT NOT NULL DEFAULT 0;
+
+DO $$ BEGIN
+  CREATE TYPE waitlist_status AS ENUM ('WAITING','FULFILLED','LEFT');
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+
+CREATE TABLE IF NOT EXISTS book_waitlist (
+  id          BIGSERIAL PRIMARY KEY,
+  book_id     BIGINT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+  user_id     BIGINT NOT NULL REFERENCES users(id),
+  status      waitlist_status NOT NULL DEFAULT 'WAITING',
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_waitlist_book_waiting
+  ON book_waitlist(book_id, id) WHERE status = 'WAITING';
+CREATE UNIQUE INDEX IF NOT EXISTS uq_waitlist_user_book
+  ON book_waitlist(book_id, user_id) WHERE status = 'WAITING';
+
+ALTER TABLE book_waitlist ADD COLUMN IF NOT EXISTS rental_id BIGINT REFERENCES rentals(id);
+ALTER TABLE book_waitlist ADD COLUMN IF NOT EXISTS fulfilled_at TIMESTAMPTZ;
+-- SKIPPED: passed over for a freed copy because the user could not borrow it.
+ALTER TYPE waitlist_status ADD VALUE IF NOT EXISTS 'SKIPPED';
+
+-- LOST & DAMAGED COPIES
+ALTER TYPE book_item_status ADD VALUE IF NOT EXISTS 'LOST';
+ALTER TYPE book_item_status ADD VALUE IF NOT EXISTS 'DAMAGED';
+ALTER TYPE rental_status ADD VALUE IF NOT EXISTS 'LOST';
+ALTER TYPE ledger_type ADD VALUE IF NOT EXISTS 'REPLACEMENT_CHARGE';
+
+ALTER TABLE books ADD COLUMN IF NOT EXISTS replacement_cost NUMERIC(18,2) NOT NULL DEFAULT 0 CHECK (replacement_cost >= 0);
+ALTER TABLE rentals ADD COLUMN IF NOT EXISTS lost_at TIMESTAMPTZ;
+
+-- LOST/DAMAGED copies are out of circulation: never available, not in total_copies.
+DROP VIEW IF EXISTS v_books_with_availability;
+CREATE VIEW v_books_with_availability AS
 SELECT
-  b.id, b.name, b.category, b.rental_cost,
-  COUNT(*) FILTER (WHERE bi.status='AVAILABLE')::BIGINT AS stock_availability
+  b.id, b.name, b.category, b.rental_cost, b.replacement_cost,
+  COUNT(bi.id) FILTER (WHERE bi.status='AVAILABLE')::BIGINT AS stock_availability,
+  COUNT(bi.id) FILTER (WHERE bi.status NOT IN ('LOST','DAMAGED'))::BIGINT AS total_copies
 FROM books b
 LEFT JOIN book_items bi ON bi.book_id=b.id
-GROUP BY b.id, b.name, b.category, b.rental_cost;
+GROUP BY b.id, b.name, b.category, b.rental_cost, b.replacement_cost;
+
+-- MULTI-BOOK CHECKOUT
+CREATE TABLE IF NOT EXISTS rental_orders (
+  id          BIGSERIAL PRIMARY KEY,
+  user_id     BIGINT NOT NULL REFERENCES users(id),
+  total       NUMERIC(18,2) NOT NULL CHECK (total >= 0),
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+ALTER TABLE rentals ADD COLUMN IF NOT EXISTS order_id BIGINT REFERENCES rental_orders(id);
+CREATE INDEX IF NOT EXISTS idx_rentals_order ON rentals(order_id);
+
+-- ADMIN RENTAL ACTIONS
+ALTER TYPE ledger_type ADD VALUE IF NOT EXISTS 'FEE_WAIVER';
+
+DO $$ BEGIN
+  CREATE TYPE rental_admin_action AS ENUM ('FORCE_RETURN','FORCE_CANCEL','WAIVE_FEES');
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+
+CREATE TABLE IF NOT EXISTS rental_admin_actions (
+  id          BIGSERIAL PRIMARY KEY,
+  rental_id   BIGINT NOT NULL REFERENCES rentals(id),
+  admin_id    BIGINT NOT NULL REFERENCES users(id),
+  action      rental_admin_action NOT NULL,
+  reason      TEXT NOT NULL,
+  amount      NUMERIC(18,2) NOT NULL DEFAULT 0,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_rental_admin_actions_rental ON rental_admin_actions(rental_id, created_at);
+
+-- PICKUP SLOTS
+ALTER TABLE book_items ADD COLUMN IF NOT EXISTS branch TEXT NOT NULL DEFAULT 'main';
+
+CREATE TABLE IF NOT EXISTS pickup_slots (
+  id          BIGSERIAL PRIMARY KEY,
+  branch      TEXT NOT NULL,
+  starts_at   TIMESTAMPTZ NOT NULL,
+  ends_at     TIMESTAMPTZ NOT NULL,
+  capacity    INT NOT NULL CHECK (capacity > 0),
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK (ends_at > starts_at)
+);
+CREATE INDEX IF NOT EXISTS idx_pickup_slots_branch_time ON pickup_slots(branch, ends_at);
+
+ALTER TABLE rentals ADD COLUMN IF NOT EXISTS pickup_slot_id BIGINT REFERENCES pickup_slots(id);
+CREATE INDEX IF NOT EXISTS idx_rentals_pickup_slot ON rentals(pickup_slot_id);
+
+-- DOUBLE-ENTRY JOURNAL
+-- Every wallet_ledger row is posted as a journal entry whose lines sum to zero:
+-- a USER_WALLET line (the change in that user's balance) and the opposite
+-- amount on a house account.
+DO $$ BEGIN
+  CREATE TYPE journal_account AS ENUM ('USER_WALLET','REVENUE','GATEWAY_CLEARING','FEES');
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+  id          BIGSERIAL PRIMARY KEY,
+  ledger_id   BIGINT UNIQUE REFERENCES wallet_ledger(id),
+  entry_type  ledger_type NOT NULL,
+  ref_table   TEXT,
+  ref_id      BIGINT,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS journal_lines (
+  id          BIGSERIAL PRIMARY KEY,
+  entry_id    BIGINT NOT NULL REFERENCES journal_entries(id),
+  account     journal_account NOT NULL,
+  user_id     BIGINT REFERENCES users(id),
+  amount      NUMERIC(18,2) NOT NULL,
+  CHECK ((account = 'USER_WALLET') = (user_id IS NOT NULL))
+);
+CREATE INDEX IF NOT EXISTS idx_journal_lines_entry ON journal_lines(entry_id);
+CREATE INDEX IF NOT EXISTS idx_journal_lines_user ON journal_lines(user_id) WHERE user_id IS NOT NULL;
+
+-- Reject unbalanced entries at commit.
+CREATE OR REPLACE FUNCTION journal_entry_balanced() RETURNS trigger AS $$
+BEGIN
+  IF (SELECT COALESCE(SUM(amount), 0) FROM journal_lines WHERE entry_id = NEW.entry_id) <> 0 THEN
+    RAISE EXCEPTION 'journal entry % does not balance', NEW.entry_id;
+  END IF;
+  RETURN NULL;
+END $$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_journal_balanced ON journal_lines;
+CREATE CONSTRAINT TRIGGER trg_journal_balanced
+  AFTER INSERT OR UPDATE ON journal_lines
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW EXECUTE FUNCTION journal_entry_balanced();
+
+-- Backfill ledger rows written before the journal existed.
+INSERT INTO journal_entries (ledger_id, entry_type, ref_table, ref_id, created_at)
+SELECT l.id, l.entry_type, l.ref_table, l.ref_id, l.created_at
+FROM wallet_ledger l
+WHERE NOT EXISTS (SELECT 1 FROM journal_entries e WHERE e.ledger_id = l.id);
+
+INSERT INTO journal_lines (entry_id, account, user_id, amount)
+SELECT e.id, 'USER_WALLET', l.user_id, l.amount
+FROM journal_entries e JOIN wallet_ledger l ON l.id = e.ledger_id
+WHERE NOT EXISTS (SELECT 1 FROM journal_lines jl WHERE jl.entry_id = e.id)
+UNION ALL
+SELECT e.id,
+  (CASE l.entry_type
+     WHEN 'TOPUP_CONFIRMED' THEN 'GATEWAY_CLEARING'
+     WHEN 'LATE_FEE' THEN 'FEES'
+     WHEN 'REPLACEMENT_CHARGE' THEN 'FEES'
+     WHEN 'FEE_WAIVER' THEN 'FEES'
+     ELSE 'REVENUE'
+   END)::journal_account,
+  NULL, -l.amount
+FROM journal_entries e JOIN wallet_ledger l ON l.id = e.ledger_id
+WHERE NOT EXISTS (SELECT 1 FROM journal_lines jl WHERE jl.entry_id = e.id);
+
+-- WITHDRAWALS
+ALTER TYPE ledger_type ADD VALUE IF NOT EXISTS 'WITHDRAWAL';
+ALTER TYPE ledger_type ADD VALUE IF NOT EXISTS 'WITHDRAWAL_REVERSAL';
+
+DO $$ BEGIN
+  CREATE TYPE withdrawal_status AS ENUM ('PENDING','COMPLETED','FAILED');
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+
+CREATE TABLE IF NOT EXISTS wallet_withdrawals (
+  id               BIGSERIAL PRIMARY KEY,
+  user_id          BIGINT NOT NULL REFERENCES users(id),
+  amount           NUMERIC(18,2) NOT NULL CHECK (amount > 0),
+  status           withdrawal_status NOT NULL DEFAULT 'PENDING',
+  bank_code        TEXT NOT NULL,
+  account_holder   TEXT NOT NULL,
+  account_number   TEXT NOT NULL,
+  disbursement_id  TEXT UNIQUE,
+  failure_reason   TEXT,
+  created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  settled_at       TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_withdrawals_user ON wallet_withdrawals(user_id, created_at DESC);
+
+-- ADMIN BALANCE ADJUSTMENTS
+DO $$ BEGIN
+  CREATE TYPE adjustment_status AS ENUM ('PENDING_APPROVAL','APPLIED','REJECTED');
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+
+CREATE TABLE IF NOT EXISTS wallet_adjustments (
+  id            BIGSERIAL PRIMARY KEY,
+  user_id       BIGINT NOT NULL REFERENCES users(id),
+  amount        NUMERIC(18,2) NOT NULL CHECK (amount <> 0),
+  reason        TEXT NOT NULL CHECK (btrim(reason) <> ''),
+  status        adjustment_status NOT NULL,
+  requested_by  BIGINT NOT NULL REFERENCES users(id),
+  decided_by    BIGINT REFERENCES users(id),
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  decided_at    TIMESTAMPTZ,
+  CHECK (decided_by IS NULL OR decided_by <> requested_by OR status = 'REJECTED')
+);
+CREATE INDEX IF NOT EXISTS idx_wallet_adjustments_status ON wallet_adjustments(status, created_at DESC);
+
+-- P2P TRANSFERS
+-- Both legs go through TRANSFER_CLEARING, so a transfer nets to zero there.
+ALTER TYPE ledger_type ADD VALUE IF NOT EXISTS 'TRANSFER_OUT';
+ALTER TYPE ledger_type ADD VALUE IF NOT EXISTS 'TRANSFER_IN';
+ALTER TYPE journal_account ADD VALUE IF NOT EXISTS 'TRANSFER_CLEARING';
+
+CREATE TABLE IF NOT EXISTS wallet_transfers (
+  id            BIGSERIAL PRIMARY KEY,
+  from_user_id  BIGINT NOT NULL REFERENCES users(id),
+  to_user_id    BIGINT NOT NULL REFERENCES users(id),
+  amount        NUMERIC(18,2) NOT NULL CHECK (amount > 0),
+  note          TEXT NOT NULL DEFAULT '',
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK (from_user_id <> to_user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_wallet_transfers_from ON wallet_transfers(from_user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_wallet_transfers_to ON wallet_transfers(to_user_id, created_at DESC);
+
+-- VOUCHERS
+-- Promo credit is a marketing expense, so both voucher types post against MARKETING.
+ALTER TYPE ledger_type ADD VALUE IF NOT EXISTS 'VOUCHER_CREDIT';
+ALTER TYPE ledger_type ADD VALUE IF NOT EXISTS 'TOPUP_BONUS';
+ALTER TYPE journal_account ADD VALUE IF NOT EXISTS 'MARKETING';
+
+DO $$ BEGIN
+  CREATE TYPE voucher_kind AS ENUM ('CREDIT','TOPUP_BONUS');
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+
+CREATE TABLE IF NOT EXISTS vouchers (
+  id              BIGSERIAL PRIMARY KEY,
+  code            TEXT UNIQUE NOT NULL CHECK (code = upper(code)),
+  kind            voucher_kind NOT NULL,
+  amount          NUMERIC(18,2) NOT NULL CHECK (amount > 0),
+  percent         INT NOT NULL DEFAULT 0 CHECK (percent BETWEEN 0 AND 100),
+  min_topup       NUMERIC(18,2) NOT NULL DEFAULT 0,
+  starts_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at      TIMESTAMPTZ,
+  max_uses        INT NOT NULL DEFAULT 0 CHECK (max_uses >= 0),  -- 0 = unlimited
+  per_user_limit  INT NOT NULL DEFAULT 1 CHECK (per_user_limit >= 1),
+  uses            INT NOT NULL DEFAULT 0,
+  active          BOOLEAN NOT NULL DEFAULT TRUE,
+  created_by      BIGINT NOT NULL REFERENCES users(id),
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS voucher_redemptions (
+  id          BIGSERIAL PRIMARY KEY,
+  voucher_id  BIGINT NOT NULL REFERENCES vouchers(id),
+  user_id     BIGINT NOT NULL REFERENCES users(id),
+  amount      NUMERIC(18,2) NOT NULL CHECK (amount > 0),
+  topup_id    BIGINT REFERENCES wallet_topups(id),
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_voucher_redemptions_user ON voucher_redemptions(voucher_id, user_id);
+
+-- PAYMENT WEBHOOK EVENTS
+-- Every inbound webhook is stored before it is processed. Only verified
+-- events claim their event_id, so forged requests cannot block real ones.
+DO $$ BEGIN
+  CREATE TYPE payment_event_kind AS ENUM ('INVOICE','DISBURSEMENT');
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+
+DO $$ BEGIN
+  CREATE TYPE payment_event_status AS ENUM ('RECEIVED','PROCESSED','FAILED','REJECTED');
+EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+
+CREATE TABLE IF NOT EXISTS payment_events (
+  id               BIGSERIAL PRIMARY KEY,
+  kind             payment_event_kind NOT NULL,
+  event_id         TEXT NOT NULL,
+  headers          JSONB NOT NULL DEFAULT '{}',
+  raw_body         BYTEA NOT NULL,
+  verified         BOOLEAN NOT NULL,
+  status           payment_event_status NOT NULL,
+  error            TEXT,
+  attempts         INT NOT NULL DEFAULT 0,
+  received_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_attempt_at  TIMESTAMPTZ,
+  processed_at     TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_payment_events_event ON payment_events(kind, event_id) WHERE verified;
+CREATE INDEX IF NOT EXISTS idx_payment_events_status ON payment_events(status, id DESC);
@@ -0,0 +1,138 @@
+// Package pdf writes plain-text PDF documents: A4 pages of monospaced lines,
+// enough for statements and reports without pulling in a rendering library.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Page geometry in points. Courier glyphs are 0.6em wide, so a line holds
+// (pageWidth-2*margin)/(0.6*fontSize) characters.
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	margin     = 50
+	fontSize   = 9
+	leading    = 12
+
+	// LineWidth is how many characters fit on one line.
+	LineWidth = (pageWidth - 2*margin) * 10 / (6 * fontSize)
+	perPage   = (pageHeight - 2*margin) / leading
+)
+
+type line struct {
+	text string
+	bold bool
+}
+
+// Doc accumulates lines and breaks them into pages.
+type Doc struct {
+	lines []line
+}
+
+// New returns an empty document.
+func New() *Doc { return &Doc{} }
+
+// Text appends a line in the regular face. Longer lines are cut at LineWidth.
+func (d *Doc) Text(s string) { d.lines = append(d.lines, line{text: s}) }
+
+// Bold appends a line in the bold face.
+func (d *Doc) Bold(s string) { d.lines = append(d.lines, line{text: s, bold: true}) }
+
+// Blank appends an empty line.
+func (d *Doc) Blank() { d.Text("") }
+
+// Bytes renders the document. An empty document still gets one page.
+func (d *Doc) Bytes() []byte {
+	var pages [][]line
+	for i := 0; i < len(d.lines); i += perPage {
+		pages = append(pages, d.lines[i:min(i+perPage, len(d.lines))])
+	}
+	if len(pages) == 0 {
+		pages = [][]line{nil}
+	}
+
+	w := &writer{}
+	w.buf.WriteString("%PDF-1.4\n")
+
+	// Objects 1-4 are fixed; each page then takes a page object and its
+	// content stream.
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	w.object("<< /Type /Catalog /Pages 2 0 R >>")
+	w.object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	w.object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>")
+	w.object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold >>")
+	for i, p := range pages {
+		w.object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+2*i))
+		content := pageContent(p)
+		w.object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	xref := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, off := range w.offsets {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(w.offsets)+1, xref)
+	return w.buf.Bytes()
+}
+
+type writer struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+// object writes the next numbered object and records its offset for xref.
+func (w *writer) object(body string) {
+	w.offsets = append(w.offsets, w.buf.Len())
+	fmt.Fprintf(&w.buf, "%d 0 obj\n%s\nendobj\n", len(w.offsets), body)
+}
+
+func pageContent(lines []line) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "BT\n%d TL\n%d %d Td\n", leading, margin, pageHeight-margin-fontSize)
+	font := ""
+	for _, l := range lines {
+		f := "/F1"
+		if l.bold {
+			f = "/F2"
+		}
+		if f != font {
+			fmt.Fprintf(&b, "%s %d Tf\n", f, fontSize)
+			font = f
+		}
+		fmt.Fprintf(&b, "(%s) Tj T*\n", escape(l.text))
+	}
+	b.WriteString("ET")
+	return b.String()
+}
+
+// escape makes s safe inside a PDF string literal. The standard fonts only
+// cover ASCII here, so anything else becomes '?'.
+func escape(s string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		if n == LineWidth {
+			break
+		}
+		n++
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,143 @@
+// Package sqlstub is a database/sql driver that accepts transactions and
+// statements and does nothing with them. Service tests use it where the
+// repositories are stubbed but the service still opens a *sql.Tx; repository
+// tests queue the rows a query should return and check the SQL it ran.
+package sqlstub
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+)
+
+// DB is a *sql.DB backed by the stub, plus what was done through it.
+type DB struct {
+	*sql.DB
+	st *state
+}
+
+type state struct {
+	mu        sync.Mutex
+	commits   int
+	rollbacks int
+	execs     []string
+	queries   []string
+	results   []*rows
+}
+
+// New opens a fresh stub database.
+func New() *DB {
+	st := &state{}
+	return &DB{DB: sql.OpenDB(connector{st}), st: st}
+}
+
+// Commits reports how many transactions were committed.
+func (db *DB) Commits() int {
+	db.st.mu.Lock()
+	defer db.st.mu.Unlock()
+	return db.st.commits
+}
+
+// Rollbacks reports how many transactions were rolled back.
+func (db *DB) Rollbacks() int {
+	db.st.mu.Lock()
+	defer db.st.mu.Unlock()
+	return db.st.rollbacks
+}
+
+// Execs returns the statements executed directly, in order.
+func (db *DB) Execs() []string {
+	db.st.mu.Lock()
+	defer db.st.mu.Unlock()
+	return append([]string(nil), db.st.execs...)
+}
+
+// Queries returns the queries run, in order.
+func (db *DB) Queries() []string {
+	db.st.mu.Lock()
+	defer db.st.mu.Unlock()
+	return append([]string(nil), db.st.queries...)
+}
+
+// Return queues the result of the next query: columns and their rows.
+// A query with nothing queued fails.
+func (db *DB) Return(cols []string, values ...[]driver.Value) {
+	db.st.mu.Lock()
+	defer db.st.mu.Unlock()
+	db.st.results = append(db.st.results, &rows{cols: cols, values: values})
+}
+
+type connector struct{ st *state }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return conn(c), nil }
+func (c connector) Driver() driver.Driver                        { return drv{} }
+
+type drv struct{}
+
+func (drv) Open(string) (driver.Conn, error) { return nil, errors.New("sqlstub: use New") }
+
+type conn struct{ st *state }
+
+func (c conn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("sqlstub: prepared statements are not supported")
+}
+func (c conn) Close() error              { return nil }
+func (c conn) Begin() (driver.Tx, error) { return tx(c), nil }
+
+// BeginTx accepts any isolation level; there is nothing to isolate.
+func (c conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) { return tx(c), nil }
+
+func (c conn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.st.mu.Lock()
+	defer c.st.mu.Unlock()
+	c.st.execs = append(c.st.execs, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c conn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.st.mu.Lock()
+	defer c.st.mu.Unlock()
+	c.st.queries = append(c.st.queries, query)
+	if len(c.st.results) == 0 {
+		return nil, errors.New("sqlstub: no result queued for query")
+	}
+	r := c.st.results[0]
+	c.st.results = c.st.results[1:]
+	return r, nil
+}
+
+type rows struct {
+	cols   []string
+	values [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.cols }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+type tx struct{ st *state }
+
+func (t tx) Commit() error {
+	t.st.mu.Lock()
+	defer t.st.mu.Unlock()
+	t.st.commits++
+	return nil
+}
+
+func (t tx) Rollback() error {
+	t.st.mu.Lock()
+	defer t.st.mu.Unlock()
+	t.st.rollbacks++
+	return nil
+}